@@ -1,31 +1,96 @@
 package abi
 
 import (
+	"context"
+	"sort"
+
 	"github.com/moonbite-org/moonbite/common"
 )
 
 type Builtin interface {
 	Name() string
+	// the value programs see when they refer to the builtin
+	Object() common.Object
 }
 
 type BuiltinFun struct {
 	name string
-	Fun  func(params ...common.Object) common.Object
+	// the capability the builtin needs, builtins without one are always granted
+	capability Capability
+	Fun        func(params ...common.Object) common.Object
+	// takes the place of fun when the builtin is called by a vm, see common.BuiltinFunObject
+	Blocking func(ctx context.Context, params ...common.Object) common.Object
+}
+
+func CreateBuiltinFun(name string, fun func(params ...common.Object) common.Object) BuiltinFun {
+	return BuiltinFun{
+		name: name,
+		Fun:  fun,
+	}
 }
 
 func (b BuiltinFun) Name() string {
 	return b.name
 }
 
+func (b BuiltinFun) Capability() Capability {
+	return b.capability
+}
+
+func (b BuiltinFun) Object() common.Object {
+	return common.BuiltinFunObject{Name: b.name, Value: b.Fun, Blocking: b.Blocking}
+}
+
+// BuiltinMap groups builtins under a name, programs refer to its members as name.member
 type BuiltinMap struct {
-	name  string
-	Value common.MapObject
+	name string
+	// ordered by their names
+	Members []Builtin
+	Value   common.MapObject
 }
 
+// CreateBuiltinMap creates a map of the builtins in data, the builtins are named after their keys
 func CreateBuiltinMap(name string, data map[string]Builtin) BuiltinMap {
-	return BuiltinMap{
-		name:  name,
-		Value: common.MapObject{},
+	result := BuiltinMap{
+		name:    name,
+		Members: []Builtin{},
+		Value:   common.MapObject{},
+	}
+
+	keys := []string{}
+
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		member := rename(data[key], key)
+
+		result.Members = append(result.Members, member)
+		result.Value.Value = append(result.Value.Value, struct {
+			Key   common.Object
+			Value common.Object
+		}{common.StringObject{Value: key}, member.Object()})
+	}
+
+	return result
+}
+
+func rename(builtin Builtin, name string) Builtin {
+	switch builtin := builtin.(type) {
+	case BuiltinFun:
+		builtin.name = name
+		return builtin
+	case BuiltinMap:
+		builtin.name = name
+		return builtin
+	case DeniedBuiltin:
+		builtin.name = name
+		return builtin
+	default:
+		return builtin
 	}
 }
 
@@ -33,6 +98,48 @@ func (b BuiltinMap) Name() string {
 	return b.name
 }
 
+func (b BuiltinMap) Object() common.Object {
+	return b.Value
+}
+
 type ABI struct {
 	Builtins []Builtin
 }
+
+type Symbol struct {
+	// members of maps are named after their path, such as syscall.write
+	Name   string
+	Object common.Object
+	// the capability a denied builtin needs, empty if the builtin is granted
+	Denied Capability
+}
+
+// Symbols lists the builtins of the abi, each map is followed by its members. The
+// compiler and the vm index builtins in this order.
+func (a ABI) Symbols() []Symbol {
+	result := []Symbol{}
+
+	for _, builtin := range a.Builtins {
+		result = append_symbols(result, builtin, builtin.Name())
+	}
+
+	return result
+}
+
+func append_symbols(result []Symbol, builtin Builtin, name string) []Symbol {
+	symbol := Symbol{Name: name, Object: builtin.Object()}
+
+	if denied, ok := builtin.(DeniedBuiltin); ok {
+		symbol.Denied = denied.Capability
+	}
+
+	result = append(result, symbol)
+
+	if builtin, ok := builtin.(BuiltinMap); ok {
+		for _, member := range builtin.Members {
+			result = append_symbols(result, member, name+"."+member.Name())
+		}
+	}
+
+	return result
+}
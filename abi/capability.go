@@ -0,0 +1,143 @@
+package abi
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+// Capability is a group of builtins a host grants to the programs it runs
+type Capability string
+
+const (
+	// printing and reading lines
+	StdioCapability Capability = "stdio"
+	// reading files and checking if they exist
+	ReadCapability Capability = "fs.read"
+	// writing and removing files
+	WriteCapability Capability = "fs.write"
+	ClockCapability Capability = "clock"
+	// reading and setting environment variables and reading the arguments
+	EnvCapability     Capability = "env"
+	NetworkCapability Capability = "net"
+)
+
+// DeniedBuiltin takes the place of a builtin that is not granted. Programs that refer to it
+// do not compile, and calling it after looking it up dynamically is a runtime error.
+type DeniedBuiltin struct {
+	name       string
+	path       string
+	Capability Capability
+}
+
+func (b DeniedBuiltin) Name() string {
+	return b.name
+}
+
+func (b DeniedBuiltin) Object() common.Object {
+	reason := fmt.Sprintf("builtin '%s' is denied, it needs the %s capability", b.path, b.Capability)
+
+	return common.BuiltinFunObject{
+		Name: b.name,
+		Value: func(params ...common.Object) common.Object {
+			return common.ErrorObject{Reason: reason}
+		},
+	}
+}
+
+// CreateSandboxABI creates the native abi with only the given capabilities granted. The
+// files of the system root are the only ones programs can reach, so granting fs.read or
+// fs.write needs a root. Programs see only the variables of the system env, which start
+// out empty if it is nil, the ones of the process are never read or changed.
+func CreateSandboxABI(system System, capabilities ...Capability) (ABI, error) {
+	if system.Root == "" {
+		for _, capability := range []Capability{ReadCapability, WriteCapability} {
+			if slices.Contains(capabilities, capability) {
+				return ABI{}, fmt.Errorf("the %s capability needs a root to confine the files to", capability)
+			}
+		}
+	}
+
+	if system.Env == nil {
+		system.Env = map[string]string{}
+	}
+
+	return CreateNativeABI(system).Restrict(capabilities...), nil
+}
+
+// Restrict denies the builtins of an abi that need a capability which is not given,
+// the indices of the builtins stay the same
+func (a ABI) Restrict(capabilities ...Capability) ABI {
+	result := ABI{Builtins: []Builtin{}}
+
+	for _, builtin := range a.Builtins {
+		result.Builtins = append(result.Builtins, restrict(builtin, builtin.Name(), capabilities))
+	}
+
+	return result
+}
+
+func restrict(builtin Builtin, path string, capabilities []Capability) Builtin {
+	switch builtin := builtin.(type) {
+	case BuiltinFun:
+		if builtin.capability == "" || slices.Contains(capabilities, builtin.capability) {
+			return builtin
+		}
+
+		return DeniedBuiltin{name: builtin.name, path: path, Capability: builtin.capability}
+	case BuiltinMap:
+		members := map[string]Builtin{}
+
+		for _, member := range builtin.Members {
+			members[member.Name()] = restrict(member, path+"."+member.Name(), capabilities)
+		}
+
+		return CreateBuiltinMap(builtin.name, members)
+	default:
+		return builtin
+	}
+}
+
+// resolves the path of a file under a root, programs cannot reach the files outside of it
+func confine(root string, path string) (string, error) {
+	if root == "" {
+		return path, nil
+	}
+
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	// cleaning an absolute path removes every .. that would leave the root
+	result := filepath.Join(root, filepath.Clean("/"+path))
+
+	// links in the root may still point outside of it, the closest existing parent is checked
+	resolved := result
+	rest := ""
+
+	for {
+		target, err := filepath.EvalSymlinks(resolved)
+		if err == nil {
+			resolved = filepath.Join(target, rest)
+			break
+		}
+
+		parent := filepath.Dir(resolved)
+		if parent == resolved {
+			return "", err
+		}
+
+		rest = filepath.Join(filepath.Base(resolved), rest)
+		resolved = parent
+	}
+
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the sandbox", path)
+	}
+
+	return resolved, nil
+}
@@ -1,16 +1,415 @@
 package abi
 
-import "github.com/moonbite-org/moonbite/common"
-
-var NativeABI = ABI{
-	Builtins: []Builtin{
-		CreateBuiltinMap("syscall", map[string]Builtin{
-			"write": BuiltinFun{
-				name: "write",
-				Fun: func(params ...common.Object) common.Object {
-					return nil
-				},
-			},
-		}),
-	},
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+// System is what the native abi reads from and writes to
+type System struct {
+	// the arguments of the program, without the name of the executable
+	Args []string
+	// the standard streams, the ones that are nil are empty
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// paths of files are relative to the root if it is set, and cannot leave it
+	Root string
+	// the environment variables, outside of sandboxes the ones of the process are used if it is nil
+	Env map[string]string
+	// fetches the contents of a url, the network is not available if it is nil
+	Fetch func(ctx context.Context, url string) (string, error)
+}
+
+var NativeABI = CreateNativeABI(System{
+	Args:   os.Args[1:],
+	Stdin:  os.Stdin,
+	Stdout: os.Stdout,
+	Stderr: os.Stderr,
+	Fetch:  fetch,
+})
+
+// CreateNativeABI creates the builtins for I/O, time, the environment and the network.
+// Functions that fail raise a warning with the reason, so that programs can handle them
+// with or.
+func CreateNativeABI(system System) ABI {
+	// streams that are not given are empty and writing to them does nothing
+	if system.Stdin == nil {
+		system.Stdin = strings.NewReader("")
+	}
+
+	if system.Stdout == nil {
+		system.Stdout = io.Discard
+	}
+
+	if system.Stderr == nil {
+		system.Stderr = io.Discard
+	}
+
+	stdin := bufio.NewReader(system.Stdin)
+
+	return ABI{
+		Builtins: []Builtin{
+			CreateBuiltinMap("syscall", map[string]Builtin{
+				// writes to stdout (1) or stderr (2) and returns the number of bytes written
+				"write": fun(StdioCapability, 2, func(params []common.Object) (common.Object, error) {
+					fd, err := integer(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					var writer io.Writer
+
+					switch fd {
+					case 1:
+						writer = system.Stdout
+					case 2:
+						writer = system.Stderr
+					default:
+						return nil, fmt.Errorf("cannot write to file descriptor %d", fd)
+					}
+
+					data, err := text(params[1])
+					if err != nil {
+						return nil, err
+					}
+
+					n, err := io.WriteString(writer, data)
+					if err != nil {
+						return nil, err
+					}
+
+					return common.Int32Object{Value: int32(n)}, nil
+				}),
+			}),
+			CreateBuiltinMap("io", map[string]Builtin{
+				"print": fun(StdioCapability, 0, func(params []common.Object) (common.Object, error) {
+					_, err := io.WriteString(system.Stdout, format(params))
+					return nil, err
+				}),
+				"println": fun(StdioCapability, 0, func(params []common.Object) (common.Object, error) {
+					_, err := io.WriteString(system.Stdout, format(params)+"\n")
+					return nil, err
+				}),
+				// reads a line from stdin without its line ending, raises a warning at the end of the input
+				"read_line": fun(StdioCapability, 0, func(params []common.Object) (common.Object, error) {
+					line, err := stdin.ReadString('\n')
+					if err != nil && (err != io.EOF || len(line) == 0) {
+						return nil, err
+					}
+
+					line = strings.TrimSuffix(line, "\n")
+					line = strings.TrimSuffix(line, "\r")
+
+					return common.StringObject{Value: line}, nil
+				}),
+				"read_file": fun(ReadCapability, 1, func(params []common.Object) (common.Object, error) {
+					path, err := system.path(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					data, err := os.ReadFile(path)
+					if err != nil {
+						return nil, err
+					}
+
+					return common.StringObject{Value: string(data)}, nil
+				}),
+				"write_file": fun(WriteCapability, 2, func(params []common.Object) (common.Object, error) {
+					return nil, system.write_file(params, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+				}),
+				"append_file": fun(WriteCapability, 2, func(params []common.Object) (common.Object, error) {
+					return nil, system.write_file(params, os.O_CREATE|os.O_APPEND|os.O_WRONLY)
+				}),
+				"exists": fun(ReadCapability, 1, func(params []common.Object) (common.Object, error) {
+					path, err := system.path(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					_, err = os.Stat(path)
+					if err != nil && !errors.Is(err, os.ErrNotExist) {
+						return nil, err
+					}
+
+					return common.BoolObject{Value: err == nil}, nil
+				}),
+				"remove": fun(WriteCapability, 1, func(params []common.Object) (common.Object, error) {
+					path, err := system.path(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					return nil, os.Remove(path)
+				}),
+			}),
+			CreateBuiltinMap("time", map[string]Builtin{
+				// milliseconds since the unix epoch
+				"now": fun(ClockCapability, 0, func(params []common.Object) (common.Object, error) {
+					return common.Int64Object{Value: time.Now().UnixMilli()}, nil
+				}),
+				"sleep": blocking(ClockCapability, 1, func(ctx context.Context, params []common.Object) (common.Object, error) {
+					milliseconds, err := integer(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					timer := time.NewTimer(time.Duration(milliseconds) * time.Millisecond)
+					defer timer.Stop()
+
+					select {
+					case <-timer.C:
+						return nil, nil
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				}),
+			}),
+			CreateBuiltinMap("env", map[string]Builtin{
+				"args": fun(EnvCapability, 0, func(params []common.Object) (common.Object, error) {
+					result := common.ListObject{Value: []common.Object{}}
+
+					for _, arg := range system.Args {
+						result.Value = append(result.Value, common.StringObject{Value: arg})
+					}
+
+					return result, nil
+				}),
+				// raises a warning if the variable is not set
+				"get": fun(EnvCapability, 1, func(params []common.Object) (common.Object, error) {
+					name, err := text(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					value, ok := system.getenv(name)
+					if !ok {
+						return nil, fmt.Errorf("environment variable %s is not set", name)
+					}
+
+					return common.StringObject{Value: value}, nil
+				}),
+				"set": fun(EnvCapability, 2, func(params []common.Object) (common.Object, error) {
+					name, err := text(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					value, err := text(params[1])
+					if err != nil {
+						return nil, err
+					}
+
+					return nil, system.setenv(name, value)
+				}),
+			}),
+			CreateBuiltinMap("net", map[string]Builtin{
+				"fetch": blocking(NetworkCapability, 1, func(ctx context.Context, params []common.Object) (common.Object, error) {
+					url, err := text(params[0])
+					if err != nil {
+						return nil, err
+					}
+
+					if system.Fetch == nil {
+						return nil, fmt.Errorf("the network is not available")
+					}
+
+					body, err := system.Fetch(ctx, url)
+					if err != nil {
+						return nil, err
+					}
+
+					return common.StringObject{Value: body}, nil
+				}),
+			}),
+		},
+	}
+}
+
+func (s System) getenv(name string) (string, bool) {
+	if s.Env == nil {
+		return os.LookupEnv(name)
+	}
+
+	value, ok := s.Env[name]
+	return value, ok
+}
+
+func (s System) setenv(name string, value string) error {
+	if s.Env == nil {
+		return os.Setenv(name, value)
+	}
+
+	s.Env[name] = value
+	return nil
+}
+
+func fetch(ctx context.Context, url string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return "", fmt.Errorf("fetching %s failed with status %s", url, response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// creates a builtin that takes at least count arguments, errors are raised as warnings
+func fun(capability Capability, count int, body func(params []common.Object) (common.Object, error)) BuiltinFun {
+	return BuiltinFun{
+		capability: capability,
+		Fun: func(params ...common.Object) common.Object {
+			return call(count, params, body)
+		},
+	}
+}
+
+// creates a builtin like fun that stops blocking once the context of the run is cancelled
+func blocking(capability Capability, count int, body func(ctx context.Context, params []common.Object) (common.Object, error)) BuiltinFun {
+	result := fun(capability, count, func(params []common.Object) (common.Object, error) {
+		return body(context.Background(), params)
+	})
+
+	result.Blocking = func(ctx context.Context, params ...common.Object) common.Object {
+		return call(count, params, func(params []common.Object) (common.Object, error) {
+			return body(ctx, params)
+		})
+	}
+
+	return result
+}
+
+func call(count int, params []common.Object, body func(params []common.Object) (common.Object, error)) common.Object {
+	if len(params) < count {
+		return warn(fmt.Errorf("expected %d arguments but got %d", count, len(params)))
+	}
+
+	result, err := body(params)
+	if err != nil {
+		return warn(err)
+	}
+
+	if result == nil {
+		return common.NullObject{}
+	}
+
+	return result
+}
+
+func warn(err error) common.Object {
+	return common.WarningObject{Value: common.StringObject{Value: err.Error()}}
+}
+
+// strings are either string objects or lists of runes
+func text(object common.Object) (string, error) {
+	switch object := object.(type) {
+	case common.StringObject:
+		return object.Value, nil
+	case common.ListObject:
+		result := []rune{}
+
+		for _, item := range object.Value {
+			r, err := integer(item)
+			if err != nil {
+				return "", fmt.Errorf("expected a string but got %s", common.FormatObject(object))
+			}
+
+			result = append(result, rune(r))
+		}
+
+		return string(result), nil
+	default:
+		return "", fmt.Errorf("expected a string but got %s", common.FormatObject(object))
+	}
+}
+
+func integer(object common.Object) (int64, error) {
+	switch value := object.GetValue().(type) {
+	case uint8:
+		return int64(value), nil
+	case uint16:
+		return int64(value), nil
+	case uint32:
+		return int64(value), nil
+	case uint64:
+		return int64(value), nil
+	case int8:
+		return int64(value), nil
+	case int16:
+		return int64(value), nil
+	case int32:
+		return int64(value), nil
+	case int64:
+		return value, nil
+	default:
+		return 0, fmt.Errorf("expected an integer but got %s", common.FormatObject(object))
+	}
+}
+
+// print writes strings as they are and every other value as it is written in source
+func format(params []common.Object) string {
+	values := []string{}
+
+	for _, param := range params {
+		values = append(values, common.DisplayObject(param))
+	}
+
+	return strings.Join(values, " ")
+}
+
+func (s System) path(object common.Object) (string, error) {
+	path, err := text(object)
+	if err != nil {
+		return "", err
+	}
+
+	return confine(s.Root, path)
+}
+
+func (s System) write_file(params []common.Object, flags int) error {
+	path, err := s.path(params[0])
+	if err != nil {
+		return err
+	}
+
+	data, err := text(params[1])
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
 }
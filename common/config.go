@@ -1,11 +1,18 @@
 package common
 
 type config struct {
-	ArchiveName  string
+	ArchiveName string
+	// modules are only loaded by the version they are compiled with, it changes whenever
+	// the encoding of instructions or the order of the builtins changes
 	VersionStamp string
 }
 
 var Config = config{
 	ArchiveName:  "<moonbite archive>",
-	VersionStamp: "0.0.1-pre-alpha",
+	VersionStamp: "0.0.3-pre-alpha",
 }
+
+// Builtins are defined by both the compiler and the vm in this exact
+// order, before the builtins of the ABI. Compiled modules refer to builtins
+// by their indices, so the version stamp changes along with this list.
+var Builtins = []string{"exit", "#null", "pause", "channel", "#iterate"}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ToObject converts a Go value to an object. Go ints become the Int of the language,
+// which is 32 bits wide, slices and arrays become lists and maps become maps. Objects
+// are returned as they are.
+func ToObject(value interface{}) (Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return NullObject{}, nil
+	case Object:
+		return value, nil
+	case string:
+		return StringObject{Value: value}, nil
+	case bool:
+		return BoolObject{Value: value}, nil
+	case int:
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			return nil, fmt.Errorf("%d does not fit in an Int, use int64 instead", value)
+		}
+		return Int32Object{Value: int32(value)}, nil
+	case int8:
+		return Int8Object{Value: value}, nil
+	case int16:
+		return Int16Object{Value: value}, nil
+	case int32:
+		return Int32Object{Value: value}, nil
+	case int64:
+		return Int64Object{Value: value}, nil
+	case uint8:
+		return Uint8Object{Value: value}, nil
+	case uint16:
+		return Uint16Object{Value: value}, nil
+	case uint32:
+		return Uint32Object{Value: value}, nil
+	case uint64:
+		return Uint64Object{Value: value}, nil
+	case float32:
+		return Float32Object{Value: value}, nil
+	case float64:
+		return Float64Object{Value: value}, nil
+	case func(params ...Object) Object:
+		return BuiltinFunObject{Name: "<host>", Value: value}, nil
+	}
+
+	reflected := reflect.ValueOf(value)
+
+	switch reflected.Kind() {
+	case reflect.Slice, reflect.Array:
+		result := ListObject{Value: make([]Object, reflected.Len())}
+
+		for i := 0; i < reflected.Len(); i++ {
+			item, err := ToObject(reflected.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			result.Value[i] = item
+		}
+
+		return result, nil
+	case reflect.Map:
+		result := MapObject{}
+		keys := reflected.MapKeys()
+
+		// go maps have no order, their keys are sorted to keep the result stable
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		for _, key := range keys {
+			key_object, err := ToObject(key.Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			value_object, err := ToObject(reflected.MapIndex(key).Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			result.Value = append(result.Value, struct {
+				Key   Object
+				Value Object
+			}{key_object, value_object})
+		}
+
+		return result, nil
+	case reflect.Pointer:
+		if reflected.IsNil() {
+			return NullObject{}, nil
+		}
+
+		return ToObject(reflected.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("cannot convert a value of type %T to an object", value)
+}
+
+// FromObject converts an object to a Go value. Numbers, strings and bools become their
+// Go counterparts, lists become []interface{}, maps become map[interface{}]interface{}
+// and instances become map[string]interface{}. Null becomes nil and functions are
+// returned as objects.
+func FromObject(object Object) interface{} {
+	if object == nil {
+		return nil
+	}
+
+	switch object.Kind() {
+	case NullObjectKind:
+		return nil
+	case ListObjectKind:
+		list := object.(ListObject)
+		result := make([]interface{}, len(list.Value))
+
+		for i, item := range list.Value {
+			result[i] = FromObject(item)
+		}
+
+		return result
+	case MapObjectKind:
+		result := map[interface{}]interface{}{}
+
+		for _, entry := range object.(MapObject).Value {
+			key := FromObject(entry.Key)
+
+			// keys that cannot be go map keys are kept in their printed form
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				key = fmt.Sprint(key)
+			}
+
+			result[key] = FromObject(entry.Value)
+		}
+
+		return result
+	case InstanceObjectKind:
+		result := map[string]interface{}{}
+
+		for _, entry := range object.(InstanceObject).Value {
+			result[fmt.Sprint(FromObject(entry.Key))] = FromObject(entry.Value)
+		}
+
+		return result
+	case FunObjectKind, BuiltinObjectKind:
+		return object
+	default:
+		return object.GetValue()
+	}
+}
@@ -0,0 +1,293 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// Disassemble renders a module as text, every instruction is printed with its byte offset,
+// constants and global symbols are resolved and jump targets are labeled
+func Disassemble(module Module) string {
+	symbols := map[int]string{}
+
+	for _, symbol := range module.Symbols {
+		symbols[symbol.Index] = symbol.Name
+	}
+
+	builder := &strings.Builder{}
+	builder.WriteString(fmt.Sprintf("module (version %s)\n", module.Version))
+
+	if len(module.Debug.Files) > 0 {
+		builder.WriteString("\nfiles:\n")
+
+		for _, file := range module.Debug.Files {
+			builder.WriteString(fmt.Sprintf("  %s\n", file))
+		}
+	}
+
+	builder.WriteString("\nconstants:\n")
+	functions := []int{}
+
+	for index, constant := range module.ConstantPool.Values {
+		if constant == nil {
+			break
+		}
+
+		if _, ok := constant.(FunctionObject); ok {
+			functions = append(functions, index)
+		}
+
+		builder.WriteString(fmt.Sprintf("  #%-4d %s\n", index, FormatObject(constant)))
+	}
+
+	builder.WriteString("\ncode:\n")
+	disassemble_instructions(builder, module.Instructions, module.Debug.Lines, module.ConstantPool, symbols)
+
+	for _, index := range functions {
+		info := module.Debug.Functions[index]
+
+		if len(info.Name) > 0 {
+			builder.WriteString(fmt.Sprintf("\nfunction #%d %s:\n", index, info.Name))
+		} else {
+			builder.WriteString(fmt.Sprintf("\nfunction #%d:\n", index))
+		}
+
+		disassemble_instructions(builder, module.ConstantPool.Values[index].(FunctionObject).Value, info.Lines, module.ConstantPool, symbols)
+	}
+
+	return builder.String()
+}
+
+// JumpTarget resolves the byte offset a jump at offset lands on, forward jumps
+// are relative to the end of the jump and backward jumps to its start
+func JumpTarget(instruction Instruction, offset int) (int, bool) {
+	switch instruction.Op {
+	case OpJump, OpJumpIfFalse, OpBreak, OpContinue, OpDefer,
+		OpJumpIfNotGreaterThan, OpJumpIfNotGreaterThanOrEqual, OpJumpIfNotEqual, OpJumpIfEqual:
+	default:
+		return 0, false
+	}
+
+	if instruction.Operands[1] == 1 {
+		return offset - int(instruction.Operands[0]), true
+	}
+
+	return offset + instruction.GetSize() + int(instruction.Operands[0]), true
+}
+
+// the source line of the instructions is printed above them wherever it changes
+func disassemble_instructions(builder *strings.Builder, instructions InstructionSet, lines LineTable, pool ConstantPool, symbols map[int]string) {
+	offsets := []int{}
+	labels := map[int]string{}
+	offset := 0
+
+	for _, instruction := range instructions {
+		offsets = append(offsets, offset)
+
+		if target, ok := JumpTarget(instruction, offset); ok {
+			labels[target] = ""
+		}
+
+		offset += instruction.GetSize()
+	}
+
+	targets := []int{}
+	for target := range labels {
+		targets = append(targets, target)
+	}
+	sort.Ints(targets)
+
+	for i, target := range targets {
+		labels[target] = fmt.Sprintf("L%d", i)
+	}
+
+	var source errors.Location
+
+	for i, instruction := range instructions {
+		offset := offsets[i]
+
+		if label, ok := labels[offset]; ok {
+			builder.WriteString(fmt.Sprintf("%s:\n", label))
+		}
+
+		if location, ok := lines.Lookup(offset); ok && (location.File != source.File || location.Start.Line != source.Start.Line) {
+			builder.WriteString(fmt.Sprintf("  ; %s:%d\n", location.File, location.Start.Line))
+			source = location
+		}
+
+		line := fmt.Sprintf("  %04d  %s", offset, instruction)
+
+		if comment := describe_instruction(instruction, offset, pool, symbols, labels); len(comment) > 0 {
+			line = fmt.Sprintf("%-40s ; %s", line, comment)
+		}
+
+		builder.WriteString(line + "\n")
+	}
+
+	// jumps may land right after the last instruction
+	if label, ok := labels[offset]; ok {
+		builder.WriteString(fmt.Sprintf("%s:\n", label))
+	}
+}
+
+func describe_instruction(instruction Instruction, offset int, pool ConstantPool, symbols map[int]string, labels map[int]string) string {
+	switch instruction.Op {
+	case OpConstant, OpIndexConstant, OpClosure:
+		index := int(instruction.Operands[0])
+
+		if index >= len(pool.Values) || pool.Values[index] == nil {
+			return "<missing constant>"
+		}
+
+		return FormatObject(pool.Values[index])
+	case OpIncrementLocal:
+		index := int(instruction.Operands[1])
+
+		if index >= len(pool.Values) || pool.Values[index] == nil {
+			return "<missing constant>"
+		}
+
+		return fmt.Sprintf("+= %s", FormatObject(pool.Values[index]))
+	case OpInstance:
+		index := int(instruction.Operands[1])
+
+		if index >= len(pool.Values) || pool.Values[index] == nil {
+			return "<missing constant>"
+		}
+
+		return DisplayObject(pool.Values[index])
+	case OpMethod:
+		names := []string{}
+
+		for _, operand := range instruction.Operands {
+			if int(operand) >= len(pool.Values) || pool.Values[operand] == nil {
+				return "<missing constant>"
+			}
+
+			names = append(names, DisplayObject(pool.Values[operand]))
+		}
+
+		return strings.Join(names, ".")
+	case OpCast:
+		index := int(instruction.Operands[0])
+
+		if index >= len(pool.Values) || pool.Values[index] == nil {
+			return "<missing constant>"
+		}
+
+		return fmt.Sprintf("to %s", pool.Values[index].Kind())
+	case OpGet, OpSet, OpAssign, OpGetBuiltin:
+		if name, ok := symbols[int(instruction.Operands[0])]; ok {
+			return name
+		}
+	case OpCapture:
+		if instruction.Operands[1] == 1 {
+			return "free"
+		}
+
+		return "local"
+	case OpSetItem:
+		if instruction.Operands[2] == 0 {
+			if name, ok := symbols[int(instruction.Operands[0])]; ok {
+				return name
+			}
+		}
+	}
+
+	if target, ok := JumpTarget(instruction, offset); ok {
+		return fmt.Sprintf("-> %s (%04d)", labels[target], target)
+	}
+
+	return ""
+}
+
+// FormatObject renders an object the way it would be written in source
+func FormatObject(object Object) string {
+	switch object := object.(type) {
+	case StringObject:
+		return fmt.Sprintf("%q", object.Value)
+	case ByteObject:
+		return fmt.Sprintf("'%c'", object.Value)
+	case ListObject:
+		if text, ok := list_text(object); ok {
+			return fmt.Sprintf("%q", text)
+		}
+
+		values := []string{}
+
+		for _, value := range object.Value {
+			values = append(values, FormatObject(value))
+		}
+
+		return fmt.Sprintf("[%s]", strings.Join(values, ", "))
+	case MapObject:
+		return format_entries(object.Value)
+	case InstanceObject:
+		return format_entries(object.Value)
+	case FunctionObject:
+		if len(object.Name) > 0 {
+			return fmt.Sprintf("fun %s (%d instructions)", object.Name, len(object.Value))
+		}
+
+		return fmt.Sprintf("fun (%d instructions)", len(object.Value))
+	case BuiltinFunObject:
+		return fmt.Sprintf("builtin %s", object.Name)
+	case NullObject:
+		return "null"
+	default:
+		return fmt.Sprintf("%v", object.GetValue())
+	}
+}
+
+// DisplayObject renders strings as their text and every other object the way it would
+// be written in source. Strings that are lists of runes are only told apart from lists of
+// numbers by the flag the list is made with.
+func DisplayObject(object Object) string {
+	switch object := object.(type) {
+	case StringObject:
+		return object.Value
+	case ListObject:
+		if text, ok := list_text(object); ok {
+			return text
+		}
+
+		return FormatObject(object)
+	default:
+		return FormatObject(object)
+	}
+}
+
+func list_text(list ListObject) (string, bool) {
+	if !list.Text {
+		return "", false
+	}
+
+	result := []rune{}
+
+	for _, item := range list.Value {
+		r, ok := item.(Int32Object)
+		if !ok {
+			return "", false
+		}
+
+		result = append(result, r.Value)
+	}
+
+	return string(result), true
+}
+
+func format_entries(entries []struct {
+	Key   Object
+	Value Object
+}) string {
+	values := []string{}
+
+	for _, entry := range entries {
+		values = append(values, fmt.Sprintf("%s: %s", FormatObject(entry.Key), FormatObject(entry.Value)))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(values, ", "))
+}
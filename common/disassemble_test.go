@@ -0,0 +1,66 @@
+package common_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+func TestDisassemble(t *testing.T) {
+	pool := common.ConstantPool{}
+	pool.Add(common.StringObject{Value: "moon"})
+
+	module := common.Module{
+		Version:      common.Config.VersionStamp,
+		ConstantPool: pool,
+		Instructions: common.InstructionSet{
+			at(common.NewInstruction(common.OpConstant, 0), 3, 1),
+			at(common.NewInstruction(common.OpSet, 2), 3, 1),
+			common.NewInstruction(common.OpJump, 3, 0),
+			common.NewInstruction(common.OpGet, 2),
+			common.NewInstruction(common.OpPop),
+			common.NewInstruction(common.OpJump, 14, 1),
+		},
+		Symbols: []common.ModuleSymbol{{Name: "name", Scope: common.GlobalModuleSymbol, Index: 2}},
+	}
+	module.Debug = common.CreateDebugInfo(nil, module.Instructions, pool)
+
+	result := common.Disassemble(module)
+
+	for _, expected := range []string{
+		`0000  Constant(0)`, `; "moon"`,
+		`0003  Set(2)`, `; name`,
+		`0006  Jump(3 0)`, `; -> L1 (0013)`,
+		"L1:\n  0013  Pop()",
+		`0014  Jump(14 1)`, "L0:\n  ; main.mb:3\n  0000  Constant(0)",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("expected disassembly to contain %q but got:\n%s", expected, result)
+		}
+	}
+}
+
+func TestDisplayObject(t *testing.T) {
+	runes := []common.Object{common.Int32Object{Value: 72}, common.Int32Object{Value: 105}}
+
+	for _, test := range []struct {
+		object    common.Object
+		displayed string
+		formatted string
+	}{
+		{common.StringObject{Value: "moon"}, "moon", `"moon"`},
+		{common.ListObject{}, "[]", "[]"},
+		{common.ListObject{Value: runes}, "[72, 105]", "[72, 105]"},
+		{common.ListObject{Value: runes, Text: true}, "Hi", `"Hi"`},
+		{common.ListObject{Text: true}, "", `""`},
+	} {
+		if result := common.DisplayObject(test.object); result != test.displayed {
+			t.Errorf("expected %#v to be displayed as %q but got %q", test.object, test.displayed, result)
+		}
+
+		if result := common.FormatObject(test.object); result != test.formatted {
+			t.Errorf("expected %#v to be formatted as %q but got %q", test.object, test.formatted, result)
+		}
+	}
+}
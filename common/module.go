@@ -0,0 +1,753 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+/*
+A compiled module (.mbc) is laid out as follows, all numbers are little endian:
+
+	magic          4 bytes, "MBC" followed by the format revision
+	version        uint16 length followed by the version stamp of the compiler
+	section count  uint8
+	section table  section count entries of kind (uint8), offset (uint32) and size (uint32),
+	               offsets are relative to the start of the file
+	sections       the section data
+
+The sections are:
+
+	constants  the serialized constant pool
+	code       the instructions of the module
+	symbols    uint32 count followed by the global symbols as
+	           name (uint16 length + bytes), scope (uint8) and index (uint32)
+	debug      uint32 count followed by the source file paths as uint16 length + bytes,
+	           then the source map: uint32 count followed by the names of the files
+	           it refers to as above, the line table of the code, uint32 count followed
+	           by the functions as constant index (uint32), name (uint16 length + bytes)
+	           and line table, and last uint32 count followed by the locals of the
+	           functions as constant index (uint32) and uint32 count followed by the
+	           locals as name (uint16 length + bytes), index (uint32), line (uint32)
+	           and column (uint32)
+
+Line tables are a uint32 count followed by entries of byte offset (uint32), file
+(uint16 index of its name), line (uint32) and column (uint32).
+*/
+
+var Magic = []byte{'M', 'B', 'C', 1}
+
+const ModuleExtension = ".mbc"
+
+type SectionKind byte
+
+const (
+	ConstantsSection SectionKind = iota + 1
+	CodeSection
+	SymbolsSection
+	DebugSection
+)
+
+type ModuleSymbolScope byte
+
+const (
+	BuiltinModuleSymbol ModuleSymbolScope = iota + 1
+	GlobalModuleSymbol
+)
+
+type ModuleSymbol struct {
+	Name  string
+	Scope ModuleSymbolScope
+	Index int
+}
+
+type DebugInfo struct {
+	Files []string
+	// the source map of the code
+	Lines LineTable
+	// the functions of the constant pool by their indices
+	Functions map[int]FunctionDebugInfo
+}
+
+type Module struct {
+	Version      string
+	ConstantPool ConstantPool
+	Instructions InstructionSet
+	Symbols      []ModuleSymbol
+	Debug        DebugInfo
+}
+
+func (m Module) Serialize() []byte {
+	// modules that are built without a version are stamped with the current one
+	version := m.Version
+	if version == "" {
+		version = Config.VersionStamp
+	}
+
+	header := []byte{}
+	header = append(header, Magic...)
+	header = append(header, serialize_string(version)...)
+
+	sections := []struct {
+		kind SectionKind
+		data []byte
+	}{
+		{ConstantsSection, m.ConstantPool.Serialize()},
+		{CodeSection, m.Instructions.GetBytes()},
+		{SymbolsSection, m.serialize_symbols()},
+		{DebugSection, m.serialize_debug()},
+	}
+
+	header = append(header, byte(len(sections)))
+	// each section table entry is 9 bytes long
+	offset := len(header) + len(sections)*9
+	body := []byte{}
+
+	for _, section := range sections {
+		header = append(header, byte(section.kind))
+		header = append(header, NumberToBytes(uint32(offset))...)
+		header = append(header, NumberToBytes(uint32(len(section.data)))...)
+		body = append(body, section.data...)
+		offset += len(section.data)
+	}
+
+	return append(header, body...)
+}
+
+func (m Module) serialize_symbols() []byte {
+	result := NumberToBytes(uint32(len(m.Symbols)))
+
+	for _, symbol := range m.Symbols {
+		result = append(result, serialize_string(symbol.Name)...)
+		result = append(result, byte(symbol.Scope))
+		result = append(result, NumberToBytes(uint32(symbol.Index))...)
+	}
+
+	return result
+}
+
+func (m Module) serialize_debug() []byte {
+	result := NumberToBytes(uint32(len(m.Debug.Files)))
+
+	for _, file := range m.Debug.Files {
+		result = append(result, serialize_string(file)...)
+	}
+
+	functions := []int{}
+	for index := range m.Debug.Functions {
+		functions = append(functions, index)
+	}
+	sort.Ints(functions)
+
+	// line tables refer to the names of files by their indices
+	names := []string{}
+	indices := map[string]int{}
+	tables := []LineTable{m.Debug.Lines}
+
+	for _, index := range functions {
+		tables = append(tables, m.Debug.Functions[index].Lines)
+	}
+
+	for _, table := range tables {
+		for _, entry := range table {
+			if _, ok := indices[entry.File]; !ok {
+				indices[entry.File] = len(names)
+				names = append(names, entry.File)
+			}
+		}
+	}
+
+	result = append(result, NumberToBytes(uint32(len(names)))...)
+	for _, name := range names {
+		result = append(result, serialize_string(name)...)
+	}
+
+	result = append(result, serialize_lines(m.Debug.Lines, indices)...)
+	result = append(result, NumberToBytes(uint32(len(functions)))...)
+
+	for _, index := range functions {
+		result = append(result, NumberToBytes(uint32(index))...)
+		result = append(result, serialize_string(m.Debug.Functions[index].Name)...)
+		result = append(result, serialize_lines(m.Debug.Functions[index].Lines, indices)...)
+	}
+
+	result = append(result, NumberToBytes(uint32(len(functions)))...)
+
+	for _, index := range functions {
+		result = append(result, NumberToBytes(uint32(index))...)
+		result = append(result, NumberToBytes(uint32(len(m.Debug.Functions[index].Locals)))...)
+
+		for _, local := range m.Debug.Functions[index].Locals {
+			result = append(result, serialize_string(local.Name)...)
+			result = append(result, NumberToBytes(uint32(local.Index))...)
+			result = append(result, NumberToBytes(uint32(local.Line))...)
+			result = append(result, NumberToBytes(uint32(local.Column))...)
+		}
+	}
+
+	return result
+}
+
+func serialize_lines(table LineTable, files map[string]int) []byte {
+	result := NumberToBytes(uint32(len(table)))
+
+	for _, entry := range table {
+		result = append(result, NumberToBytes(uint32(entry.Offset))...)
+		result = append(result, NumberToBytes(uint16(files[entry.File]))...)
+		result = append(result, NumberToBytes(uint32(entry.Line))...)
+		result = append(result, NumberToBytes(uint32(entry.Column))...)
+	}
+
+	return result
+}
+
+func serialize_string(value string) []byte {
+	result := NumberToBytes(uint16(len(value)))
+	return append(result, []byte(value)...)
+}
+
+// Deserialize reads a module that is created by Module.Serialize
+func Deserialize(data []byte) (Module, error) {
+	result := Module{}
+	r := &reader{data: data}
+
+	magic, err := r.read(len(Magic))
+	if err != nil || !bytes.Equal(magic, Magic) {
+		return result, fmt.Errorf("not a moonbite module")
+	}
+
+	result.Version, err = r.read_string()
+	if err != nil {
+		return result, err
+	}
+
+	if result.Version != Config.VersionStamp {
+		return result, fmt.Errorf("module is compiled with version %s but this is version %s", result.Version, Config.VersionStamp)
+	}
+
+	count, err := r.read_byte()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		kind, err := r.read_byte()
+		if err != nil {
+			return result, err
+		}
+		offset, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		size, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+
+		if int(offset)+int(size) > len(data) {
+			return result, fmt.Errorf("section %d exceeds the module size", kind)
+		}
+
+		section := &reader{data: data[offset : offset+size]}
+
+		switch SectionKind(kind) {
+		case ConstantsSection:
+			result.ConstantPool, err = section.read_pool()
+		case CodeSection:
+			result.Instructions, err = ReadInstructions(section.data)
+		case SymbolsSection:
+			result.Symbols, err = section.read_symbols()
+		case DebugSection:
+			result.Debug, err = section.read_debug()
+		default:
+			// unknown sections are skipped so that newer modules stay readable
+		}
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.restore_debug()
+
+	return result, nil
+}
+
+// instructions are not encoded with their locations and functions not with their
+// names, they are restored from the debug section
+func (m *Module) restore_debug() {
+	m.Debug.Lines.restore(m.Instructions)
+
+	for index, info := range m.Debug.Functions {
+		if index >= len(m.ConstantPool.Values) {
+			continue
+		}
+
+		if fun, ok := m.ConstantPool.Values[index].(FunctionObject); ok {
+			info.Lines.restore(fun.Value)
+			fun.Name = info.Name
+			fun.Locals = info.Locals
+			m.ConstantPool.Values[index] = fun
+		}
+	}
+}
+
+type reader struct {
+	data   []byte
+	offset int
+}
+
+func (r *reader) done() bool {
+	return r.offset >= len(r.data)
+}
+
+func (r *reader) read(n int) ([]byte, error) {
+	if r.offset+n > len(r.data) {
+		return nil, fmt.Errorf("unexpected end of module at offset %d", r.offset)
+	}
+
+	result := r.data[r.offset : r.offset+n]
+	r.offset += n
+
+	return result, nil
+}
+
+func (r *reader) read_byte() (byte, error) {
+	data, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return data[0], nil
+}
+
+func (r *reader) peek_byte() (byte, error) {
+	if r.done() {
+		return 0, fmt.Errorf("unexpected end of module at offset %d", r.offset)
+	}
+
+	return r.data[r.offset], nil
+}
+
+func (r *reader) read_uint16() (uint16, error) {
+	data, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint16(data), nil
+}
+
+func (r *reader) read_uint32() (uint32, error) {
+	data, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+func (r *reader) read_uint64() (uint64, error) {
+	data, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+func (r *reader) read_string() (string, error) {
+	length, err := r.read_uint16()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := r.read(int(length))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// reads bytes until the terminator, the terminator itself is consumed
+func (r *reader) read_terminated() ([]byte, error) {
+	end := bytes.IndexByte(r.data[r.offset:], type_map[terminator_kind])
+
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated value at offset %d", r.offset)
+	}
+
+	result := r.data[r.offset : r.offset+end]
+	r.offset += end + 1
+
+	return result, nil
+}
+
+func (r *reader) read_pool() (ConstantPool, error) {
+	pool := ConstantPool{}
+
+	kind, err := r.read_byte()
+	if err != nil {
+		return pool, err
+	}
+
+	if kind != type_map[pool_block_kind] {
+		return pool, fmt.Errorf("expected a constant pool at offset %d", r.offset-1)
+	}
+
+	// constant indices may start with a zero byte as well,
+	// so only the last byte of the section is the terminator
+	for r.offset < len(r.data)-1 {
+		index, err := r.read_uint32()
+		if err != nil {
+			return pool, err
+		}
+
+		if int(index) >= max_constants {
+			return pool, fmt.Errorf("constant index %d is out of the pool", index)
+		}
+
+		object, err := r.read_object()
+		if err != nil {
+			return pool, err
+		}
+
+		for int(index) >= len(pool.Values) {
+			pool.Values = append(pool.Values, nil)
+		}
+
+		pool.Values[index] = object
+	}
+
+	terminator, err := r.read_byte()
+	if err != nil {
+		return pool, err
+	}
+
+	if terminator != type_map[terminator_kind] {
+		return pool, fmt.Errorf("expected the end of the constant pool at offset %d", r.offset-1)
+	}
+
+	return pool, nil
+}
+
+func (r *reader) read_entries() ([]struct {
+	Key   Object
+	Value Object
+}, error) {
+	result := []struct {
+		Key   Object
+		Value Object
+	}{}
+
+	for {
+		next, err := r.peek_byte()
+		if err != nil {
+			return result, err
+		}
+
+		if next == type_map[terminator_kind] {
+			r.offset++
+			return result, nil
+		}
+
+		key, err := r.read_object()
+		if err != nil {
+			return result, err
+		}
+
+		value, err := r.read_object()
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, struct {
+			Key   Object
+			Value Object
+		}{Key: key, Value: value})
+	}
+}
+
+func (r *reader) read_object() (Object, error) {
+	kind, err := r.read_byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case type_map[StringObjectKind]:
+		data, err := r.read_terminated()
+		return StringObject{Value: string(data)}, err
+	case type_map[ByteObjectKind]:
+		data, err := r.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return ByteObject{Value: data[0]}, nil
+	case type_map[BoolObjectKind]:
+		value, err := r.read_byte()
+		return BoolObject{Value: value == 1}, err
+	case type_map[Uint8ObjectKind]:
+		value, err := r.read_byte()
+		return Uint8Object{Value: value}, err
+	case type_map[Uint16ObjectKind]:
+		value, err := r.read_uint16()
+		return Uint16Object{Value: value}, err
+	case type_map[Uint32ObjectKind]:
+		value, err := r.read_uint32()
+		return Uint32Object{Value: value}, err
+	case type_map[Uint64ObjectKind]:
+		value, err := r.read_uint64()
+		return Uint64Object{Value: value}, err
+	case type_map[Int8ObjectKind]:
+		value, err := r.read_byte()
+		return Int8Object{Value: int8(value)}, err
+	case type_map[Int16ObjectKind]:
+		value, err := r.read_uint16()
+		return Int16Object{Value: int16(value)}, err
+	case type_map[Int32ObjectKind]:
+		value, err := r.read_uint32()
+		return Int32Object{Value: int32(value)}, err
+	case type_map[Int64ObjectKind]:
+		value, err := r.read_uint64()
+		return Int64Object{Value: int64(value)}, err
+	case type_map[Float32ObjectKind]:
+		value, err := r.read_uint32()
+		return Float32Object{Value: math.Float32frombits(value)}, err
+	case type_map[Float64ObjectKind]:
+		value, err := r.read_uint64()
+		return Float64Object{Value: math.Float64frombits(value)}, err
+	case type_map[ListObjectKind]:
+		result := ListObject{Value: []Object{}}
+
+		for {
+			next, err := r.peek_byte()
+			if err != nil {
+				return nil, err
+			}
+
+			if next == type_map[terminator_kind] {
+				r.offset++
+				return result, nil
+			}
+
+			value, err := r.read_object()
+			if err != nil {
+				return nil, err
+			}
+
+			result.Value = append(result.Value, value)
+		}
+	case type_map[MapObjectKind]:
+		entries, err := r.read_entries()
+		return MapObject{Value: entries}, err
+	case type_map[InstanceObjectKind]:
+		entries, err := r.read_entries()
+		return InstanceObject{Value: entries}, err
+	case type_map[FunObjectKind]:
+		size, err := r.read_uint32()
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.read(int(size))
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := ReadInstructions(data)
+		return FunctionObject{Value: instructions}, err
+	case type_map[BuiltinObjectKind]:
+		data, err := r.read_terminated()
+		return BuiltinFunObject{Name: string(data)}, err
+	case type_map[NullObjectKind]:
+		return NullObject{}, nil
+	default:
+		return nil, fmt.Errorf("unknown object kind %d at offset %d", kind, r.offset-1)
+	}
+}
+
+func (r *reader) read_symbols() ([]ModuleSymbol, error) {
+	result := []ModuleSymbol{}
+
+	count, err := r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		name, err := r.read_string()
+		if err != nil {
+			return result, err
+		}
+		scope, err := r.read_byte()
+		if err != nil {
+			return result, err
+		}
+		index, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, ModuleSymbol{Name: name, Scope: ModuleSymbolScope(scope), Index: int(index)})
+	}
+
+	return result, nil
+}
+
+func (r *reader) read_debug() (DebugInfo, error) {
+	result := DebugInfo{Files: []string{}}
+
+	count, err := r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		file, err := r.read_string()
+		if err != nil {
+			return result, err
+		}
+
+		result.Files = append(result.Files, file)
+	}
+
+	count, err = r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	names := []string{}
+
+	for i := 0; i < int(count); i++ {
+		name, err := r.read_string()
+		if err != nil {
+			return result, err
+		}
+
+		names = append(names, name)
+	}
+
+	result.Lines, err = r.read_lines(names)
+	if err != nil {
+		return result, err
+	}
+
+	count, err = r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		index, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		name, err := r.read_string()
+		if err != nil {
+			return result, err
+		}
+		lines, err := r.read_lines(names)
+		if err != nil {
+			return result, err
+		}
+
+		if result.Functions == nil {
+			result.Functions = map[int]FunctionDebugInfo{}
+		}
+
+		result.Functions[int(index)] = FunctionDebugInfo{Name: name, Lines: lines}
+	}
+
+	count, err = r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		index, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		locals, err := r.read_locals()
+		if err != nil {
+			return result, err
+		}
+
+		if function, ok := result.Functions[int(index)]; ok {
+			function.Locals = locals
+			result.Functions[int(index)] = function
+		}
+	}
+
+	return result, nil
+}
+
+func (r *reader) read_locals() ([]Local, error) {
+	var result []Local
+
+	count, err := r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		name, err := r.read_string()
+		if err != nil {
+			return result, err
+		}
+		index, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		line, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		column, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, Local{Name: name, Index: int(index), Line: int(line), Column: int(column)})
+	}
+
+	return result, nil
+}
+
+func (r *reader) read_lines(names []string) (LineTable, error) {
+	var result LineTable
+
+	count, err := r.read_uint32()
+	if err != nil {
+		return result, err
+	}
+
+	for i := 0; i < int(count); i++ {
+		offset, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		file, err := r.read_uint16()
+		if err != nil {
+			return result, err
+		}
+		line, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+		column, err := r.read_uint32()
+		if err != nil {
+			return result, err
+		}
+
+		if int(file) >= len(names) {
+			return result, fmt.Errorf("file %d of a line table is not in the debug section", file)
+		}
+
+		result = append(result, LineEntry{Offset: int(offset), File: names[file], Line: int(line), Column: int(column)})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package common_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+func TestModuleRoundTrip(t *testing.T) {
+	pool := common.ConstantPool{}
+	pool.Add(common.StringObject{Value: "moon"})
+	pool.Add(common.Int32Object{Value: -7})
+	pool.Add(common.Float64Object{Value: 1.5})
+	pool.Add(common.BoolObject{Value: true})
+	pool.Add(common.ListObject{Value: []common.Object{common.Uint8Object{Value: 1}, common.Uint64Object{Value: 2}}})
+	pool.Add(common.FunctionObject{Name: "identity", Locals: []common.Local{{Name: "#warning"}, {Name: "value", Index: 1}}, Value: common.InstructionSet{
+		at(common.NewInstruction(common.OpGetLocal, 1), 4, 10),
+		at(common.NewInstruction(common.OpReturn), 4, 3),
+	}})
+
+	module := common.Module{
+		Version:      common.Config.VersionStamp,
+		ConstantPool: pool,
+		Instructions: common.InstructionSet{
+			at(common.NewInstruction(common.OpConstant, 5), 3, 1),
+			at(common.NewInstruction(common.OpSet, 3), 3, 1),
+			common.NewInstruction(common.OpJump, 12, 1),
+			common.NewInstruction(common.OpSetItem, 3, 2, 1),
+		},
+		Symbols: []common.ModuleSymbol{
+			{Name: "exit", Scope: common.BuiltinModuleSymbol, Index: 0},
+			{Name: "main", Scope: common.GlobalModuleSymbol, Index: 3},
+		},
+	}
+	module.Debug = common.CreateDebugInfo([]string{"main.mb"}, module.Instructions, pool)
+
+	result, err := common.Deserialize(module.Serialize())
+	if err != nil {
+		t.Fatalf("expected no error but got: %s", err)
+	}
+
+	if !reflect.DeepEqual(result, module) {
+		t.Errorf("expected module to be %+v but got %+v", module, result)
+	}
+}
+
+func TestModuleVersion(t *testing.T) {
+	result, err := common.Deserialize(common.Module{}.Serialize())
+	if err != nil {
+		t.Fatalf("expected no error but got: %s", err)
+	}
+
+	if result.Version != common.Config.VersionStamp {
+		t.Errorf("expected version to be %s but got %s", common.Config.VersionStamp, result.Version)
+	}
+
+	// a module keeps the version it is compiled with
+	_, err = common.Deserialize(common.Module{Version: "0.0.0-old"}.Serialize())
+	if err == nil || !strings.Contains(err.Error(), "compiled with version 0.0.0-old") {
+		t.Errorf("expected a version error but got: %v", err)
+	}
+}
+
+func TestTruncatedDebugSection(t *testing.T) {
+	pool := common.ConstantPool{}
+	pool.Add(common.FunctionObject{Name: "main", Value: common.InstructionSet{
+		at(common.NewInstruction(common.OpReturn), 2, 1),
+	}})
+
+	module := common.Module{Version: common.Config.VersionStamp, ConstantPool: pool, Instructions: common.InstructionSet{}}
+	module.Debug = common.CreateDebugInfo([]string{"main.mb"}, module.Instructions, pool)
+	data := module.Serialize()
+
+	// the debug section is the last one, it loses the count, index and locals of the only function
+	data = data[:len(data)-12]
+	entry := len(common.Magic) + 2 + len(common.Config.VersionStamp) + 1 + 3*9
+	size := common.BytesToInt[uint32](data[entry+5 : entry+9])
+	copy(data[entry+5:], common.NumberToBytes(size-12))
+
+	if _, err := common.Deserialize(data); err == nil {
+		t.Errorf("expected error but no error is present")
+	}
+}
+
+func TestModuleMagic(t *testing.T) {
+	if _, err := common.Deserialize([]byte("not a module")); err == nil {
+		t.Errorf("expected error but no error is present")
+	}
+}
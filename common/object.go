@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -28,6 +29,10 @@ const (
 	MapObjectKind      ObjectKind = "object:map"
 	InstanceObjectKind ObjectKind = "object:instance"
 	FunObjectKind      ObjectKind = "object:fun"
+	BuiltinObjectKind  ObjectKind = "object:builtin"
+	NullObjectKind     ObjectKind = "object:null"
+	WarningObjectKind  ObjectKind = "object:warning"
+	ErrorObjectKind    ObjectKind = "object:error"
 	terminator_kind    ObjectKind = "object:terminator"
 	pool_block_kind    ObjectKind = "object:pool"
 )
@@ -48,6 +53,10 @@ var type_map = map[ObjectKind]byte{
 	MapObjectKind:      24,
 	InstanceObjectKind: 25,
 	FunObjectKind:      26,
+	BuiltinObjectKind:  27,
+	NullObjectKind:     28,
+	Float32ObjectKind:  29,
+	Float64ObjectKind:  30,
 	pool_block_kind:    126,
 	terminator_kind:    0,
 }
@@ -285,7 +294,7 @@ func (o Float32Object) Serialize() []byte {
 }
 
 type Float64Object struct {
-	Value float32
+	Value float64
 }
 
 func (o Float64Object) Kind() ObjectKind {
@@ -304,6 +313,8 @@ func (o Float64Object) Serialize() []byte {
 
 type ListObject struct {
 	Value []Object
+	// lists of runes made from strings, they are displayed as text
+	Text bool
 }
 
 func (o ListObject) Kind() ObjectKind {
@@ -359,6 +370,9 @@ type InstanceObject struct {
 		Key   Object
 		Value Object
 	}
+	// the qualified name of the type of the instance, the vm finds the methods of the
+	// instance by it, it is not serialized with the instance
+	Type string
 }
 
 func (o InstanceObject) Kind() ObjectKind {
@@ -384,6 +398,10 @@ func (o InstanceObject) Serialize() []byte {
 
 type FunctionObject struct {
 	Value InstructionSet
+	// the name stack traces show for the function and the names of its locals,
+	// they are not serialized with the function but in the debug section
+	Name   string
+	Locals []Local
 }
 
 func (o FunctionObject) Kind() ObjectKind {
@@ -402,24 +420,111 @@ func (o FunctionObject) Serialize() []byte {
 	return result
 }
 
+type BuiltinFunObject struct {
+	Name  string
+	Value func(params ...Object) Object
+	// builtins that block are called with the context of the run instead, so that they
+	// return once it is cancelled
+	Blocking func(ctx context.Context, params ...Object) Object
+}
+
+func (o BuiltinFunObject) Kind() ObjectKind {
+	return BuiltinObjectKind
+}
+
+func (o BuiltinFunObject) GetValue() interface{} {
+	return o.Name
+}
+
+func (o BuiltinFunObject) Serialize() []byte {
+	result := []byte{type_map[o.Kind()]}
+	result = append(result, []byte(o.Name)...)
+	result = append(result, type_map[terminator_kind])
+	return result
+}
+
+type NullObject struct{}
+
+func (o NullObject) Kind() ObjectKind {
+	return NullObjectKind
+}
+
+func (o NullObject) GetValue() interface{} {
+	return nil
+}
+
+func (o NullObject) Serialize() []byte {
+	return []byte{type_map[o.Kind()]}
+}
+
+// WarningObject is returned by builtins to raise a warning in the function that
+// calls them, the call results in null. It never reaches programs as a value.
+type WarningObject struct {
+	Value Object
+}
+
+func (o WarningObject) Kind() ObjectKind {
+	return WarningObjectKind
+}
+
+func (o WarningObject) GetValue() interface{} {
+	return o.Value.GetValue()
+}
+
+// warnings are not constants, they are serialized as the value they hold
+func (o WarningObject) Serialize() []byte {
+	return o.Value.Serialize()
+}
+
+// ErrorObject is returned by builtins to stop the program with a runtime error. Like
+// warnings it never reaches programs as a value.
+type ErrorObject struct {
+	Reason string
+}
+
+func (o ErrorObject) Kind() ObjectKind {
+	return ErrorObjectKind
+}
+
+func (o ErrorObject) GetValue() interface{} {
+	return o.Reason
+}
+
+func (o ErrorObject) Serialize() []byte {
+	return StringObject{Value: o.Reason}.Serialize()
+}
+
 func ObjectFromLiteral(literal parser.LiteralExpression) Object {
 	switch literal.LiteralKind() {
 	case parser.StringLiteralKind:
 		return StringObject{Value: literal.(parser.StringLiteralExpression).Value}
 	case parser.BoolLiteralKind:
 		return BoolObject{Value: literal.(parser.BoolLiteralExpression).Value}
+	case parser.RuneLiteralKind:
+		return Int32Object{Value: literal.(parser.RuneLiteralExpression).Value}
 	case parser.NumberLiteralKind:
+		switch value := literal.(parser.NumberLiteralExpression).Value.Value.(type) {
+		case int:
+			return Int32Object{Value: int32(value)}
+		case float64:
+			return Float32Object{Value: float32(value)}
+		}
+
 		return StringObject{Value: "not implemented"}
 	default:
 		return StringObject{Value: "not implemented"}
 	}
 }
 
+// the number of constants the operands of OpConstant can refer to
+const max_constants = 1 << 16
+
 type ConstantPool struct {
-	Values  [1024]Object
-	pointer int
+	Values []Object
 }
 
+// adds a constant unless it is already in the pool, pools that outgrow the operands
+// are reported when the instructions that refer to them are validated
 func (p *ConstantPool) Add(value Object) int {
 	has := p.Has(value)
 
@@ -427,10 +532,9 @@ func (p *ConstantPool) Add(value Object) int {
 		return has
 	}
 
-	p.Values[p.pointer] = value
-	p.pointer++
+	p.Values = append(p.Values, value)
 
-	return p.pointer - 1
+	return len(p.Values) - 1
 }
 
 func (p *ConstantPool) Get(index int) Object {
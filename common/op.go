@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+
+	errors "github.com/moonbite-org/moonbite/error"
 )
 
 type Op byte
@@ -52,54 +54,122 @@ const (
 	OpInstanceof
 	OpCast
 	OpExit
+	OpGiveup
+	OpIncrementLocal
+	OpIndexConstant
+	OpJumpIfNotGreaterThan
+	OpJumpIfNotGreaterThanOrEqual
+	OpJumpIfNotEqual
+	OpJumpIfEqual
+	OpGetFree
+	OpSetFree
+	OpCapture
+	OpClosure
+	OpGenerator
+	OpCorout
+	OpInstance
+	OpMethod
+	OpString
 )
 
-var op_map = map[Op]string{
-	OpNoop:               "Noop",
-	OpConstant:           "Constant",
-	OpSet:                "Set",
-	OpGet:                "Get",
-	OpSetLocal:           "SetLocal",
-	OpGetLocal:           "GetLocal",
-	OpGetBuiltin:         "GetBuiltin",
-	OpAssign:             "Assign",
-	OpAssignLocal:        "AssignLocal",
-	OpSetItem:            "SetItem",
-	OpCall:               "Call",
-	OpPop:                "Pop",
-	OpReturn:             "Return",
-	OpReturnEmpty:        "ReturnEmpty",
-	OpBreak:              "Break",
-	OpDefer:              "Defer",
-	OpBreakEmpty:         "BreakEmpty",
-	OpContinue:           "Continue",
-	OpYield:              "Yield",
-	OpIndex:              "Index",
-	OpTrue:               "True",
-	OpFalse:              "False",
-	OpJump:               "Jump",
-	OpJumpIfFalse:        "JumpIfFalse",
-	OpAdd:                "Add",
-	OpSub:                "Sub",
-	OpMul:                "Mul",
-	OpDiv:                "Div",
-	OpMod:                "Mod",
-	OpAnd:                "And",
-	OpOr:                 "Or",
-	OpArray:              "Array",
-	OpMap:                "Map",
-	OpNegate:             "Negate",
-	OpEqual:              "Equal",
-	OpNotEqual:           "NotEqual",
-	OpGreaterThan:        "GreaterThan",
-	OpGreaterThanOrEqual: "GreaterThanOrEqual",
-	OpInstanceof:         "Instanceof",
-	OpExit:               "Exit",
+// Definition describes how an instruction is encoded, every operand
+// is an unsigned little endian integer of its width in bytes
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Op]Definition{
+	OpNoop:        {"Noop", []int{}},
+	OpConstant:    {"Constant", []int{2}},
+	OpSet:         {"Set", []int{2}},
+	OpGet:         {"Get", []int{2}},
+	OpSetLocal:    {"SetLocal", []int{1}},
+	OpGetLocal:    {"GetLocal", []int{1}},
+	OpGetBuiltin:  {"GetBuiltin", []int{2}},
+	OpAssign:      {"Assign", []int{2}},
+	OpAssignLocal: {"AssignLocal", []int{1}},
+	// symbol index, path size, scope of the symbol which is 0 for globals, 1 for locals and 2 for free variables
+	OpSetItem: {"SetItem", []int{2, 1, 1}},
+	// argument count
+	OpCall:        {"Call", []int{1}},
+	OpPop:         {"Pop", []int{}},
+	OpReturn:      {"Return", []int{}},
+	OpReturnEmpty: {"ReturnEmpty", []int{}},
+	// jumps and the instructions that are replaced by jumps take a distance and a direction
+	OpBreak:              {"Break", []int{2, 1}},
+	OpDefer:              {"Defer", []int{2, 1}},
+	OpBreakEmpty:         {"BreakEmpty", []int{}},
+	OpContinue:           {"Continue", []int{2, 1}},
+	OpYield:              {"Yield", []int{}},
+	OpIndex:              {"Index", []int{}},
+	OpTrue:               {"True", []int{}},
+	OpFalse:              {"False", []int{}},
+	OpJump:               {"Jump", []int{2, 1}},
+	OpJumpIfFalse:        {"JumpIfFalse", []int{2, 1}},
+	OpAdd:                {"Add", []int{}},
+	OpSub:                {"Sub", []int{}},
+	OpMul:                {"Mul", []int{}},
+	OpDiv:                {"Div", []int{}},
+	OpMod:                {"Mod", []int{}},
+	OpAnd:                {"And", []int{}},
+	OpOr:                 {"Or", []int{}},
+	OpArray:              {"Array", []int{2}},
+	OpMap:                {"Map", []int{2}},
+	OpNegate:             {"Negate", []int{}},
+	OpEqual:              {"Equal", []int{}},
+	OpNotEqual:           {"NotEqual", []int{}},
+	OpGreaterThan:        {"GreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"GreaterThanOrEqual", []int{}},
+	OpInstanceof:         {"Instanceof", []int{}},
+	// the constant index of a value of the type
+	OpCast: {"Cast", []int{2}},
+	// exit code
+	OpExit: {"Exit", []int{1}},
+	// stops the program with the warning on top of the stack
+	OpGiveup: {"Giveup", []int{}},
+	// superinstructions that replace common sequences, see the optimizer of the compiler
+	// local index, constant index
+	OpIncrementLocal: {"IncrementLocal", []int{1, 2}},
+	// constant index of the key
+	OpIndexConstant: {"IndexConstant", []int{2}},
+	// compare the two values on top of the stack and jump unless the comparison holds
+	OpJumpIfNotGreaterThan:        {"JumpIfNotGreaterThan", []int{2, 1}},
+	OpJumpIfNotGreaterThanOrEqual: {"JumpIfNotGreaterThanOrEqual", []int{2, 1}},
+	OpJumpIfNotEqual:              {"JumpIfNotEqual", []int{2, 1}},
+	OpJumpIfEqual:                 {"JumpIfEqual", []int{2, 1}},
+	// the variables a closure captures from the functions it is in, by their indices
+	OpGetFree: {"GetFree", []int{1}},
+	OpSetFree: {"SetFree", []int{1}},
+	// local or free index, is free
+	OpCapture: {"Capture", []int{1, 1}},
+	// constant index of the function, the number of captured variables before it
+	OpClosure: {"Closure", []int{2, 1}},
+	// turns the function on top of the stack into a gen function
+	OpGenerator: {"Generator", []int{}},
+	// turns the function on top of the stack into a corout function
+	OpCorout: {"Corout", []int{}},
+	// entry count, constant index of the name of the type
+	OpInstance: {"Instance", []int{2, 2}},
+	// binds the function on top of the stack to a type, constant indices of the names of the type and the method
+	OpMethod: {"Method", []int{2, 2}},
+	// element count, makes a list of the runes like Array and marks it as a string
+	OpString: {"String", []int{2}},
+}
+
+func Lookup(op Op) (Definition, error) {
+	definition, ok := definitions[op]
+
+	if !ok {
+		return Definition{}, fmt.Errorf("opcode %d is not defined", op)
+	}
+
+	return definition, nil
 }
 
 func (op Op) String() string {
-	if len(op_map[op]) > 1 {
-		return op_map[op]
+	if definition, ok := definitions[op]; ok {
+		return definition.Name
 	}
 
 	return fmt.Sprintf("%d", op)
@@ -163,21 +233,76 @@ func BytesToInt[T uint32 | uint64](data []byte) T {
 type Instruction struct {
 	Op       Op
 	Operands []uint32
+	// the source the instruction is compiled from, it is not encoded
+	Location errors.Location
 }
 
+// encodes the instruction, unknown ops take no bytes since Validate reports them
 func (i Instruction) GetBytes() []byte {
+	definition, err := Lookup(i.Op)
+
+	if err != nil {
+		return []byte{}
+	}
+
 	result := []byte{}
 	result = append(result, byte(i.Op))
 
-	for _, operand := range i.Operands {
-		result = append(result, NumberToBytes(operand)...)
+	for index, width := range definition.OperandWidths {
+		var operand uint32
+
+		if index < len(i.Operands) {
+			operand = i.Operands[index]
+		}
+
+		switch width {
+		case 1:
+			result = append(result, NumberToBytes(uint8(operand))...)
+		case 2:
+			result = append(result, NumberToBytes(uint16(operand))...)
+		case 4:
+			result = append(result, NumberToBytes(operand)...)
+		}
 	}
 
 	return result
 }
 
 func (i Instruction) GetSize() int {
-	return len(i.GetBytes())
+	definition, err := Lookup(i.Op)
+
+	if err != nil {
+		return 0
+	}
+
+	size := 1
+
+	for _, width := range definition.OperandWidths {
+		size += width
+	}
+
+	return size
+}
+
+// reports operands that do not fit in the width they are encoded with
+func (i Instruction) Validate() error {
+	definition, err := Lookup(i.Op)
+
+	if err != nil {
+		return err
+	}
+
+	if len(i.Operands) != len(definition.OperandWidths) {
+		return fmt.Errorf("%s expects %d operands but got %d", definition.Name, len(definition.OperandWidths), len(i.Operands))
+	}
+
+	for index, width := range definition.OperandWidths {
+		if width < 4 && i.Operands[index] >= 1<<(8*width) {
+			return fmt.Errorf("operand %d of %s does not fit in %d bytes", i.Operands[index], definition.Name, width)
+		}
+	}
+
+	return nil
 }
 
 func (i Instruction) String() string {
@@ -187,7 +312,46 @@ func (i Instruction) String() string {
 		operands = append(operands, fmt.Sprintf("%d", operand))
 	}
 
-	return fmt.Sprintf("%s(%s)", op_map[i.Op], strings.Join(operands, " "))
+	return fmt.Sprintf("%s(%s)", i.Op, strings.Join(operands, " "))
+}
+
+// ReadInstruction decodes the instruction at the start of data
+// and returns it along with the number of bytes it takes
+func ReadInstruction(data []byte) (Instruction, int, error) {
+	if len(data) == 0 {
+		return Instruction{}, 0, fmt.Errorf("no instruction to read")
+	}
+
+	op := Op(data[0])
+	definition, err := Lookup(op)
+
+	if err != nil {
+		return Instruction{}, 0, err
+	}
+
+	instruction := Instruction{Op: op, Operands: []uint32{}}
+	offset := 1
+
+	for _, width := range definition.OperandWidths {
+		if offset+width > len(data) {
+			return Instruction{}, 0, fmt.Errorf("unexpected end of %s instruction", definition.Name)
+		}
+
+		operand := data[offset : offset+width]
+
+		switch width {
+		case 1:
+			instruction.Operands = append(instruction.Operands, uint32(operand[0]))
+		case 2:
+			instruction.Operands = append(instruction.Operands, uint32(binary.LittleEndian.Uint16(operand)))
+		case 4:
+			instruction.Operands = append(instruction.Operands, binary.LittleEndian.Uint32(operand))
+		}
+
+		offset += width
+	}
+
+	return instruction, offset, nil
 }
 
 func NewInstruction(op Op, operands ...int) Instruction {
@@ -205,6 +369,19 @@ func NewInstruction(op Op, operands ...int) Instruction {
 
 type InstructionSet []Instruction
 
+// Locate sets the location of the instructions that do not have one yet
+func (s InstructionSet) Locate(location errors.Location) {
+	if location.Start.Line == 0 {
+		return
+	}
+
+	for i := range s {
+		if s[i].Location.Start.Line == 0 {
+			s[i].Location = location
+		}
+	}
+}
+
 func (s InstructionSet) GetBytes() []byte {
 	result := []byte{}
 
@@ -216,5 +393,37 @@ func (s InstructionSet) GetBytes() []byte {
 }
 
 func (i InstructionSet) GetSize() int {
-	return len(i.GetBytes())
+	size := 0
+
+	for _, instruction := range i {
+		size += instruction.GetSize()
+	}
+
+	return size
+}
+
+func (s InstructionSet) Validate() error {
+	for _, instruction := range s {
+		if err := instruction.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ReadInstructions(data []byte) (InstructionSet, error) {
+	result := InstructionSet{}
+
+	for offset := 0; offset < len(data); {
+		instruction, size, err := ReadInstruction(data[offset:])
+		if err != nil {
+			return result, fmt.Errorf("%s at offset %d", err, offset)
+		}
+
+		result = append(result, instruction)
+		offset += size
+	}
+
+	return result, nil
 }
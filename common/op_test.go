@@ -0,0 +1,59 @@
+package common_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+func TestInstructionWidths(t *testing.T) {
+	tests := []struct {
+		instruction common.Instruction
+		size        int
+	}{
+		{common.NewInstruction(common.OpPop), 1},
+		{common.NewInstruction(common.OpGetLocal, 3), 2},
+		{common.NewInstruction(common.OpConstant, 65535), 3},
+		{common.NewInstruction(common.OpJump, 300, 1), 4},
+		{common.NewInstruction(common.OpSetItem, 4, 2, 1), 5},
+	}
+
+	for _, test := range tests {
+		data := test.instruction.GetBytes()
+
+		if len(data) != test.size || test.instruction.GetSize() != test.size {
+			t.Errorf("expected %s to be %d bytes but got %d", test.instruction, test.size, len(data))
+		}
+
+		result, size, err := common.ReadInstruction(data)
+		if err != nil {
+			t.Fatalf("expected no error but got: %s", err)
+		}
+
+		if size != test.size || !reflect.DeepEqual(result, test.instruction) {
+			t.Errorf("expected %s but got %s", test.instruction, result)
+		}
+	}
+}
+
+func TestInstructionValidate(t *testing.T) {
+	if err := common.NewInstruction(common.OpGetLocal, 256).Validate(); err == nil {
+		t.Errorf("expected error but no error is present")
+	}
+
+	if err := common.NewInstruction(common.OpConstant, 65535).Validate(); err != nil {
+		t.Errorf("expected no error but got: %s", err)
+	}
+
+	// unknown ops are reported instead of being encoded
+	unknown := common.Instruction{Op: common.Op(255)}
+
+	if err := unknown.Validate(); err == nil {
+		t.Errorf("expected error but no error is present")
+	}
+
+	if len(unknown.GetBytes()) != 0 || unknown.GetSize() != 0 {
+		t.Errorf("expected %s to take no bytes", unknown)
+	}
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"sort"
+
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// LineEntry maps the instructions from its byte offset up to the next entry to their source,
+// a zero line means the instructions are not compiled from source
+type LineEntry struct {
+	Offset int
+	File   string
+	Line   int
+	Column int
+}
+
+// LineTable maps the instructions of a function or a module to their source, an entry is
+// added only where the source changes. Entries are ordered by their offsets.
+type LineTable []LineEntry
+
+// Local is a variable of a function that is visible from where it is declared on, a zero
+// line means it is visible in the whole function. Locals of different blocks may share an index.
+type Local struct {
+	Name   string
+	Index  int
+	Line   int
+	Column int
+}
+
+// FunctionDebugInfo is what is recorded for a function of the constant pool
+type FunctionDebugInfo struct {
+	Name   string
+	Lines  LineTable
+	Locals []Local
+}
+
+// CreateLineTable creates the line table of instructions from their locations
+func CreateLineTable(instructions InstructionSet) LineTable {
+	var result LineTable
+	offset := 0
+
+	for _, instruction := range instructions {
+		entry := LineEntry{
+			Offset: offset,
+			File:   instruction.Location.File,
+			Line:   instruction.Location.Start.Line,
+			Column: instruction.Location.Start.Column,
+		}
+
+		if entry.Line == 0 {
+			entry.File = ""
+			entry.Column = 0
+		}
+
+		last := len(result) - 1
+		changed := last >= 0 && (result[last].File != entry.File || result[last].Line != entry.Line || result[last].Column != entry.Column)
+
+		// instructions at the start that have no source need no entry
+		if changed || (last < 0 && entry.Line > 0) {
+			result = append(result, entry)
+		}
+
+		offset += instruction.GetSize()
+	}
+
+	return result
+}
+
+// CreateDebugInfo records the line tables of the code and of the functions in the pool
+func CreateDebugInfo(files []string, instructions InstructionSet, pool ConstantPool) DebugInfo {
+	result := DebugInfo{
+		Files: files,
+		Lines: CreateLineTable(instructions),
+	}
+
+	for index, constant := range pool.Values {
+		if constant == nil {
+			break
+		}
+
+		if fun, ok := constant.(FunctionObject); ok {
+			if result.Functions == nil {
+				result.Functions = map[int]FunctionDebugInfo{}
+			}
+
+			result.Functions[index] = FunctionDebugInfo{Name: fun.Name, Lines: CreateLineTable(fun.Value), Locals: fun.Locals}
+		}
+	}
+
+	return result
+}
+
+// Lookup finds the source of the instruction at a byte offset
+func (t LineTable) Lookup(offset int) (errors.Location, bool) {
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].Offset > offset
+	}) - 1
+
+	if i < 0 || t[i].Line == 0 {
+		return errors.Location{}, false
+	}
+
+	return errors.Location{
+		File:  t[i].File,
+		Start: errors.Position{Line: t[i].Line, Column: t[i].Column},
+	}, true
+}
+
+// Offsets finds the byte offsets where the code of a line starts, a line may
+// start more than once when its code is interleaved with the code of others
+func (t LineTable) Offsets(file string, line int) []int {
+	result := []int{}
+
+	for i, entry := range t {
+		if entry.File != file || entry.Line != line {
+			continue
+		}
+
+		if i > 0 && t[i-1].File == file && t[i-1].Line == line {
+			continue
+		}
+
+		result = append(result, entry.Offset)
+	}
+
+	return result
+}
+
+// sets the locations of instructions that are read from a module
+func (t LineTable) restore(instructions InstructionSet) {
+	offset := 0
+
+	for i := range instructions {
+		if location, ok := t.Lookup(offset); ok {
+			instructions[i].Location = location
+		}
+
+		offset += instructions[i].GetSize()
+	}
+}
@@ -0,0 +1,53 @@
+package common_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/common"
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+func at(instruction common.Instruction, line int, column int) common.Instruction {
+	instruction.Location = errors.Location{File: "main.mb", Start: errors.Position{Line: line, Column: column}}
+	return instruction
+}
+
+func TestLineTable(t *testing.T) {
+	instructions := common.InstructionSet{
+		common.NewInstruction(common.OpNoop),
+		at(common.NewInstruction(common.OpConstant, 0), 3, 5),
+		at(common.NewInstruction(common.OpConstant, 1), 3, 5),
+		at(common.NewInstruction(common.OpAdd), 4, 3),
+		common.NewInstruction(common.OpPop),
+		at(common.NewInstruction(common.OpReturn), 3, 1),
+	}
+
+	table := common.CreateLineTable(instructions)
+	expected := common.LineTable{
+		{Offset: 1, File: "main.mb", Line: 3, Column: 5},
+		{Offset: 7, File: "main.mb", Line: 4, Column: 3},
+		{Offset: 8},
+		{Offset: 9, File: "main.mb", Line: 3, Column: 1},
+	}
+
+	if !reflect.DeepEqual(table, expected) {
+		t.Fatalf("expected line table to be %+v but got %+v", expected, table)
+	}
+
+	for offset, line := range map[int]int{0: 0, 1: 3, 4: 3, 7: 4, 8: 0, 9: 3, 20: 3} {
+		location, ok := table.Lookup(offset)
+
+		if ok != (line > 0) || location.Start.Line != line {
+			t.Errorf("expected offset %d to be at line %d but got %d", offset, line, location.Start.Line)
+		}
+	}
+
+	if offsets := table.Offsets("main.mb", 3); !reflect.DeepEqual(offsets, []int{1, 9}) {
+		t.Errorf("expected line 3 to start at offsets 1 and 9 but got %v", offsets)
+	}
+
+	if offsets := table.Offsets("other.mb", 3); len(offsets) != 0 {
+		t.Errorf("expected no offsets in other.mb but got %v", offsets)
+	}
+}
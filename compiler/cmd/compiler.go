@@ -14,6 +14,11 @@ func (c *package_compiler) enter_scope() {
 	c.SymbolTable = scoped_table
 }
 
+func (c *package_compiler) enter_block_scope() {
+	scoped_table := NewBlockSymbolTable(c.SymbolTable)
+	c.SymbolTable = scoped_table
+}
+
 func (c *package_compiler) leave_scope() {
 	c.SymbolTable = c.SymbolTable.Outer
 }
@@ -90,7 +95,18 @@ func (c *package_compiler) resolve_path(expression parser.Expression) (common.In
 	}
 }
 
+// instructions are located at the innermost expression or statement they are compiled from
 func (c *package_compiler) compile_statement(statement parser.Statement) (common.InstructionSet, errors.Error) {
+	count := len(c.SymbolTable.Locals())
+
+	result, err := c.compile_statement_kind(statement)
+	result.Locate(statement.Location())
+	c.SymbolTable.locate(count, statement.Location())
+
+	return result, err
+}
+
+func (c *package_compiler) compile_statement_kind(statement parser.Statement) (common.InstructionSet, errors.Error) {
 	switch statement.Kind() {
 	case parser.ExpressionStatementKind:
 		return c.compile_expression(statement.(parser.ExpressionStatement).Expression, true)
@@ -135,7 +151,7 @@ func (c *package_compiler) compile_declaration_statement(statement parser.Declar
 		}
 		result = append(result, value...)
 	} else {
-		value_literal := c.Typechecker.GetDefault(*statement.Type)
+		value_literal := c.Typechecker.Default(*statement.Type)
 		index := c.ConstantPool.Add(value_literal)
 		result = append(result, common.NewInstruction(common.OpConstant, index))
 	}
@@ -179,9 +195,12 @@ func (c *package_compiler) compile_assignment_statement(statement parser.Assignm
 
 	var left_getter common.Op
 
-	if symbol.Scope == GlobalScope {
+	switch symbol.Scope {
+	case GlobalScope:
 		left_getter = common.OpGet
-	} else {
+	case FreeScope:
+		left_getter = common.OpGetFree
+	default:
 		left_getter = common.OpGetLocal
 	}
 
@@ -212,9 +231,12 @@ func (c *package_compiler) compile_assignment_statement(statement parser.Assignm
 			result = append(result, common.NewInstruction(common.OpMod))
 		}
 
-		if symbol.Scope == GlobalScope {
+		switch symbol.Scope {
+		case GlobalScope:
 			result = append(result, common.NewInstruction(common.OpAssign, symbol.Index))
-		} else {
+		case FreeScope:
+			result = append(result, common.NewInstruction(common.OpSetFree, symbol.Index))
+		default:
 			result = append(result, common.NewInstruction(common.OpAssignLocal, symbol.Index))
 		}
 	case parser.MemberExpressionKind, parser.IndexExpressionKind:
@@ -249,17 +271,57 @@ func (c *package_compiler) compile_assignment_statement(statement parser.Assignm
 			return result, err
 		}
 
+		// the root of the path is the symbol itself, only the keys after it are pushed
+		root, _, err := c.resolve_path(parser.IdentifierExpression{Value: symbol.Name})
+
+		if err.Exists {
+			return result, err
+		}
+
 		size--
-		path = path[1:]
+		path = path[len(root):]
+
+		scope := 0
+
+		switch symbol.Scope {
+		case LocalScope:
+			scope = 1
+		case FreeScope:
+			scope = 2
+		}
 
 		result = append(result, path...)
-		result = append(result, common.NewInstruction(common.OpSetItem, symbol.Index, size))
+		result = append(result, common.NewInstruction(common.OpSetItem, symbol.Index, size, scope))
 	}
 
 	return result, errors.EmptyError
 }
 
-func (c *package_compiler) compile_fun_body(signature parser.FunctionSignature, body parser.StatementList) (common.InstructionSet, errors.Error) {
+// compiles a block of statements, an error in a statement is added to the diagnostics
+// and the statements after it are still compiled so that all errors are found at once
+func (c *package_compiler) compile_statements(body parser.StatementList, allow_defer bool) common.InstructionSet {
+	result := common.InstructionSet{}
+
+	for _, sub_statement := range body {
+		if !allow_defer && sub_statement.Kind() == parser.DeferStatementKind {
+			c.Diagnostics.Add(errors.CreateCompileError(errors.ErrorMessages["u_def"], sub_statement.Location()))
+			continue
+		}
+
+		instructions, err := c.compile_statement(sub_statement)
+		if err.Exists {
+			c.Diagnostics.Add(err)
+			continue
+		}
+
+		result = append(result, instructions...)
+	}
+
+	return result
+}
+
+// compiles a function along with the variables it captures from the functions it is in
+func (c *package_compiler) compile_fun_body(name string, signature parser.FunctionSignature, body parser.StatementList) (common.FunctionObject, []Symbol, errors.Error) {
 	fun_instructions := common.InstructionSet{}
 
 	c.enter_scope()
@@ -272,52 +334,65 @@ func (c *package_compiler) compile_fun_body(signature parser.FunctionSignature,
 		c.SymbolTable.Define(parameter.Name.Value, parser.ConstantKind, false)
 	}
 
-	for _, sub_statement := range body {
-		instructions, err := c.compile_statement(sub_statement)
-		if err.Exists {
-			return fun_instructions, err
-		}
-
-		fun_instructions = append(fun_instructions, instructions...)
-	}
-
-	for i, instruction := range fun_instructions {
-		if instruction.Op == common.OpDefer {
-			// slice the deferred part, remove the defer op and rearrange the body
-			deferred := fun_instructions[i+1 : int(instruction.Operands[0])-1]
-			head := fun_instructions[:i]
-			tail := fun_instructions[int(instruction.Operands[0])-1:]
+	fun_instructions = append(fun_instructions, c.compile_statements(body, true)...)
 
-			fun_instructions = common.InstructionSet{}
-			fun_instructions = append(fun_instructions, head...)
-			fun_instructions = append(fun_instructions, tail...)
-			fun_instructions = append(fun_instructions, deferred...)
-		}
+	// parameters have no location, they are visible from the start of the function
+	locals := []common.Local{}
+	for _, symbol := range c.SymbolTable.Locals() {
+		locals = append(locals, common.Local{
+			Name:   symbol.Name,
+			Index:  symbol.Index,
+			Line:   symbol.Location.Start.Line,
+			Column: symbol.Location.Start.Column,
+		})
 	}
 
+	free := c.SymbolTable.FreeSymbols
 	c.leave_scope()
 
-	return fun_instructions, errors.EmptyError
+	return common.FunctionObject{
+		Value:  c.optimize(fun_instructions),
+		Name:   name,
+		Locals: locals,
+	}, free, errors.EmptyError
 }
 
-func (c *package_compiler) compile_unbound_fun_definition_statement(statement parser.UnboundFunDefinitionStatement) (common.InstructionSet, errors.Error) {
+// pushes a function, functions that capture variables are pushed as closures that share
+// the variables with the functions they are in
+func (c *package_compiler) compile_closure(value common.FunctionObject, free []Symbol) common.InstructionSet {
 	result := common.InstructionSet{}
+	index := c.ConstantPool.Add(value)
 
-	fun_instructions, err := c.compile_fun_body(statement.Signature, statement.Body)
-	if err.Exists {
-		return result, err
+	if len(free) == 0 {
+		return append(result, common.NewInstruction(common.OpConstant, index))
 	}
-	value := common.FunctionObject{
-		Value: fun_instructions,
+
+	for _, symbol := range free {
+		if symbol.Scope == FreeScope {
+			result = append(result, common.NewInstruction(common.OpCapture, symbol.Index, 1))
+		} else {
+			result = append(result, common.NewInstruction(common.OpCapture, symbol.Index, 0))
+		}
 	}
-	index := c.ConstantPool.Add(value)
-	result = append(result, common.NewInstruction(common.OpConstant, index))
 
+	return append(result, common.NewInstruction(common.OpClosure, index, len(free)))
+}
+
+func (c *package_compiler) compile_unbound_fun_definition_statement(statement parser.UnboundFunDefinitionStatement) (common.InstructionSet, errors.Error) {
+	result := common.InstructionSet{}
+
+	// the function is defined before its body so that it can call itself
 	symbol, d_err := c.SymbolTable.Define(statement.Signature.Name.Value, parser.ConstantKind, statement.Hidden)
 	if d_err != nil {
 		return result, errors.CreateCompileError(d_err.Error(), statement.Signature.Name.Location())
 	}
 
+	value, free, err := c.compile_fun_body(statement.Signature.Name.Value, statement.Signature, statement.Body)
+	if err.Exists {
+		return result, err
+	}
+	result = append(result, c.compile_closure(value, free)...)
+
 	if symbol.Scope == GlobalScope {
 		result = append(result, common.NewInstruction(common.OpSet, symbol.Index))
 	} else {
@@ -337,23 +412,22 @@ func (c *package_compiler) compile_bound_fun_definition_statement(statement pars
 		return result, errors.CreateCompileError(fmt.Sprintf("type '%s' is not defined", for_), statement.Signature.For.Location())
 	}
 
-	fun_instructions, err := c.compile_fun_body(statement.Signature, statement.Body)
+	value, free, err := c.compile_fun_body(for_+"."+statement.Signature.Name.Value, statement.Signature, statement.Body)
 	if err.Exists {
 		return result, err
 	}
-	value := common.FunctionObject{
-		Value: fun_instructions,
-	}
-	index := c.ConstantPool.Add(value)
-	result = append(result, common.NewInstruction(common.OpConstant, index))
+	result = append(result, c.compile_closure(value, free)...)
 
-	name := fmt.Sprintf("%s.%s.%s", c.package_name, for_, statement.Signature.Name.Value)
-	symbol, d_err := symbol_table.Define(name, parser.ConstantKind, statement.Hidden)
+	// the table of the type only keeps the names of its methods, the vm binds the methods
+	// to the instances of the type
+	_, d_err := symbol_table.Define(statement.Signature.Name.Value, parser.ConstantKind, statement.Hidden)
 	if d_err != nil {
 		return result, errors.CreateCompileError(d_err.Error(), statement.Signature.Name.Location())
 	}
 
-	result = append(result, common.NewInstruction(common.OpSet, symbol.Index))
+	type_name := c.ConstantPool.Add(common.StringObject{Value: c.type_name(statement.Signature.For.Name)})
+	method_name := c.ConstantPool.Add(common.StringObject{Value: statement.Signature.Name.Value})
+	result = append(result, common.NewInstruction(common.OpMethod, type_name, method_name))
 
 	return result, errors.EmptyError
 }
@@ -438,6 +512,15 @@ func (c *package_compiler) compile_yield_statement(statement parser.YieldStateme
 
 func (c *package_compiler) compile_if_statement(statement parser.IfStatement) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
+
+	pruned, tested := prune_if_statement(statement)
+	if !tested {
+		// the main block does not allow defers even when it is always taken
+		taken, _ := fold_bool(statement.MainBlock.Predicate)
+		return c.compile_statements(pruned.ElseBlock, !taken), errors.EmptyError
+	}
+
+	statement = pruned
 	template := common.NewInstruction(common.OpJump, 0, 0)
 
 	main_predicate, err := c.compile_expression(statement.MainBlock.Predicate, false)
@@ -447,44 +530,32 @@ func (c *package_compiler) compile_if_statement(statement parser.IfStatement) (c
 
 	result = append(result, main_predicate...)
 
-	main_block := common.InstructionSet{}
-	for _, sub_statement := range statement.MainBlock.Body {
-		if sub_statement.Kind() == parser.DeferStatementKind {
-			return result, errors.CreateCompileError(errors.ErrorMessages["u_def"], sub_statement.Location())
-		}
-		instructions, err := c.compile_statement(sub_statement)
-		if err.Exists {
-			return result, err
-		}
+	main_block := c.compile_statements(statement.MainBlock.Body, false)
+	else_block := c.compile_statements(statement.ElseBlock, true)
 
-		main_block = append(main_block, instructions...)
-	}
+	// blocks that are followed by other blocks also skip the jump that leads out of them
+	has_else := else_block.GetSize() > 0
 
-	result = append(result, common.NewInstruction(common.OpJumpIfFalse, main_block.GetSize()+template.GetSize(), 0))
+	if len(statement.ElseIfBlocks) > 0 || has_else {
+		result = append(result, common.NewInstruction(common.OpJumpIfFalse, main_block.GetSize()+template.GetSize(), 0))
+	} else {
+		result = append(result, common.NewInstruction(common.OpJumpIfFalse, main_block.GetSize(), 0))
+	}
 	result = append(result, main_block...)
 
 	for i, block := range statement.ElseIfBlocks {
-		else_if_instructions := common.InstructionSet{}
-
 		else_if_predicate, err := c.compile_expression(block.Predicate, false)
 		if err.Exists {
 			return result, err
 		}
 
-		for _, sub_statement := range block.Body {
-			instructions, err := c.compile_statement(sub_statement)
-			if err.Exists {
-				return result, err
-			}
-
-			else_if_instructions = append(else_if_instructions, instructions...)
-		}
+		else_if_instructions := c.compile_statements(block.Body, true)
 
 		jump_count := else_if_instructions.GetSize() + else_if_predicate.GetSize() + template.GetSize()
 
 		result = append(result, common.NewInstruction(common.OpJump, jump_count, 0))
 		result = append(result, else_if_predicate...)
-		if i == len(statement.ElseIfBlocks)-1 {
+		if i == len(statement.ElseIfBlocks)-1 && !has_else {
 			result = append(result, common.NewInstruction(common.OpJumpIfFalse, else_if_instructions.GetSize(), 0))
 		} else {
 			result = append(result, common.NewInstruction(common.OpJumpIfFalse, else_if_instructions.GetSize()+template.GetSize(), 0))
@@ -492,17 +563,7 @@ func (c *package_compiler) compile_if_statement(statement parser.IfStatement) (c
 		result = append(result, else_if_instructions...)
 	}
 
-	else_block := common.InstructionSet{}
-	for _, sub_statement := range statement.ElseBlock {
-		instructions, err := c.compile_statement(sub_statement)
-		if err.Exists {
-			return result, err
-		}
-
-		else_block = append(else_block, instructions...)
-	}
-
-	if else_block.GetSize() > 0 {
+	if has_else {
 		result = append(result, common.NewInstruction(common.OpJump, else_block.GetSize(), 0))
 		result = append(result, else_block...)
 	}
@@ -516,27 +577,22 @@ func (c *package_compiler) compile_loop_statement(statement parser.LoopStatement
 		return c.compile_unipartite_loop_statement(statement)
 	case parser.TripartiteLoopKind:
 		return c.compile_tripartite_loop_statement(statement)
+	case parser.BipartiteLoopKind:
+		return c.compile_bipartite_loop_statement(statement)
 	default:
 		return common.InstructionSet{}, errors.CreateCompileError(fmt.Sprintf("unknown loop predicate kind %s", statement.Predicate.LoopKind()), statement.Location())
 	}
 }
 
-func (c *package_compiler) compile_loop_body(body parser.StatementList) (common.InstructionSet, errors.Error) {
-	result := common.InstructionSet{}
-
-	c.enter_scope()
-	for _, sub_statement := range body {
-		if sub_statement.Kind() == parser.DeferStatementKind {
-			return result, errors.CreateCompileError(errors.ErrorMessages["u_def"], sub_statement.Location())
-		}
-		instructions, err := c.compile_statement(sub_statement)
-		if err.Exists {
-			return result, err
-		}
-		result = append(result, instructions...)
-	}
+func (c *package_compiler) compile_loop_body(body parser.StatementList, procedure common.InstructionSet) (common.InstructionSet, errors.Error) {
+	c.enter_block_scope()
+	result := c.compile_statements(body, false)
 	c.leave_scope()
 
+	// procedure runs at the end of every iteration, continue statements jump to it
+	body_size := result.GetSize()
+	result = append(result, procedure...)
+
 	for i, instruction := range result {
 		if instruction.Op == common.OpBreak {
 			/* calculate the instruction size after the break and add
@@ -558,7 +614,7 @@ func (c *package_compiler) compile_loop_body(body parser.StatementList) (common.
 				current_position += result[j].GetSize()
 			}
 
-			result[i] = common.NewInstruction(common.OpJump, result.GetSize()-current_position, 0)
+			result[i] = common.NewInstruction(common.OpJump, body_size-current_position, 0)
 		}
 	}
 
@@ -569,7 +625,7 @@ func (c *package_compiler) compile_unipartite_loop_statement(statement parser.Lo
 	result := common.InstructionSet{}
 	template := common.NewInstruction(common.OpJump, 0, 0)
 
-	body, err := c.compile_loop_body(statement.Body)
+	body, err := c.compile_loop_body(statement.Body, common.InstructionSet{})
 	if err.Exists {
 		return result, err
 	}
@@ -596,29 +652,61 @@ func (c *package_compiler) compile_tripartite_loop_statement(statement parser.Lo
 	template := common.NewInstruction(common.OpJump, 0, 0)
 
 	body := common.InstructionSet{}
+	loop_predicate := statement.Predicate.(parser.TripartiteLoopPredicate)
 
-	c.enter_scope()
+	c.enter_block_scope()
+	defer c.leave_scope()
 
-	declaration, err := c.compile_statement(*statement.Predicate.(parser.TripartiteLoopPredicate).Declaration)
-	if err.Exists {
-		return result, err
+	if loop_predicate.Declaration != nil {
+		declaration, err := c.compile_statement(*loop_predicate.Declaration)
+		if err.Exists {
+			return result, err
+		}
+		result = append(result, declaration...)
 	}
-	result = append(result, declaration...)
 
-	predicate, err := c.compile_expression(statement.Predicate.(parser.TripartiteLoopPredicate).Predicate, false)
+	predicate, err := c.compile_expression(loop_predicate.Predicate, false)
 	if err.Exists {
 		return result, err
 	}
 	result = append(result, predicate...)
 
-	instructions, err := c.compile_loop_body(statement.Body)
+	procedure := common.InstructionSet{}
+
+	// every iteration gets its own copy of the variable the loop declares before the
+	// procedure changes it, so closures keep the value of the iteration they are made in
+	if loop_predicate.Declaration != nil {
+		symbol := c.SymbolTable.Resolve(loop_predicate.Declaration.Name.Value)
+
+		if symbol != nil && symbol.Scope == LocalScope {
+			procedure = append(procedure,
+				common.NewInstruction(common.OpGetLocal, symbol.Index),
+				common.NewInstruction(common.OpSetLocal, symbol.Index),
+			)
+
+			// the copy belongs to the procedure, or to the declaration if there is none
+			if loop_predicate.Procedure != nil {
+				procedure.Locate((*loop_predicate.Procedure).Location())
+			} else {
+				procedure.Locate(loop_predicate.Declaration.Name.Location())
+			}
+		}
+	}
+
+	if loop_predicate.Procedure != nil {
+		instructions, err := c.compile_expression(*loop_predicate.Procedure, true)
+		if err.Exists {
+			return result, err
+		}
+		procedure = append(procedure, instructions...)
+	}
+
+	instructions, err := c.compile_loop_body(statement.Body, procedure)
 	if err.Exists {
 		return result, err
 	}
 	body = append(body, instructions...)
 
-	c.leave_scope()
-
 	result = append(result, common.NewInstruction(common.OpJumpIfFalse, body.GetSize()+template.GetSize(), 0))
 	result = append(result, body...)
 	result = append(result, common.NewInstruction(common.OpJump, body.GetSize()+template.GetSize()+predicate.GetSize(), 1))
@@ -626,6 +714,102 @@ func (c *package_compiler) compile_tripartite_loop_statement(statement parser.Lo
 	return result, errors.EmptyError
 }
 
+/*
+for-of loops call the next method of the iterator until its result is done, lists, maps and
+strings are turned into iterators of their entries first. The key is the key of the result
+when it has one and the index of the value otherwise. They are compiled as the tripartite loop
+
+	var #iterator = #iterate(iterator)
+	for (var #index = 0; true; #index++) {
+		var #next = #iterator.next()
+		if (#next.is_done) { break }
+		var key = #next.key
+		if (key == #null) { key = #index }
+		var value = #next.value
+		...
+	}
+*/
+func (c *package_compiler) compile_bipartite_loop_statement(statement parser.LoopStatement) (common.InstructionSet, errors.Error) {
+	loop_predicate := statement.Predicate.(parser.BipartiteLoopPredicate)
+
+	iterator := parser.IdentifierExpression{Value: "#iterator"}
+	index := parser.IdentifierExpression{Value: "#index"}
+	next := parser.IdentifierExpression{Value: "#next"}
+
+	declare := func(name parser.IdentifierExpression, value parser.Expression) parser.DeclarationStatement {
+		return parser.DeclarationStatement{VarKind: parser.VariableKind, Name: name, Value: &value}
+	}
+
+	body := parser.StatementList{
+		declare(next, parser.CallExpression{
+			Callee:    parser.MemberExpression{LeftHandSide: iterator, RightHandSide: parser.IdentifierExpression{Value: "next"}},
+			Arguments: []parser.Expression{},
+		}),
+		parser.IfStatement{
+			MainBlock: parser.PredicateBlock{
+				Predicate: parser.MemberExpression{LeftHandSide: next, RightHandSide: parser.IdentifierExpression{Value: "is_done"}},
+				Body:      parser.StatementList{parser.BreakStatement{}},
+			},
+		},
+	}
+
+	if loop_predicate.Key != nil {
+		key := *loop_predicate.Key
+
+		body = append(body,
+			declare(key, parser.MemberExpression{LeftHandSide: next, RightHandSide: parser.IdentifierExpression{Value: "key"}}),
+			parser.IfStatement{
+				MainBlock: parser.PredicateBlock{
+					Predicate: parser.ComparisonExpression{
+						LeftHandSide:  key,
+						RightHandSide: parser.IdentifierExpression{Value: "#null"},
+						Operator:      parser.OperatorToken{Literal: "=="},
+					},
+					Body: parser.StatementList{parser.AssignmentStatement{
+						LeftHandSide:  key,
+						RightHandSide: index,
+						Operator:      parser.OperatorToken{Literal: "="},
+					}},
+				},
+			},
+		)
+	}
+
+	if loop_predicate.Value != nil {
+		body = append(body, declare(*loop_predicate.Value, parser.MemberExpression{LeftHandSide: next, RightHandSide: parser.IdentifierExpression{Value: "value"}}))
+	}
+
+	body = append(body, statement.Body...)
+
+	c.enter_block_scope()
+	defer c.leave_scope()
+
+	result, err := c.compile_statement(declare(iterator, parser.CallExpression{
+		Callee:    parser.IdentifierExpression{Value: "#iterate"},
+		Arguments: []parser.Expression{loop_predicate.Iterator},
+	}))
+	if err.Exists {
+		return result, err
+	}
+
+	declaration := declare(index, parser.NumberLiteralExpression{Value: parser.NumberLiteral{Value: 0}})
+	var procedure parser.Expression = parser.ArithmeticUnaryExpression{Expression: index, Operation: parser.IncrementKind}
+
+	loop, err := c.compile_tripartite_loop_statement(parser.LoopStatement{
+		Predicate: parser.TripartiteLoopPredicate{
+			Declaration: &declaration,
+			Predicate:   parser.BoolLiteralExpression{Value: true},
+			Procedure:   &procedure,
+		},
+		Body: body,
+	})
+	if err.Exists {
+		return result, err
+	}
+
+	return append(result, loop...), errors.EmptyError
+}
+
 func (c *package_compiler) compile_expression(expression parser.Expression, should_clean bool) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 	err := errors.EmptyError
@@ -691,6 +875,8 @@ func (c *package_compiler) compile_expression(expression parser.Expression, shou
 		result = append(result, common.NewInstruction(common.OpPop))
 	}
 
+	result.Locate(expression.Location())
+
 	return result, err
 }
 
@@ -700,10 +886,19 @@ func (c *package_compiler) compile_literal_expression(expression parser.LiteralE
 
 	switch expression.LiteralKind() {
 	case parser.NumberLiteralKind:
-		value := expression.(parser.NumberLiteralExpression).Value.Value.(int)
-		index := c.ConstantPool.Add(common.Int32Object{
-			Value: int32(value),
-		})
+		// float literals are Float32 values like the type they are inferred with
+		index := 0
+
+		switch value := expression.(parser.NumberLiteralExpression).Value.Value.(type) {
+		case float64:
+			index = c.ConstantPool.Add(common.Float32Object{
+				Value: float32(value),
+			})
+		default:
+			index = c.ConstantPool.Add(common.Int32Object{
+				Value: int32(value.(int)),
+			})
+		}
 
 		result = append(result, common.NewInstruction(common.OpConstant, index))
 	case parser.StringLiteralKind:
@@ -717,7 +912,7 @@ func (c *package_compiler) compile_literal_expression(expression parser.LiteralE
 			result = append(result, instructions...)
 		}
 
-		result = append(result, common.NewInstruction(common.OpArray, len([]rune(list.Value))))
+		result = append(result, common.NewInstruction(common.OpString, len([]rune(list.Value))))
 	case parser.RuneLiteralKind:
 		value := expression.(parser.RuneLiteralExpression).Value
 		index := c.ConstantPool.Add(common.Int32Object{
@@ -776,24 +971,37 @@ func (c *package_compiler) compile_literal_expression(expression parser.LiteralE
 			}
 			result = append(result, value...)
 		}
-		result = append(result, common.NewInstruction(common.OpMap, len(instance.Value)))
+		type_name := c.ConstantPool.Add(common.StringObject{Value: c.type_name(instance.Type.Name)})
+		result = append(result, common.NewInstruction(common.OpInstance, len(instance.Value), type_name))
 	}
 
 	return result, err
 }
 
+// the qualified name of a type that instances are created with and methods are bound to,
+// types of other packages are named by the name they are used with
+func (c *package_compiler) type_name(name parser.Expression) string {
+	if identifier, ok := name.(parser.IdentifierExpression); ok {
+		return fmt.Sprintf("%s.%s", c.package_name, identifier.Value)
+	}
+
+	if member, ok := name.(parser.MemberExpression); ok {
+		if left, ok := member.LeftHandSide.(parser.IdentifierExpression); ok {
+			return fmt.Sprintf("%s.%s", left.Value, member.RightHandSide.Value)
+		}
+	}
+
+	return ""
+}
+
 func (c *package_compiler) compile_fun_expression(expression parser.AnonymousFunExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
-	fun_instructions, err := c.compile_fun_body(expression.Signature, expression.Body)
+	value, free, err := c.compile_fun_body("<anonymous>", expression.Signature, expression.Body)
 	if err.Exists {
 		return result, err
 	}
-	value := common.FunctionObject{
-		Value: fun_instructions,
-	}
-	index := c.ConstantPool.Add(value)
-	result = append(result, common.NewInstruction(common.OpConstant, index))
+	result = append(result, c.compile_closure(value, free)...)
 
 	return result, errors.EmptyError
 }
@@ -801,6 +1009,10 @@ func (c *package_compiler) compile_fun_expression(expression parser.AnonymousFun
 func (c *package_compiler) compile_arithmetic_expression(expression parser.ArithmeticExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
+	if value, ok := fold(expression); ok {
+		return c.compile_constant(value), errors.EmptyError
+	}
+
 	left, err := c.compile_expression(expression.LeftHandSide, false)
 	if err.Exists {
 		return result, err
@@ -873,6 +1085,10 @@ func (c *package_compiler) compile_arithmetic_unary_expression(expression parser
 func (c *package_compiler) compile_not_expression(expression parser.NotExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
+	if value, ok := fold(expression); ok {
+		return c.compile_constant(value), errors.EmptyError
+	}
+
 	instructions, err := c.compile_expression(expression.Expression, false)
 	if err.Exists {
 		return result, err
@@ -885,9 +1101,18 @@ func (c *package_compiler) compile_not_expression(expression parser.NotExpressio
 }
 
 func (c *package_compiler) compile_giveup_expression(expression parser.GiveupExpression) (common.InstructionSet, errors.Error) {
-	result := common.InstructionSet{}
+	// the warning that was last raised is reported, there is none outside of functions
+	name := "#null"
+	if c.SymbolTable.Resolve("#warning") != nil {
+		name = "#warning"
+	}
 
-	result = append(result, common.NewInstruction(common.OpExit, 1))
+	result, err := c.compile_identifier_expression(parser.IdentifierExpression{Value: name})
+	if err.Exists {
+		return result, err
+	}
+
+	result = append(result, common.NewInstruction(common.OpGiveup))
 
 	return result, errors.EmptyError
 }
@@ -895,6 +1120,10 @@ func (c *package_compiler) compile_giveup_expression(expression parser.GiveupExp
 func (c *package_compiler) compile_comparison_expression(expression parser.ComparisonExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
+	if value, ok := fold(expression); ok {
+		return c.compile_constant(value), errors.EmptyError
+	}
+
 	left, err := c.compile_expression(expression.LeftHandSide, false)
 	if err.Exists {
 		return result, err
@@ -929,6 +1158,10 @@ func (c *package_compiler) compile_comparison_expression(expression parser.Compa
 func (c *package_compiler) compile_binary_expression(expression parser.BinaryExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
+	if value, ok := fold(expression); ok {
+		return c.compile_constant(value), errors.EmptyError
+	}
+
 	left, err := c.compile_expression(expression.LeftHandSide, false)
 	if err.Exists {
 		return result, err
@@ -963,7 +1196,13 @@ func (c *package_compiler) compile_identifier_expression(expression parser.Ident
 	if symbol.Scope == GlobalScope {
 		result = append(result, common.NewInstruction(common.OpGet, symbol.Index))
 	} else if symbol.Scope == BuiltinScope {
+		if err := c.check_denied(symbol.Name, expression.Location()); err.Exists {
+			return result, err
+		}
+
 		result = append(result, common.NewInstruction(common.OpGetBuiltin, symbol.Index))
+	} else if symbol.Scope == FreeScope {
+		result = append(result, common.NewInstruction(common.OpGetFree, symbol.Index))
 	} else {
 		result = append(result, common.NewInstruction(common.OpGetLocal, symbol.Index))
 	}
@@ -994,6 +1233,24 @@ func (c *package_compiler) compile_index_expression(expression parser.IndexExpre
 func (c *package_compiler) compile_member_expression(expression parser.MemberExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
+	// members of builtin maps are builtins of their own
+	if name, root, ok := builtin_path(expression); ok {
+		if symbol := c.SymbolTable.Resolve(root); symbol != nil && symbol.Scope == BuiltinScope {
+			member := c.SymbolTable.Resolve(name)
+
+			if member == nil || member.Scope != BuiltinScope {
+				return result, errors.CreateCompileError(fmt.Sprintf("builtin '%s' is not defined", name), expression.Location())
+			}
+
+			if err := c.check_denied(name, expression.Location()); err.Exists {
+				return result, err
+			}
+
+			result = append(result, common.NewInstruction(common.OpGetBuiltin, member.Index))
+			return result, errors.EmptyError
+		}
+	}
+
 	left, err := c.compile_expression(expression.LeftHandSide, false)
 	if err.Exists {
 		return result, err
@@ -1011,6 +1268,34 @@ func (c *package_compiler) compile_member_expression(expression parser.MemberExp
 	return result, errors.EmptyError
 }
 
+func (c *package_compiler) check_denied(name string, location errors.Location) errors.Error {
+	if capability, ok := c.denied[name]; ok {
+		return errors.CreateCompileError(fmt.Sprintf("builtin '%s' is denied, it needs the %s capability", name, capability), location)
+	}
+
+	return errors.EmptyError
+}
+
+// the path of a member expression made of identifiers, such as syscall.write, and the identifier it starts with
+func builtin_path(expression parser.Expression) (string, string, bool) {
+	switch expression.Kind() {
+	case parser.IdentifierExpressionKind:
+		name := expression.(parser.IdentifierExpression).Value
+		return name, name, true
+	case parser.MemberExpressionKind:
+		member := expression.(parser.MemberExpression)
+		host, root, ok := builtin_path(member.LeftHandSide)
+
+		if !ok {
+			return "", "", false
+		}
+
+		return host + "." + member.RightHandSide.Value, root, true
+	default:
+		return "", "", false
+	}
+}
+
 func (c *package_compiler) compile_call_expression(expression parser.CallExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
 
@@ -1048,15 +1333,28 @@ func (c *package_compiler) compile_type_cast_expression(expression parser.TypeCa
 	}
 	result = append(result, instructions...)
 
-	// add type somehow
-	result = append(result, common.NewInstruction(common.OpCast))
+	// only casts to numbers and bools are checked, the others are left to the typechecker
+	if value, ok := c.Typechecker.Primitive(expression.Type); ok {
+		result = append(result, common.NewInstruction(common.OpCast, c.ConstantPool.Add(value)))
+	}
 
 	return result, errors.EmptyError
 }
 
 func (c *package_compiler) compile_this_expression(expression parser.ThisExpression) (common.InstructionSet, errors.Error) {
 	result := common.InstructionSet{}
-	result = append(result, common.NewInstruction(common.OpGetLocal, 0))
+	symbol := c.SymbolTable.Resolve("this")
+
+	if symbol == nil {
+		return result, errors.CreateCompileError("this is only allowed in bound functions", expression.Location())
+	}
+
+	// closures in bound functions capture this like any other local
+	if symbol.Scope == FreeScope {
+		result = append(result, common.NewInstruction(common.OpGetFree, symbol.Index))
+	} else {
+		result = append(result, common.NewInstruction(common.OpGetLocal, symbol.Index))
+	}
 
 	return result, errors.EmptyError
 }
@@ -1183,10 +1481,9 @@ func (c *package_compiler) compile_match_expression(expression parser.MatchExpre
 		constant_template := common.NewInstruction(common.OpConstant, 0)
 		/* the body's jump size is the predicate's jump size +
 		the body's own size. Predicate includes a jump at the
-		end so we will remove that. A jump instruction size is 19 */
+		end so we will remove that. */
 		body_jump_size := predicate_jump_size + block.body.GetSize() - jump_template.GetSize()
-		/* jump the last constant that pushes 0 onto the stack as well.
-		This is a constant instruction that has the size 5 */
+		// jump the last constant that pushes 0 onto the stack as well
 		predicate_jump_size += constant_template.GetSize()
 
 		// replace the jumps
@@ -1211,38 +1508,24 @@ func (c *package_compiler) compile_match_expression(expression parser.MatchExpre
 	return result, err
 }
 
+// corout functions are functions that spawn a coroutine of their body when they are called
 func (c *package_compiler) compile_corout_fun_expression(expression parser.CoroutFunExpression) (common.InstructionSet, errors.Error) {
-	literal := parser.InstanceLiteralExpression{
-		Type: parser.TypeIdentifier{
-			Name:     parser.IdentifierExpression{Value: "Corout"},
-			Generics: map[int]parser.TypeLiteral{},
-		},
-		Value: []parser.KeyValueEntry{
-			{
-				Key:   parser.IdentifierExpression{Value: "fun"},
-				Value: expression.Fun,
-			},
-		},
+	result, err := c.compile_expression(expression.Fun, false)
+	if err.Exists {
+		return result, err
 	}
 
-	return c.compile_literal_expression(literal)
+	return append(result, common.NewInstruction(common.OpCorout)), errors.EmptyError
 }
 
+// gen functions are functions that create a generator of their body when they are called
 func (c *package_compiler) compile_gen_fun_expression(expression parser.GenFunExpression) (common.InstructionSet, errors.Error) {
-	literal := parser.InstanceLiteralExpression{
-		Type: parser.TypeIdentifier{
-			Name:     parser.IdentifierExpression{Value: "Generator"},
-			Generics: map[int]parser.TypeLiteral{},
-		},
-		Value: []parser.KeyValueEntry{
-			{
-				Key:   parser.IdentifierExpression{Value: "fun"},
-				Value: expression.Fun,
-			},
-		},
+	result, err := c.compile_expression(expression.Fun, false)
+	if err.Exists {
+		return result, err
 	}
 
-	return c.compile_literal_expression(literal)
+	return append(result, common.NewInstruction(common.OpGenerator)), errors.EmptyError
 }
 
 func (c *package_compiler) compile_warn_expression(expression parser.WarnExpression) (common.InstructionSet, errors.Error) {
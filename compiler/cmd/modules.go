@@ -11,6 +11,7 @@ import (
 	"github.com/moonbite-org/moonbite/common"
 	errors "github.com/moonbite-org/moonbite/error"
 	parser "github.com/moonbite-org/moonbite/parser/cmd"
+	"github.com/moonbite-org/moonbite/typechecker"
 )
 
 type Compiler struct {
@@ -18,6 +19,12 @@ type Compiler struct {
 	Config  ModConfig
 	Modules map[string]*Module
 	ABI     abi.ABI
+	// every error found while compiling the root module
+	Diagnostics errors.Diagnostics
+	// the files of a package that is not read from disk, keyed by their paths
+	Sources map[string][]byte
+	// keeps the sequences that are otherwise replaced with superinstructions
+	NoSuperinstructions bool
 }
 
 func New(dir string, interface_ abi.ABI) Compiler {
@@ -28,6 +35,17 @@ func New(dir string, interface_ abi.ABI) Compiler {
 	}
 }
 
+// NewFromSources creates a compiler for a package that is kept in memory. The
+// package is compiled as a library, so it does not need a main function and
+// nothing is called when its program runs.
+func NewFromSources(sources map[string][]byte, interface_ abi.ABI) Compiler {
+	return Compiler{
+		Modules: map[string]*Module{},
+		ABI:     interface_,
+		Sources: sources,
+	}
+}
+
 var allowed_extensions = []string{".mb"}
 
 func resolve_dir(dir string, is_root bool, interface_ abi.ABI) (map[string]*Module, error) {
@@ -79,6 +97,10 @@ func resolve_dir(dir string, is_root bool, interface_ abi.ABI) (map[string]*Modu
 }
 
 func (c *Compiler) Compile() errors.Error {
+	if c.Sources != nil {
+		return c.compile_sources()
+	}
+
 	config_path := path.Join(c.RootDir, "moon.yml")
 	_, err := os.Stat(config_path)
 
@@ -100,6 +122,10 @@ func (c *Compiler) Compile() errors.Error {
 		return errors.CreateAnonError(errors.CompileError, err.Error())
 	}
 
+	for _, mod := range modules {
+		mod.NoSuperinstructions = c.NoSuperinstructions
+	}
+
 	c.Modules = modules
 	root := modules["root"]
 
@@ -107,7 +133,35 @@ func (c *Compiler) Compile() errors.Error {
 		return errors.CreateAnonError(errors.CompileError, "no root module found")
 	}
 
-	return root.Compile()
+	result := root.Compile()
+	c.Diagnostics = root.Diagnostics
+
+	return result
+}
+
+func (c *Compiler) compile_sources() errors.Error {
+	root := &Module{
+		ABI:                 c.ABI,
+		Sources:             c.Sources,
+		NoSuperinstructions: c.NoSuperinstructions,
+	}
+
+	for file_path := range c.Sources {
+		root.FilePaths = append(root.FilePaths, file_path)
+	}
+
+	if len(root.FilePaths) == 0 {
+		return errors.CreateAnonError(errors.CompileError, "no sources provided")
+	}
+
+	// files are compiled in the same order on every run
+	slices.Sort(root.FilePaths)
+	c.Modules = map[string]*Module{"root": root}
+
+	result := root.Compile()
+	c.Diagnostics = root.Diagnostics
+
+	return result
 }
 
 type Module struct {
@@ -116,75 +170,126 @@ type Module struct {
 	Dir         string
 	FilePaths   []string
 	IsRoot      bool
-	Compiler    package_compiler
+	// the contents of the files when they are not read from disk
+	Sources             map[string][]byte
+	NoSuperinstructions bool
+	Compiler            package_compiler
+	Diagnostics         errors.Diagnostics
 }
 
+// Compile compiles the files of a module. Syntax errors of every file are collected
+// before giving up, then type errors, then compile errors. All of them are kept in
+// the diagnostics of the module and the first one is returned.
 func (m *Module) Compile() errors.Error {
 	definitions := []parser.Definition{}
+	m.Diagnostics = errors.Diagnostics{}
 
 	for _, file_path := range m.FilePaths {
-		program, err := os.ReadFile(file_path)
+		program, err := m.read(file_path)
 		if err != nil {
 			return errors.CreateAnonError(errors.CompileError, err.Error())
 		}
 
-		ast, p_err := parser.Parse(program, file_path)
-		if p_err.Exists {
-			return p_err
+		ast, diagnostics := parser.ParseAll(program, file_path)
+		m.Diagnostics = append(m.Diagnostics, diagnostics...)
+
+		if ast.Package.Name.Value == "" {
+			continue
 		}
 
 		if len(m.PackageName) == 0 {
 			m.PackageName = ast.Package.Name.Value
-		} else {
-			if m.PackageName != ast.Package.Name.Value {
-				return errors.CreateCompileError(fmt.Sprintf("found multiple packages in this directory '%s', '%s' %s", ast.Package.Name.Value, m.PackageName, m.Dir), ast.Package.Location())
-			}
+		} else if m.PackageName != ast.Package.Name.Value {
+			m.Diagnostics.Add(errors.CreateCompileError(fmt.Sprintf("found multiple packages in this directory '%s', '%s' %s", ast.Package.Name.Value, m.PackageName, m.Dir), ast.Package.Location()))
 		}
 
 		definitions = append(definitions, ast.Definitions...)
 	}
 
-	m.Compiler = new_package_compiler(m.PackageName, definitions, m.IsRoot, m.ABI)
+	if m.Diagnostics.Exists() {
+		return m.Diagnostics.First()
+	}
+
+	checker := typechecker.New()
+	checker.CheckDefinitions(definitions)
+	m.Diagnostics = append(m.Diagnostics, checker.Diagnostics...)
+
+	if m.Diagnostics.Exists() {
+		return m.Diagnostics.First()
+	}
+
+	m.Compiler = new_package_compiler(m.PackageName, definitions, m.FilePaths, m.IsRoot, m.ABI, checker)
+	m.Compiler.no_superinstructions = m.NoSuperinstructions
 
 	if err := m.Compiler.Compile(); err.Exists {
-		return err
+		if !m.Compiler.Diagnostics.Exists() {
+			m.Compiler.Diagnostics.Add(err)
+		}
+
+		m.Diagnostics = append(m.Diagnostics, m.Compiler.Diagnostics...)
+		return m.Diagnostics.First()
 	}
 
 	return errors.EmptyError
 }
 
-var builtins = []string{"exit", "#null"}
+func (m *Module) read(file_path string) ([]byte, error) {
+	if m.Sources != nil {
+		source, ok := m.Sources[file_path]
+		if !ok {
+			return nil, fmt.Errorf("no source is provided for %s", file_path)
+		}
+
+		return source, nil
+	}
+
+	return os.ReadFile(file_path)
+}
 
 type package_compiler struct {
 	package_name         string
 	ABI                  abi.ABI
 	IsRoot               bool
 	Definitions          []parser.Definition
+	FilePaths            []string
 	SymbolTable          *SymbolTable
 	TypeSymbolTable      map[string]*SymbolTable
 	ConstantPool         common.ConstantPool
-	Typechecker          DummyTypeChecker
+	Typechecker          *typechecker.Typechecker
 	Instructions         common.InstructionSet
+	Diagnostics          errors.Diagnostics
 	current_match_target common.InstructionSet
+	// the builtins of the abi that are not granted and the capabilities they need
+	denied               map[string]abi.Capability
+	no_superinstructions bool
 }
 
 func (c *package_compiler) Compile() errors.Error {
-	for _, builtin := range builtins {
+	for _, builtin := range common.Builtins {
 		c.SymbolTable.DefineBuiltin(builtin)
 	}
 
-	for _, builtin := range c.ABI.Builtins {
-		c.SymbolTable.DefineBuiltin(builtin.Name())
+	for _, symbol := range c.ABI.Symbols() {
+		c.SymbolTable.DefineBuiltin(symbol.Name)
+
+		if symbol.Denied != "" {
+			c.denied[symbol.Name] = symbol.Denied
+		}
 	}
 
 	for _, definition := range c.Definitions {
 		instructions, err := c.compile_statement(definition)
 		if err.Exists {
-			return err
+			c.Diagnostics.Add(err)
+			continue
 		}
 		c.Instructions = append(c.Instructions, instructions...)
 	}
 
+	if c.Diagnostics.Exists() {
+		return c.Diagnostics.First()
+	}
+
 	if c.IsRoot {
 		instructions, err := c.compile_call_expression(parser.CallExpression{
 			Callee:    parser.IdentifierExpression{Value: "main"},
@@ -197,28 +302,81 @@ func (c *package_compiler) Compile() errors.Error {
 		c.Instructions = append(c.Instructions, instructions...)
 	}
 
+	c.Instructions = c.optimize(c.Instructions)
+
+	return c.validate()
+}
+
+// operands are encoded with fixed widths, programs that do not fit are rejected here
+func (c *package_compiler) validate() errors.Error {
+	if err := validate(c.Instructions); err.Exists {
+		return err
+	}
+
+	for _, constant := range c.ConstantPool.Values {
+		if fun, ok := constant.(common.FunctionObject); ok {
+			if err := validate(fun.Value); err.Exists {
+				return err
+			}
+		}
+	}
+
 	return errors.EmptyError
 }
 
-func (c package_compiler) GetBytes() []byte {
-	result := []byte{}
-	result = append(result, c.ConstantPool.Serialize()...)
-	result = append(result, c.Instructions.GetBytes()...)
+// reports the first instruction that does not fit at the code it is compiled from
+func validate(instructions common.InstructionSet) errors.Error {
+	for _, instruction := range instructions {
+		if err := instruction.Validate(); err != nil {
+			return errors.CreateCompileError(err.Error(), instruction.Location)
+		}
+	}
 
-	return result
+	return errors.EmptyError
+}
+
+func (c package_compiler) GetModule() common.Module {
+	symbols := []common.ModuleSymbol{}
+
+	for _, symbol := range c.SymbolTable.Symbols() {
+		scope := common.GlobalModuleSymbol
+
+		if symbol.Scope == BuiltinScope {
+			scope = common.BuiltinModuleSymbol
+		}
+
+		symbols = append(symbols, common.ModuleSymbol{
+			Name:  symbol.Name,
+			Scope: scope,
+			Index: symbol.Index,
+		})
+	}
+
+	return common.Module{
+		Version:      common.Config.VersionStamp,
+		ConstantPool: c.ConstantPool,
+		Instructions: c.Instructions,
+		Symbols:      symbols,
+		Debug:        common.CreateDebugInfo(c.FilePaths, c.Instructions, c.ConstantPool),
+	}
+}
+
+func (c package_compiler) GetBytes() []byte {
+	return c.GetModule().Serialize()
 }
 
-func new_package_compiler(package_ string, definitions []parser.Definition, is_root bool, interface_ abi.ABI) package_compiler {
+func new_package_compiler(package_ string, definitions []parser.Definition, file_paths []string, is_root bool, interface_ abi.ABI, checker *typechecker.Typechecker) package_compiler {
 	return package_compiler{
-		package_name:    package_,
-		ABI:             interface_,
-		Definitions:     definitions,
-		SymbolTable:     NewSymbolTable(),
-		TypeSymbolTable: map[string]*SymbolTable{},
-		ConstantPool: common.ConstantPool{
-			Values: [1024]common.Object{},
-		},
+		package_name:         package_,
+		FilePaths:            file_paths,
+		ABI:                  interface_,
+		Definitions:          definitions,
+		SymbolTable:          NewSymbolTable(),
+		TypeSymbolTable:      map[string]*SymbolTable{},
+		Typechecker:          checker,
+		ConstantPool:         common.ConstantPool{},
 		IsRoot:               is_root,
 		current_match_target: nil,
+		denied:               map[string]abi.Capability{},
 	}
 }
@@ -0,0 +1,385 @@
+package cmd
+
+import (
+	"github.com/moonbite-org/moonbite/common"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+)
+
+// evaluates an expression whose operands are all literal numbers or bools, the result
+// is the same as the vm would compute. Expressions that may fail, such as a division
+// by zero, are left to the vm.
+func fold(expression parser.Expression) (common.Object, bool) {
+	switch expression := expression.(type) {
+	case parser.NumberLiteralExpression:
+		value, ok := expression.Value.Value.(int)
+		return common.Int32Object{Value: int32(value)}, ok
+	case parser.RuneLiteralExpression:
+		return common.Int32Object{Value: expression.Value}, true
+	case parser.BoolLiteralExpression:
+		return common.BoolObject{Value: expression.Value}, true
+	case parser.GroupExpression:
+		return fold(expression.Expression)
+	case parser.NotExpression:
+		value, ok := fold_bool(expression.Expression)
+		return common.BoolObject{Value: !value}, ok
+	case parser.ArithmeticExpression:
+		left, left_ok := fold_int(expression.LeftHandSide)
+		right, right_ok := fold_int(expression.RightHandSide)
+
+		if !left_ok || !right_ok {
+			return nil, false
+		}
+
+		// numbers wrap around the same way they do in the vm
+		switch expression.Operator.Literal {
+		case "+":
+			return common.Int32Object{Value: int32(left + right)}, true
+		case "-":
+			return common.Int32Object{Value: int32(left - right)}, true
+		case "*":
+			return common.Int32Object{Value: int32(left * right)}, true
+		case "/":
+			if right == 0 {
+				return nil, false
+			}
+			return common.Int32Object{Value: int32(left / right)}, true
+		case "%":
+			if right == 0 {
+				return nil, false
+			}
+			return common.Int32Object{Value: int32(left % right)}, true
+		}
+	case parser.ComparisonExpression:
+		if left, ok := fold_int(expression.LeftHandSide); ok {
+			right, ok := fold_int(expression.RightHandSide)
+			if !ok {
+				return nil, false
+			}
+
+			switch expression.Operator.Literal {
+			case "<":
+				return common.BoolObject{Value: left < right}, true
+			case "<=":
+				return common.BoolObject{Value: left <= right}, true
+			case ">":
+				return common.BoolObject{Value: left > right}, true
+			case ">=":
+				return common.BoolObject{Value: left >= right}, true
+			case "==":
+				return common.BoolObject{Value: left == right}, true
+			case "!=":
+				return common.BoolObject{Value: left != right}, true
+			}
+		}
+
+		if left, ok := fold_bool(expression.LeftHandSide); ok {
+			right, ok := fold_bool(expression.RightHandSide)
+			if !ok {
+				return nil, false
+			}
+
+			switch expression.Operator.Literal {
+			case "==":
+				return common.BoolObject{Value: left == right}, true
+			case "!=":
+				return common.BoolObject{Value: left != right}, true
+			}
+		}
+	case parser.BinaryExpression:
+		// both sides are always evaluated, so both have to be constant
+		left, left_ok := fold_bool(expression.LeftHandSide)
+		right, right_ok := fold_bool(expression.RightHandSide)
+
+		if !left_ok || !right_ok {
+			return nil, false
+		}
+
+		switch expression.Operator.Literal {
+		case "&&":
+			return common.BoolObject{Value: left && right}, true
+		case "||":
+			return common.BoolObject{Value: left || right}, true
+		}
+	}
+
+	return nil, false
+}
+
+func fold_int(expression parser.Expression) (int64, bool) {
+	value, ok := fold(expression)
+	if !ok {
+		return 0, false
+	}
+
+	number, ok := value.(common.Int32Object)
+	return int64(number.Value), ok
+}
+
+func fold_bool(expression parser.Expression) (bool, bool) {
+	value, ok := fold(expression)
+	if !ok {
+		return false, false
+	}
+
+	boolean, ok := value.(common.BoolObject)
+	return boolean.Value, ok
+}
+
+// the instructions that push a folded value
+func (c *package_compiler) compile_constant(value common.Object) common.InstructionSet {
+	if boolean, ok := value.(common.BoolObject); ok {
+		if boolean.Value {
+			return common.InstructionSet{common.NewInstruction(common.OpTrue)}
+		}
+
+		return common.InstructionSet{common.NewInstruction(common.OpFalse)}
+	}
+
+	return common.InstructionSet{common.NewInstruction(common.OpConstant, c.ConstantPool.Add(value))}
+}
+
+// removes the blocks of an if statement whose predicates are constant, a block that is
+// always taken becomes the else block and the ones after it are dropped. It reports
+// false if no block is left to be tested.
+func prune_if_statement(statement parser.IfStatement) (parser.IfStatement, bool) {
+	blocks := append([]parser.PredicateBlock{statement.MainBlock}, statement.ElseIfBlocks...)
+	result := parser.IfStatement{ElseBlock: statement.ElseBlock}
+	kept := []parser.PredicateBlock{}
+
+	for _, block := range blocks {
+		value, ok := fold_bool(block.Predicate)
+
+		if !ok {
+			kept = append(kept, block)
+			continue
+		}
+
+		if value {
+			result.ElseBlock = block.Body
+			break
+		}
+	}
+
+	if len(kept) == 0 {
+		return result, false
+	}
+
+	result.MainBlock = kept[0]
+	result.ElseIfBlocks = kept[1:]
+
+	return result, true
+}
+
+// a rewritten instruction, origin is the index of the first instruction it replaces and
+// target the index of the instruction its jump lands on
+type rewrite struct {
+	instruction common.Instruction
+	origin      int
+	target      int
+}
+
+// resolves the index of the instruction every jump lands on, -1 for the instructions that
+// are not jumps. It fails if a jump does not land on an instruction.
+func jump_targets(instructions common.InstructionSet) ([]int, bool) {
+	indices := map[int]int{}
+	offset := 0
+
+	for i, instruction := range instructions {
+		indices[offset] = i
+		offset += instruction.GetSize()
+	}
+	indices[offset] = len(instructions)
+
+	result := make([]int, len(instructions))
+	offset = 0
+
+	for i, instruction := range instructions {
+		result[i] = -1
+
+		if target, ok := common.JumpTarget(instruction, offset); ok {
+			index, ok := indices[target]
+			if !ok {
+				return nil, false
+			}
+
+			result[i] = index
+		}
+
+		offset += instruction.GetSize()
+	}
+
+	return result, true
+}
+
+// lays out the rewritten instructions of a set of count instructions and recomputes the
+// distances of their jumps, a jump to an instruction that is removed lands on the next one
+func relink(count int, rewrites []rewrite) common.InstructionSet {
+	offsets := make([]int, len(rewrites)+1)
+	for i, rewrite := range rewrites {
+		offsets[i+1] = offsets[i] + rewrite.instruction.GetSize()
+	}
+
+	// the new offset of every instruction of the original set
+	updated := make([]int, count+1)
+	next := 0
+
+	for i := 0; i <= count; i++ {
+		for next < len(rewrites) && rewrites[next].origin < i {
+			next++
+		}
+
+		updated[i] = offsets[next]
+	}
+
+	result := common.InstructionSet{}
+
+	for i, rewrite := range rewrites {
+		instruction := rewrite.instruction
+
+		if rewrite.target >= 0 {
+			target := updated[rewrite.target]
+			operands := append([]uint32{}, instruction.Operands...)
+
+			if operands[1] == 1 {
+				operands[0] = uint32(offsets[i] - target)
+			} else {
+				operands[0] = uint32(target - offsets[i] - instruction.GetSize())
+			}
+
+			instruction.Operands = operands
+		}
+
+		result = append(result, instruction)
+	}
+
+	return result
+}
+
+// runs the optimizations that work on the instructions of a function or of a module
+func (c *package_compiler) optimize(instructions common.InstructionSet) common.InstructionSet {
+	instructions = eliminate_dead_code(instructions)
+
+	if c.no_superinstructions {
+		return instructions
+	}
+
+	return fuse(instructions)
+}
+
+// removes the instructions that can never be reached, such as the ones after a return
+// or an exit, and recomputes the distances of the jumps over them
+func eliminate_dead_code(instructions common.InstructionSet) common.InstructionSet {
+	targets, ok := jump_targets(instructions)
+
+	// jumps that do not land on an instruction are left as they are
+	if !ok {
+		return instructions
+	}
+
+	reachable := make([]bool, len(instructions))
+	pending := []int{0}
+
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if i >= len(instructions) || reachable[i] {
+			continue
+		}
+
+		reachable[i] = true
+
+		if targets[i] >= 0 {
+			pending = append(pending, targets[i])
+		}
+
+		switch instructions[i].Op {
+		case common.OpJump, common.OpReturn, common.OpReturnEmpty, common.OpExit, common.OpGiveup:
+		default:
+			// deferred blocks follow their defer instruction
+			pending = append(pending, i+1)
+		}
+	}
+
+	rewrites := []rewrite{}
+
+	for i, instruction := range instructions {
+		if reachable[i] {
+			rewrites = append(rewrites, rewrite{instruction: instruction, origin: i, target: targets[i]})
+		}
+	}
+
+	return relink(len(instructions), rewrites)
+}
+
+// the jumps that replace a comparison followed by a conditional jump
+var compare_jumps = map[common.Op]common.Op{
+	common.OpGreaterThan:        common.OpJumpIfNotGreaterThan,
+	common.OpGreaterThanOrEqual: common.OpJumpIfNotGreaterThanOrEqual,
+	common.OpEqual:              common.OpJumpIfNotEqual,
+	common.OpNotEqual:           common.OpJumpIfEqual,
+}
+
+// replaces common sequences of instructions with superinstructions that do the same in
+// one step, a sequence is only replaced if no jump lands in the middle of it
+func fuse(instructions common.InstructionSet) common.InstructionSet {
+	targets, ok := jump_targets(instructions)
+	if !ok {
+		return instructions
+	}
+
+	targeted := make([]bool, len(instructions)+1)
+	for _, target := range targets {
+		if target >= 0 {
+			targeted[target] = true
+		}
+	}
+
+	// whether the n instructions from i on exist and only the first one is jumped to
+	sequence := func(i int, ops ...common.Op) bool {
+		if i+len(ops) > len(instructions) {
+			return false
+		}
+
+		for j, op := range ops {
+			if instructions[i+j].Op != op || (j > 0 && targeted[i+j]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	rewrites := []rewrite{}
+
+	for i := 0; i < len(instructions); i++ {
+		instruction := instructions[i]
+
+		switch {
+		// x += constant and x++ on locals
+		case sequence(i, common.OpGetLocal, common.OpConstant, common.OpAdd, common.OpAssignLocal) &&
+			instruction.Operands[0] == instructions[i+3].Operands[0]:
+			fused := common.NewInstruction(common.OpIncrementLocal, int(instruction.Operands[0]), int(instructions[i+1].Operands[0]))
+			fused.Location = instruction.Location
+
+			rewrites = append(rewrites, rewrite{instruction: fused, origin: i, target: -1})
+			i += 3
+		case sequence(i, common.OpConstant, common.OpIndex):
+			fused := common.NewInstruction(common.OpIndexConstant, int(instruction.Operands[0]))
+			fused.Location = instruction.Location
+
+			rewrites = append(rewrites, rewrite{instruction: fused, origin: i, target: -1})
+			i += 1
+		case compare_jumps[instruction.Op] != 0 && sequence(i, instruction.Op, common.OpJumpIfFalse):
+			jump := instructions[i+1]
+			fused := common.Instruction{Op: compare_jumps[instruction.Op], Operands: jump.Operands, Location: instruction.Location}
+
+			rewrites = append(rewrites, rewrite{instruction: fused, origin: i, target: targets[i+1]})
+			i += 1
+		default:
+			rewrites = append(rewrites, rewrite{instruction: instruction, origin: i, target: targets[i]})
+		}
+	}
+
+	return relink(len(instructions), rewrites)
+}
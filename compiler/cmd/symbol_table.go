@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
+	errors "github.com/moonbite-org/moonbite/error"
 	parser "github.com/moonbite-org/moonbite/parser/cmd"
 )
 
@@ -13,6 +15,8 @@ const (
 	BuiltinScope SymbolScope = "scope:builtin"
 	GlobalScope  SymbolScope = "scope:global"
 	LocalScope   SymbolScope = "scope:local"
+	// a variable of an enclosing function that a closure captures
+	FreeScope SymbolScope = "scope:free"
 )
 
 type Symbol struct {
@@ -21,6 +25,8 @@ type Symbol struct {
 	Index  int
 	Kind   parser.VarKind
 	Hidden bool
+	// the statement that declares a local, it is set once the statement is compiled
+	Location errors.Location
 }
 
 type SymbolTable struct {
@@ -28,6 +34,14 @@ type SymbolTable struct {
 
 	store map[string]Symbol
 	count int
+	block bool
+	// every local of a function and of its blocks in the order they are defined,
+	// blocks reuse the indices of the ones that are left so an index may have many names
+	locals *[]Symbol
+	// the variables of enclosing functions the function captures, in the order of their
+	// indices, as they are resolved in the enclosing function
+	FreeSymbols []Symbol
+	free        map[string]Symbol
 }
 
 func (t *SymbolTable) Define(name string, kind parser.VarKind, hidden bool) (Symbol, error) {
@@ -53,9 +67,35 @@ func (t *SymbolTable) Define(name string, kind parser.VarKind, hidden bool) (Sym
 	t.count++
 	t.store[name] = symbol
 
+	if t.locals != nil {
+		*t.locals = append(*t.locals, symbol)
+	}
+
 	return symbol, nil
 }
 
+// Locals returns the locals defined in the function of the table so far
+func (t SymbolTable) Locals() []Symbol {
+	if t.locals == nil {
+		return []Symbol{}
+	}
+
+	return *t.locals
+}
+
+// sets the location of the locals defined since the given count that do not have one yet
+func (t SymbolTable) locate(count int, location errors.Location) {
+	if t.locals == nil || location.Start.Line == 0 {
+		return
+	}
+
+	for i := count; i < len(*t.locals); i++ {
+		if (*t.locals)[i].Location.Start.Line == 0 {
+			(*t.locals)[i].Location = location
+		}
+	}
+}
+
 func (t *SymbolTable) DefineBuiltin(name string) (Symbol, error) {
 	_, exists := t.store[name]
 
@@ -77,18 +117,54 @@ func (t *SymbolTable) DefineBuiltin(name string) (Symbol, error) {
 	return symbol, nil
 }
 
-func (t SymbolTable) Resolve(name string) *Symbol {
-	symbol, ok := t.store[name]
+// Resolve finds a symbol in the table or in the ones it is in, a local of an enclosing
+// function becomes a free symbol of the function of the table
+func (t *SymbolTable) Resolve(name string) *Symbol {
+	if symbol, ok := t.store[name]; ok {
+		return &symbol
+	}
 
-	if !ok {
-		if t.Outer != nil {
-			return t.Outer.Resolve(name)
-		}
+	if symbol, ok := t.free[name]; ok {
+		return &symbol
+	}
 
+	if t.Outer == nil {
 		return nil
 	}
 
-	return &symbol
+	symbol := t.Outer.Resolve(name)
+
+	if symbol == nil || t.block || (symbol.Scope != LocalScope && symbol.Scope != FreeScope) {
+		return symbol
+	}
+
+	free := Symbol{
+		Name:     symbol.Name,
+		Scope:    FreeScope,
+		Index:    len(t.FreeSymbols),
+		Kind:     symbol.Kind,
+		Location: symbol.Location,
+	}
+
+	t.FreeSymbols = append(t.FreeSymbols, *symbol)
+	t.free[name] = free
+
+	return &free
+}
+
+// symbols defined directly in this table, ordered by their indices
+func (t SymbolTable) Symbols() []Symbol {
+	result := []Symbol{}
+
+	for _, symbol := range t.store {
+		result = append(result, symbol)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+
+	return result
 }
 
 func (t SymbolTable) String() string {
@@ -103,11 +179,26 @@ func (t SymbolTable) String() string {
 
 func NewSymbolTable() *SymbolTable {
 	store := make(map[string]Symbol)
-	return &SymbolTable{store: store, Outer: nil}
+	return &SymbolTable{store: store, free: map[string]Symbol{}, Outer: nil}
 }
 
 func NewScopedSymbolTable(outer *SymbolTable) *SymbolTable {
 	table := NewSymbolTable()
 	table.Outer = outer
+	table.locals = &[]Symbol{}
+	return table
+}
+
+// block tables share the local slots of the function they are in, so their
+// indices continue from the outer table instead of starting from 0
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	table := NewScopedSymbolTable(outer)
+	table.block = true
+
+	if outer.Outer != nil {
+		table.count = outer.count
+		table.locals = outer.locals
+	}
+
 	return table
 }
@@ -3,23 +3,83 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"path"
 
 	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
 	compiler "github.com/moonbite-org/moonbite/compiler/cmd"
 )
 
+// prints the disassembly of a compiled module or of a package directory
+func disasm(input string) {
+	var module common.Module
+
+	if path.Ext(input) == common.ModuleExtension {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+
+		module, err = common.Deserialize(data)
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+	} else {
+		c := compiler.New(input, abi.NativeABI)
+		if err := c.Compile(); err.Exists {
+			if !c.Diagnostics.Exists() {
+				c.Diagnostics.Add(err)
+			}
+
+			os.Stderr.WriteString(c.Diagnostics.String() + "\n")
+			os.Exit(1)
+		}
+
+		module = c.Modules["root"].Compiler.GetModule()
+	}
+
+	os.Stdout.WriteString(common.Disassemble(module))
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		os.Stderr.WriteString("no input provided\n")
 		os.Exit(1)
 	}
 
+	if os.Args[1] == "disasm" {
+		if len(os.Args) < 3 {
+			os.Stderr.WriteString("no input provided\n")
+			os.Exit(1)
+		}
+
+		disasm(os.Args[2])
+		return
+	}
+
 	c := compiler.New(os.Args[1], abi.NativeABI)
+	// every error of the module is reported at once
 	if err := c.Compile(); err.Exists {
-		message, _ := json.Marshal(err)
+		if !c.Diagnostics.Exists() {
+			c.Diagnostics.Add(err)
+		}
+
+		message, _ := json.Marshal(c.Diagnostics)
 		os.Stderr.Write(message)
 		os.Exit(0)
-	} else {
-		os.Stdout.WriteString("{}")
 	}
+
+	// an optional output path writes the compiled root module
+	if len(os.Args) > 2 {
+		root := c.Modules["root"].Compiler
+
+		if err := os.WriteFile(os.Args[2], root.GetBytes(), 0644); err != nil {
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	os.Stdout.WriteString("{}")
 }
@@ -0,0 +1,99 @@
+package embedding
+
+import (
+	"github.com/moonbite-org/moonbite/common"
+	"github.com/moonbite-org/moonbite/typechecker"
+)
+
+// converts an object to a Go value like common.FromObject, strings are lists of runes
+// while the program runs so the type the object is declared with tells which lists
+// are strings, they become Go strings
+func from_object(object common.Object, typ typechecker.Type) interface{} {
+	switch typ := typ.(type) {
+	case *typechecker.LiteralType:
+		return from_object(object, typ.Type)
+	case *typechecker.UnionType:
+		for _, member := range typ.Types {
+			if is_string(member) {
+				if result, ok := text(object); ok {
+					return result
+				}
+			}
+		}
+	case *typechecker.NamedType:
+		if is_string(typ) {
+			if result, ok := text(object); ok {
+				return result
+			}
+
+			break
+		}
+
+		if list, ok := object.(common.ListObject); ok && typ.Origin != nil && typ.Origin.Name == "List" && len(typ.Arguments) == 1 {
+			result := make([]interface{}, len(list.Value))
+
+			for i, item := range list.Value {
+				result[i] = from_object(item, typ.Arguments[0])
+			}
+
+			return result
+		}
+
+		if structure, ok := typ.Underlying.(*typechecker.StructType); ok {
+			if instance, ok := object.(common.InstanceObject); ok {
+				result := map[string]interface{}{}
+
+				for _, entry := range instance.Value {
+					key := common.DisplayObject(entry.Key)
+					var field_type typechecker.Type
+
+					if field, ok := structure.Field(key); ok {
+						field_type = field.Type
+					}
+
+					result[key] = from_object(entry.Value, field_type)
+				}
+
+				return result
+			}
+		}
+
+		// types that are defined as other types convert like them
+		if _, ok := typ.Underlying.(*typechecker.NamedType); ok {
+			return from_object(object, typ.Underlying)
+		}
+	}
+
+	return common.FromObject(object)
+}
+
+func is_string(typ typechecker.Type) bool {
+	named, ok := typ.(*typechecker.NamedType)
+	return ok && named.Name == "String" && named.Origin == nil
+}
+
+func text(object common.Object) (string, bool) {
+	switch object := object.(type) {
+	case common.StringObject:
+		return object.Value, true
+	case common.ListObject:
+		result := make([]rune, len(object.Value))
+
+		for i, item := range object.Value {
+			switch value := item.GetValue().(type) {
+			case int32:
+				result[i] = value
+			case uint32:
+				result[i] = rune(value)
+			case uint8:
+				result[i] = rune(value)
+			default:
+				return "", false
+			}
+		}
+
+		return string(result), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,205 @@
+// Package embedding runs MoonBite programs inside of Go programs. A runtime compiles
+// a package from sources that are kept in memory, runs it, and calls the functions it
+// exports by their names.
+//
+//	runtime := embedding.New(abi.NativeABI)
+//	runtime.Register("log", func(params ...common.Object) common.Object { ... })
+//
+//	if err := runtime.Load(map[string][]byte{"main.mb": source}); err.Exists {
+//		// runtime.Diagnostics has every error of the sources
+//	}
+//
+//	result, err := runtime.Call("add", 1, 2)
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
+	compiler "github.com/moonbite-org/moonbite/compiler/cmd"
+	errors "github.com/moonbite-org/moonbite/error"
+	"github.com/moonbite-org/moonbite/typechecker"
+	vm "github.com/moonbite-org/moonbite/vm/cmd"
+)
+
+type Runtime struct {
+	ABI abi.ABI
+	// the limits of loading the sources and of every call, set before Load
+	Limits vm.Limits
+	// every error found while compiling the sources
+	Diagnostics errors.Diagnostics
+	machine     *vm.VM
+	// the global indices of the functions that are not hidden
+	exports map[string]int
+	// the return types of the exported functions, their results are converted with them
+	returns map[string]typechecker.Type
+}
+
+func New(interface_ abi.ABI) *Runtime {
+	return &Runtime{
+		ABI: abi.ABI{
+			// registered functions must not be added to the abi the runtime is created with
+			Builtins: append([]abi.Builtin{}, interface_.Builtins...),
+		},
+		exports: map[string]int{},
+		returns: map[string]typechecker.Type{},
+	}
+}
+
+// Register makes a Go function callable from MoonBite with the given name. Builtins are
+// resolved while the sources are compiled, so functions are registered before Load.
+func (r *Runtime) Register(name string, fun func(params ...common.Object) common.Object) errors.Error {
+	if r.machine != nil {
+		return errors.CreateRuntimeError(fmt.Sprintf("cannot register '%s' after the sources are loaded", name))
+	}
+
+	for _, builtin := range r.ABI.Builtins {
+		if builtin.Name() == name {
+			return errors.CreateRuntimeError(fmt.Sprintf("a builtin named '%s' is already registered", name))
+		}
+	}
+
+	for _, builtin := range common.Builtins {
+		if builtin == name {
+			return errors.CreateRuntimeError(fmt.Sprintf("a builtin named '%s' is already registered", name))
+		}
+	}
+
+	r.ABI.Builtins = append(r.ABI.Builtins, abi.CreateBuiltinFun(name, fun))
+	return errors.EmptyError
+}
+
+// Load compiles the files of a package, keyed by their paths, and runs its top-level
+// definitions. The package does not need a main function, it is not called. The
+// functions of the package can only be called once it is loaded without errors.
+func (r *Runtime) Load(sources map[string][]byte) (result errors.Error) {
+	defer r.catch(&result, true)
+
+	c := compiler.NewFromSources(sources, r.ABI)
+
+	if err := c.Compile(); err.Exists {
+		r.Diagnostics = c.Diagnostics
+
+		if !r.Diagnostics.Exists() {
+			r.Diagnostics.Add(err)
+		}
+
+		return err
+	}
+
+	r.Diagnostics = errors.Diagnostics{}
+	root := c.Modules["root"].Compiler
+
+	exports := map[string]int{}
+	returns := map[string]typechecker.Type{}
+
+	for _, symbol := range root.SymbolTable.Symbols() {
+		if symbol.Scope != compiler.GlobalScope || symbol.Hidden {
+			continue
+		}
+
+		typ, _ := root.Typechecker.TypeOf(symbol.Name)
+		fun, ok := typ.(*typechecker.FunctionType)
+		if !ok {
+			continue
+		}
+
+		exports[symbol.Name] = symbol.Index
+
+		if fun.Return != nil {
+			returns[symbol.Name] = fun.Return
+		}
+	}
+
+	machine := vm.New(root.Instructions, root.ConstantPool, r.ABI)
+	machine.SetLimits(r.Limits)
+
+	if err := machine.Run(); err.Exists {
+		return err
+	}
+
+	r.machine = machine
+	r.exports = exports
+	r.returns = returns
+
+	return errors.EmptyError
+}
+
+// turns a panic of the compiler, the vm or a registered function into an error, so that
+// programs cannot crash the host
+func (r *Runtime) catch(result *errors.Error, loading bool) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	*result = errors.CreateRuntimeError(fmt.Sprintf("internal error: %v", recovered))
+
+	if loading {
+		r.Diagnostics = errors.Diagnostics{}
+		r.Diagnostics.Add(*result)
+	}
+}
+
+// Exports lists the names of the functions that can be called, in alphabetical order
+func (r *Runtime) Exports() []string {
+	result := []string{}
+
+	for name := range r.exports {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// Call calls an exported function with Go values and converts its result back to a
+// Go value, see common.ToObject and common.FromObject for how values are converted.
+// Results the function declares as strings, also in lists and instances, become Go strings.
+func (r *Runtime) Call(name string, arguments ...interface{}) (interface{}, errors.Error) {
+	return r.CallContext(context.Background(), name, arguments...)
+}
+
+// CallContext is Call that stops the function once the context is done
+func (r *Runtime) CallContext(ctx context.Context, name string, arguments ...interface{}) (interface{}, errors.Error) {
+	objects := make([]common.Object, len(arguments))
+
+	for i, argument := range arguments {
+		object, err := common.ToObject(argument)
+		if err != nil {
+			return nil, errors.CreateRuntimeError(fmt.Sprintf("argument %d of '%s': %s", i+1, name, err.Error()))
+		}
+
+		objects[i] = object
+	}
+
+	result, err := r.CallObjectContext(ctx, name, objects...)
+	if err.Exists {
+		return nil, err
+	}
+
+	return from_object(result, r.returns[name]), errors.EmptyError
+}
+
+// CallObject calls an exported function with objects and returns the object it returns
+func (r *Runtime) CallObject(name string, arguments ...common.Object) (common.Object, errors.Error) {
+	return r.CallObjectContext(context.Background(), name, arguments...)
+}
+
+func (r *Runtime) CallObjectContext(ctx context.Context, name string, arguments ...common.Object) (result common.Object, err errors.Error) {
+	defer r.catch(&err, false)
+
+	if r.machine == nil {
+		return nil, errors.CreateRuntimeError("no sources are loaded")
+	}
+
+	index, ok := r.exports[name]
+	if !ok {
+		return nil, errors.CreateRuntimeError(fmt.Sprintf("'%s' is not exported", name))
+	}
+
+	return r.machine.CallContext(ctx, r.machine.Global(index), arguments...)
+}
@@ -0,0 +1,267 @@
+package embedding_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
+	"github.com/moonbite-org/moonbite/embedding"
+	errors "github.com/moonbite-org/moonbite/error"
+	vm "github.com/moonbite-org/moonbite/vm/cmd"
+)
+
+const source = `package scripts
+
+var calls = 0
+
+fun add(a Int, b Int) Int {
+  calls = calls + 1
+  return a + b
+}
+
+fun scaled(value Int) Int {
+  return scale(value) + 1
+}
+
+fun range(count Int) List<Int> {
+  var result = []
+  for (var i = 0; i < count; i++) {
+    result = result + [i]
+  }
+  return result
+}
+
+fun greet(name String) String {
+  return "hello " + name
+}
+
+fun words() List<String> {
+  return ["a", "bc"]
+}
+
+fun stop() {
+  exit(3)
+}
+
+hidden fun secret() Int {
+  return 42
+}
+`
+
+func load(t *testing.T, runtime *embedding.Runtime) {
+	if err := runtime.Load(map[string][]byte{"scripts.mb": []byte(source)}); err.Exists {
+		t.Fatalf("expected no error but got: %s", runtime.Diagnostics)
+	}
+}
+
+func TestCall(t *testing.T) {
+	runtime := embedding.New(abi.NativeABI)
+	err := runtime.Register("scale", func(params ...common.Object) common.Object {
+		return common.Int32Object{Value: params[0].(common.Int32Object).Value * 10}
+	})
+	if err.Exists {
+		t.Fatal(err)
+	}
+
+	load(t, runtime)
+
+	result, err := runtime.Call("add", 2, 3)
+	if err.Exists {
+		t.Fatal(err)
+	}
+
+	if result != int32(5) {
+		t.Errorf("expected add to return 5 but got %v", result)
+	}
+
+	// globals keep their values between calls
+	runtime.Call("add", 1, 1)
+	result, _ = runtime.Call("add", 0, 0)
+	if result != int32(0) {
+		t.Errorf("expected add to return 0 but got %v", result)
+	}
+
+	result, err = runtime.Call("scaled", 4)
+	if err.Exists {
+		t.Fatal(err)
+	}
+
+	if result != int32(41) {
+		t.Errorf("expected scaled to return 41 but got %v", result)
+	}
+
+	result, _ = runtime.Call("range", 3)
+	if !reflect.DeepEqual(result, []interface{}{int32(0), int32(1), int32(2)}) {
+		t.Errorf("expected range to return [0 1 2] but got %v", result)
+	}
+
+	// strings are returned as go strings, also when they are in lists
+	result, err = runtime.Call("greet", "bob")
+	if err.Exists {
+		t.Fatal(err)
+	}
+
+	if result != "hello bob" {
+		t.Errorf("expected greet to return hello bob but got %v", result)
+	}
+
+	result, _ = runtime.Call("words")
+	if !reflect.DeepEqual(result, []interface{}{"a", "bc"}) {
+		t.Errorf("expected words to return [a bc] but got %v", result)
+	}
+
+	if !reflect.DeepEqual(runtime.Exports(), []string{"add", "greet", "range", "scaled", "stop", "words"}) {
+		t.Errorf("unexpected exports %v", runtime.Exports())
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	runtime := embedding.New(abi.NativeABI)
+
+	if _, err := runtime.Call("add", 1, 2); !err.Exists {
+		t.Errorf("expected an error before the sources are loaded")
+	}
+
+	runtime.Register("scale", func(params ...common.Object) common.Object { return params[0] })
+	load(t, runtime)
+
+	if _, err := runtime.Call("secret"); !err.Exists {
+		t.Errorf("expected hidden functions to not be callable")
+	}
+
+	if _, err := runtime.Call("add", "a", struct{}{}); !err.Exists {
+		t.Errorf("expected values that cannot be converted to be rejected")
+	}
+
+	if _, err := runtime.Call("add", 1<<40, 1); !err.Exists {
+		t.Errorf("expected ints that do not fit in an Int to be rejected")
+	}
+
+	if _, err := runtime.Call("calls"); !err.Exists {
+		t.Errorf("expected calling a value that is not a function to fail")
+	}
+
+	// a failed call does not break the runtime
+	if result, err := runtime.Call("add", 1, 2); err.Exists || result != int32(3) {
+		t.Errorf("expected add to return 3 but got %v, %s", result, err)
+	}
+
+	if err := runtime.Register("late", nil); !err.Exists {
+		t.Errorf("expected registering after loading to fail")
+	}
+
+	runtime.Call("stop")
+
+	if _, err := runtime.Call("add", 1, 2); !err.Exists {
+		t.Errorf("expected calls after the program exited to fail")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	runtime := embedding.New(abi.NativeABI)
+
+	// scale is not registered
+	err := runtime.Load(map[string][]byte{
+		"scripts.mb": []byte(source),
+		"broken.mb":  []byte("package scripts\n\nfun broken( {\n}\n"),
+	})
+
+	if !err.Exists {
+		t.Fatalf("expected an error")
+	}
+
+	if len(runtime.Diagnostics) != 1 {
+		t.Errorf("expected 1 diagnostic but got %d: %s", len(runtime.Diagnostics), runtime.Diagnostics)
+	}
+
+	if err := embedding.New(abi.NativeABI).Register("exit", nil); !err.Exists {
+		t.Errorf("expected registering a core builtin to fail")
+	}
+}
+
+func TestPanics(t *testing.T) {
+	runtime := embedding.New(abi.NativeABI)
+	runtime.Register("boom", func(params ...common.Object) common.Object {
+		panic("boom")
+	})
+
+	// a panic while loading is reported and leaves the runtime unloaded
+	err := runtime.Load(map[string][]byte{"boom.mb": []byte("package boom\n\nvar value = boom()\n\nfun one() Int {\n  return 1\n}\n")})
+	if !err.Exists || err.Reason != "internal error: boom" {
+		t.Errorf("expected an internal error but got: %s", err)
+	}
+
+	if len(runtime.Diagnostics) != 1 {
+		t.Errorf("expected 1 diagnostic but got %d: %s", len(runtime.Diagnostics), runtime.Diagnostics)
+	}
+
+	if _, err := runtime.Call("one"); !err.Exists || err.Reason != "no sources are loaded" {
+		t.Errorf("expected calls after a failed load to fail but got: %s", err)
+	}
+
+	// and so is a panic while calling
+	err = runtime.Load(map[string][]byte{"boom.mb": []byte("package boom\n\nfun explode() {\n  boom()\n}\n\nfun one() Int {\n  return 1\n}\n")})
+	if err.Exists {
+		t.Fatal(err)
+	}
+
+	if _, err := runtime.Call("explode"); !err.Exists || err.Reason != "internal error: boom" {
+		t.Errorf("expected an internal error but got: %s", err)
+	}
+
+	if result, err := runtime.Call("one"); err.Exists || result != int32(1) {
+		t.Errorf("expected one to return 1 after the panic but got %v, %s", result, err)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	cases := []interface{}{
+		"text", true, int32(1), int64(-2), uint8(3), 1.5, float32(2.5),
+		[]interface{}{"a", int32(1), nil},
+		map[interface{}]interface{}{"a": int32(1), "b": []interface{}{true}},
+	}
+
+	for _, value := range cases {
+		object, err := common.ToObject(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result := common.FromObject(object); !reflect.DeepEqual(result, value) {
+			t.Errorf("expected %v to convert back to itself but got %v", value, result)
+		}
+	}
+
+	object, _ := common.ToObject([]int{1, 2})
+	if !reflect.DeepEqual(object, common.ListObject{Value: []common.Object{common.Int32Object{Value: 1}, common.Int32Object{Value: 2}}}) {
+		t.Errorf("unexpected list %v", object)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	runtime := embedding.New(abi.NativeABI)
+	runtime.Limits = vm.Limits{Instructions: 10000}
+
+	err := runtime.Load(map[string][]byte{"spin.mb": []byte("package spin\n\nfun spin() {\n  for (true) {\n  }\n}\n\nfun one() Int {\n  return 1\n}\n")})
+	if err.Exists {
+		t.Fatal(err)
+	}
+
+	if _, err := runtime.Call("spin"); err.Kind != errors.InstructionLimitError {
+		t.Errorf("expected spin to exceed the instruction limit but got: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := runtime.CallContext(ctx, "spin"); err.Kind != errors.CancelledError {
+		t.Errorf("expected spin to be cancelled but got: %s", err)
+	}
+
+	// the limits apply to each call on its own
+	if result, err := runtime.Call("one"); err.Exists || result != int32(1) {
+		t.Errorf("expected one to return 1 but got %v, %s", result, err)
+	}
+}
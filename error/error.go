@@ -8,6 +8,12 @@ const (
 	SyntaxError ErrorKind = iota
 	TypeError
 	CompileError
+	RuntimeError
+	// runtime errors of programs that exceed a limit of the vm or are cancelled by the host
+	InstructionLimitError
+	FrameLimitError
+	MemoryLimitError
+	CancelledError
 )
 
 var ErrorMessages = map[string]string{
@@ -23,9 +29,14 @@ var ErrorMessages = map[string]string{
 }
 
 var ErrorKindMap = map[ErrorKind]string{
-	SyntaxError:  "Syntax Error",
-	TypeError:    "Type Error",
-	CompileError: "Compile Error",
+	SyntaxError:           "Syntax Error",
+	TypeError:             "Type Error",
+	CompileError:          "Compile Error",
+	RuntimeError:          "Runtime Error",
+	InstructionLimitError: "Instruction Limit Error",
+	FrameLimitError:       "Frame Limit Error",
+	MemoryLimitError:      "Memory Limit Error",
+	CancelledError:        "Cancelled Error",
 }
 
 type Position struct {
@@ -40,12 +51,31 @@ type Location struct {
 	End    Position `json:"end"`
 }
 
+// StackFrame is a call that was active when a runtime error happened
+type StackFrame struct {
+	Function string   `json:"function"`
+	Location Location `json:"location"`
+}
+
+func (f StackFrame) String() string {
+	if f.Location.Start.Line == 0 {
+		return fmt.Sprintf("at %s", f.Function)
+	}
+
+	return fmt.Sprintf("at %s (%s:%d:%d)", f.Function, f.Location.File, f.Location.Start.Line, f.Location.Start.Column)
+}
+
+// the frames of deep stacks that are printed from each end, the rest are elided
+const printed_frames = 10
+
 type Error struct {
 	Kind      ErrorKind `json:"kind"`
 	Reason    string    `json:"reason"`
 	Location  Location  `json:"location"`
 	Exists    bool      `json:"exists"`
 	Anonymous bool      `json:"anonymous"`
+	// the calls of a runtime error, starting from the one it happened in
+	Stack []StackFrame `json:"stack,omitempty"`
 }
 
 func (e Error) String() string {
@@ -53,11 +83,33 @@ func (e Error) String() string {
 		return ""
 	}
 
+	var result string
+
 	if e.Anonymous {
-		return fmt.Sprintf("%s: %s", ErrorKindMap[e.Kind], e.Reason)
+		result = fmt.Sprintf("%s: %s", ErrorKindMap[e.Kind], e.Reason)
+	} else {
+		result = fmt.Sprintf("%s: %s at %d:%d in %s", ErrorKindMap[e.Kind], e.Reason, e.Location.Start.Line, e.Location.Start.Column, e.Location.File)
 	}
 
-	return fmt.Sprintf("%s: %s at %d:%d in %s", ErrorKindMap[e.Kind], e.Reason, e.Location.Start.Line, e.Location.Start.Column, e.Location.File)
+	return result + e.trace()
+}
+
+func (e Error) trace() string {
+	result := ""
+
+	for i, frame := range e.Stack {
+		if len(e.Stack) > 2*printed_frames && i == printed_frames {
+			result += fmt.Sprintf("\n    ... %d more", len(e.Stack)-2*printed_frames)
+		}
+
+		if len(e.Stack) > 2*printed_frames && i >= printed_frames && i < len(e.Stack)-printed_frames {
+			continue
+		}
+
+		result += "\n    " + frame.String()
+	}
+
+	return result
 }
 
 func CreateAnonError(kind ErrorKind, reason string) Error {
@@ -93,6 +145,24 @@ func CreateCompileError(reason string, location Location) Error {
 	}
 }
 
+func CreateRuntimeError(reason string) Error {
+	return CreateAnonError(RuntimeError, reason)
+}
+
+// CreateRuntimeErrorAt creates a runtime error of a kind, it is anonymous if the location is not known
+func CreateRuntimeErrorAt(kind ErrorKind, reason string, location Location) Error {
+	if location.Start.Line == 0 {
+		return CreateAnonError(kind, reason)
+	}
+
+	return Error{
+		Location: location,
+		Kind:     kind,
+		Exists:   true,
+		Reason:   reason,
+	}
+}
+
 var EmptyError = Error{
 	Kind:   0,
 	Reason: "",
@@ -105,3 +175,39 @@ var EmptyError = Error{
 	Exists:    false,
 	Anonymous: true,
 }
+
+// Diagnostics holds every error found in a single run so they can be reported together
+type Diagnostics []Error
+
+func (d *Diagnostics) Add(err Error) {
+	if err.Exists {
+		*d = append(*d, err)
+	}
+}
+
+func (d Diagnostics) Exists() bool {
+	return len(d) > 0
+}
+
+// First returns the error that was found first, or EmptyError when there is none
+func (d Diagnostics) First() Error {
+	if len(d) == 0 {
+		return EmptyError
+	}
+
+	return d[0]
+}
+
+func (d Diagnostics) String() string {
+	result := ""
+
+	for i, err := range d {
+		if i > 0 {
+			result += "\n"
+		}
+
+		result += err.String()
+	}
+
+	return result
+}
@@ -0,0 +1,3 @@
+module github.com/moonbite-org/moonbite/formatter
+
+go 1.21.0
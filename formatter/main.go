@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+)
+
+// moonfmt rewrites files in the canonical layout of the language. With --check it
+// only lists the files that are not formatted and fails if there are any.
+func main() {
+	is_check := false
+	files := []string{}
+
+	for _, arg := range os.Args[1:] {
+		if arg == "--check" {
+			is_check = true
+		} else {
+			files = append(files, arg)
+		}
+	}
+
+	if len(files) == 0 {
+		os.Stderr.WriteString("no input provided\n")
+		os.Exit(1)
+	}
+
+	is_failed := false
+
+	for _, file_path := range files {
+		input, err := os.ReadFile(file_path)
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			is_failed = true
+			continue
+		}
+
+		output, diagnostics := parser.Format(input, file_path)
+
+		if diagnostics.Exists() {
+			os.Stderr.WriteString(diagnostics.String() + "\n")
+			is_failed = true
+			continue
+		}
+
+		if bytes.Equal(input, output) {
+			continue
+		}
+
+		if is_check {
+			fmt.Println(file_path)
+			is_failed = true
+			continue
+		}
+
+		if err := os.WriteFile(file_path, output, 0644); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			is_failed = true
+		}
+	}
+
+	if is_failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,503 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
+	compiler "github.com/moonbite-org/moonbite/compiler/cmd"
+	errors "github.com/moonbite-org/moonbite/error"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+	"github.com/moonbite-org/moonbite/typechecker"
+)
+
+type file struct {
+	uri         string
+	lines       []string
+	ast         parser.Ast
+	diagnostics errors.Diagnostics
+}
+
+// analysis is the result of checking the files of a package. Like the compiler,
+// the server treats the files in the directory of a document as one package.
+type analysis struct {
+	// files by their base name, which is what the locations of the parser refer to
+	files   map[string]*file
+	checker *typechecker.Typechecker
+	// the panic of the typechecker with its stack, empty unless the typechecker has a bug
+	failure string
+}
+
+func analyze(sources map[string]string) *analysis {
+	result := &analysis{files: map[string]*file{}}
+	definitions := []parser.Definition{}
+	has_syntax_errors := false
+
+	uris := []string{}
+
+	for uri := range sources {
+		uris = append(uris, uri)
+	}
+
+	// files are checked in the order the compiler reads them from their directory
+	slices.Sort(uris)
+
+	for _, uri := range uris {
+		text := sources[uri]
+		ast, diagnostics := parser.ParseAll([]byte(text), uri_to_path(uri))
+
+		result.files[ast.FileName] = &file{uri: uri, lines: strings.Split(text, "\n"), ast: ast, diagnostics: diagnostics}
+		definitions = append(definitions, ast.Definitions...)
+		has_syntax_errors = has_syntax_errors || diagnostics.Exists()
+	}
+
+	result.checker, result.failure = check(definitions)
+
+	// the types of the package are not known once the typechecker fails, every file says so
+	if result.failure != "" {
+		for _, file := range result.files {
+			reason := "internal error: the typechecker failed on this package, see the log of the server"
+			file.diagnostics = append(file.diagnostics, errors.CreateTypeError(reason, file.ast.Package.Location()))
+		}
+	}
+
+	// like the compiler, type errors are only reported for packages without syntax errors
+	if has_syntax_errors {
+		return result
+	}
+
+	for _, err := range result.checker.Diagnostics {
+		if file, ok := result.files[err.Location.File]; ok {
+			file.diagnostics = append(file.diagnostics, err)
+		}
+	}
+
+	return result
+}
+
+// the definitions of a file with syntax errors are the ones the parser could
+// recover, the references found in them are still useful while a file is edited.
+// A panic of the typechecker is a bug of it, it is returned instead of stopping the server.
+func check(definitions []parser.Definition) (checker *typechecker.Typechecker, failure string) {
+	checker = typechecker.New()
+
+	defer func() {
+		if r := recover(); r != nil {
+			failure = fmt.Sprintf("%v\n%s", r, debug.Stack())
+		}
+	}()
+
+	checker.CheckDefinitions(definitions)
+
+	return checker, ""
+}
+
+func (a *analysis) file_of(uri string) *file {
+	for _, file := range a.files {
+		if file.uri == uri {
+			return file
+		}
+	}
+
+	return nil
+}
+
+func (a *analysis) diagnostics(f *file) []Diagnostic {
+	result := []Diagnostic{}
+
+	for _, err := range f.diagnostics {
+		result = append(result, Diagnostic{
+			Range:    to_range(err.Location, f.lines),
+			Severity: ErrorSeverity,
+			Source:   "moonbite",
+			Message:  err.Reason,
+		})
+	}
+
+	return result
+}
+
+func (a *analysis) reference_at(f *file, position Position) (typechecker.Reference, bool) {
+	return a.checker.ReferenceAt(f.ast.FileName, position.Line+1, position.Character+1)
+}
+
+func (a *analysis) definition(f *file, position Position) *Location {
+	reference, ok := a.reference_at(f, position)
+	if !ok {
+		return nil
+	}
+
+	// the prelude and the fields of types have no location in the package
+	target, ok := a.files[reference.Definition.File]
+	if !ok {
+		return nil
+	}
+
+	return &Location{URI: target.uri, Range: to_range(reference.Definition, target.lines)}
+}
+
+func (a *analysis) hover(f *file, position Position) *Hover {
+	reference, ok := a.reference_at(f, position)
+	if !ok {
+		return nil
+	}
+
+	return &Hover{
+		Contents: markup_content{Kind: "markdown", Value: fmt.Sprintf("```moonbite\n%s\n```", describe(reference))},
+		Range:    to_range(reference.Location, f.lines),
+	}
+}
+
+// writes a reference the way it would be defined
+func describe(reference typechecker.Reference) string {
+	switch reference.Kind {
+	case typechecker.FunctionReference, typechecker.MethodReference:
+		return fmt.Sprintf("fun %s%s", reference.Name, strings.TrimPrefix(reference.Type.String(), "fun"))
+	case typechecker.TypeReference:
+		if named, ok := reference.Type.(*typechecker.NamedType); ok && named.Underlying != nil {
+			return fmt.Sprintf("type %s %s", named, named.Underlying)
+		}
+
+		return fmt.Sprintf("type %s", reference.Type)
+	case typechecker.FieldReference:
+		return fmt.Sprintf("%s %s", reference.Name, reference.Type)
+	default:
+		return fmt.Sprintf("var %s %s", reference.Type, reference.Name)
+	}
+}
+
+// the detail of a symbol or a completion is its type
+func (a *analysis) detail(name parser.IdentifierExpression) string {
+	reference, ok := a.checker.ReferenceAt(name.Location().File, name.Location().Start.Line, name.Location().Start.Column)
+	if !ok || reference.Type == nil {
+		return ""
+	}
+
+	return reference.Type.String()
+}
+
+// the locations of statements only cover their keyword, a definition is taken
+// to span until the next one starts
+func (a *analysis) extents(f *file) []Range {
+	result := []Range{}
+
+	for i, definition := range f.ast.Definitions {
+		extent := to_range(definition.Location(), f.lines)
+		extent.End = Position{Line: len(f.lines)}
+
+		if i+1 < len(f.ast.Definitions) {
+			extent.End = to_position(f.ast.Definitions[i+1].Location().Start, f.lines)
+		}
+
+		result = append(result, extent)
+	}
+
+	return result
+}
+
+func (a *analysis) symbols(f *file) []DocumentSymbol {
+	result := []DocumentSymbol{}
+	extents := a.extents(f)
+
+	for i, definition := range f.ast.Definitions {
+		symbol := DocumentSymbol{Range: extents[i]}
+
+		switch definition.Kind() {
+		case parser.DeclarationStatementKind:
+			statement := definition.(parser.DeclarationStatement)
+			symbol.Name = statement.Name.Value
+			symbol.Kind = VariableSymbol
+			symbol.Detail = a.detail(statement.Name)
+			symbol.SelectionRange = to_range(statement.Name.Location(), f.lines)
+
+			if statement.VarKind == parser.ConstantKind {
+				symbol.Kind = ConstantSymbol
+			}
+		case parser.UnboundFunDefinitionStatementKind:
+			signature := definition.(*parser.UnboundFunDefinitionStatement).Signature
+			symbol.Name = signature.Name.Value
+			symbol.Kind = FunctionSymbol
+			symbol.Detail = a.detail(signature.Name)
+			symbol.SelectionRange = to_range(signature.Name.Location(), f.lines)
+		case parser.BoundFunDefinitionStatementKind:
+			signature := definition.(*parser.BoundFunDefinitionStatement).Signature
+			symbol.Name = fmt.Sprintf("%s.%s", name_of(signature.For.Name), signature.Name.Value)
+			symbol.Kind = MethodSymbol
+			symbol.Detail = a.detail(signature.Name)
+			symbol.SelectionRange = to_range(signature.Name.Location(), f.lines)
+		case parser.TypeDefinitionStatementKind:
+			statement := definition.(parser.TypeDefinitionStatement)
+			symbol.Name = statement.Name.Value
+			symbol.Kind = ClassSymbol
+			symbol.SelectionRange = to_range(statement.Name.Location(), f.lines)
+
+			if structure, ok := statement.Definition.(parser.StructLiteral); ok {
+				symbol.Kind = StructSymbol
+
+				for _, field := range structure.Values {
+					symbol.Children = append(symbol.Children, DocumentSymbol{
+						Name:           field.Key.Value,
+						Kind:           FieldSymbol,
+						Range:          to_range(field.Location, f.lines),
+						SelectionRange: to_range(field.Key.Location(), f.lines),
+					})
+				}
+			}
+		case parser.TraitDefinitionStatementKind:
+			statement := definition.(parser.TraitDefinitionStatement)
+			symbol.Name = statement.Name.Value
+			symbol.Kind = InterfaceSymbol
+			symbol.SelectionRange = to_range(statement.Name.Location(), f.lines)
+
+			for _, signature := range statement.Definition {
+				symbol.Children = append(symbol.Children, DocumentSymbol{
+					Name:           signature.Name.Value,
+					Kind:           MethodSymbol,
+					Range:          to_range(signature.Location(), f.lines),
+					SelectionRange: to_range(signature.Name.Location(), f.lines),
+				})
+			}
+		default:
+			continue
+		}
+
+		result = append(result, symbol)
+	}
+
+	return result
+}
+
+func name_of(name parser.Expression) string {
+	switch name := name.(type) {
+	case parser.IdentifierExpression:
+		return name.Value
+	case parser.MemberExpression:
+		return fmt.Sprintf("%s.%s", name_of(name.LeftHandSide), name.RightHandSide.Value)
+	default:
+		return ""
+	}
+}
+
+func is_name_rune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r > 127
+}
+
+// the name being typed at a position and, when it follows a '.', the name before it
+func (a *analysis) words_at(f *file, position Position) (string, string, bool) {
+	if position.Line >= len(f.lines) {
+		return "", "", false
+	}
+
+	line := []rune(f.lines[position.Line])
+	end := min(position.Character, len(line))
+	start := end
+
+	for start > 0 && is_name_rune(line[start-1]) {
+		start--
+	}
+
+	word := string(line[start:end])
+
+	if start == 0 || line[start-1] != '.' {
+		return word, "", false
+	}
+
+	host_end := start - 1
+	host_start := host_end
+
+	for host_start > 0 && is_name_rune(line[host_start-1]) {
+		host_start--
+	}
+
+	return word, string(line[host_start:host_end]), true
+}
+
+// the packages a file uses by the names they are referred to with
+func uses(f *file) []string {
+	result := []string{}
+
+	for _, use := range f.ast.Uses {
+		if use.As != nil {
+			result = append(result, use.As.Value)
+		} else {
+			result = append(result, path.Base(use.Resource.Value))
+		}
+	}
+
+	return result
+}
+
+func (a *analysis) completion(f *file, position Position) []CompletionItem {
+	word, host, is_member := a.words_at(f, position)
+	items := []CompletionItem{}
+
+	if is_member {
+		// the packages of a module are not checked yet, so nothing is known about their members
+		if slices.Contains(uses(f), host) {
+			return items
+		}
+
+		for _, symbol := range abi.NativeABI.Symbols() {
+			if name, ok := strings.CutPrefix(symbol.Name, host+"."); ok && !strings.Contains(name, ".") {
+				items = append(items, CompletionItem{Label: name, Kind: FunctionCompletion, Detail: "builtin"})
+			}
+		}
+
+		if len(items) > 0 {
+			return filter(items, word)
+		}
+
+		if typ := a.type_of(f, host, position); typ != nil {
+			fields, methods := typechecker.Members(typ)
+
+			for _, field := range fields {
+				items = append(items, CompletionItem{Label: field.Name, Kind: FieldCompletion, Detail: field.Type.String()})
+			}
+
+			for _, method := range methods {
+				items = append(items, CompletionItem{Label: method.Name, Kind: MethodCompletion, Detail: method.Type.String()})
+			}
+		}
+
+		return filter(items, word)
+	}
+
+	for _, keyword := range parser.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: KeywordCompletion})
+	}
+
+	for _, name := range uses(f) {
+		items = append(items, CompletionItem{Label: name, Kind: ModuleCompletion})
+	}
+
+	// the builtins are the ones the compiler defines for every package
+	builtins := compiler.NewSymbolTable()
+
+	for _, builtin := range common.Builtins {
+		builtins.DefineBuiltin(builtin)
+	}
+
+	for _, builtin := range abi.NativeABI.Builtins {
+		builtins.DefineBuiltin(builtin.Name())
+	}
+
+	for _, symbol := range builtins.Symbols() {
+		// some builtins are only used by the compiler and cannot be referred to
+		if strings.HasPrefix(symbol.Name, "#") {
+			continue
+		}
+
+		items = append(items, CompletionItem{Label: symbol.Name, Kind: FunctionCompletion, Detail: "builtin"})
+	}
+
+	for name, definition := range a.checker.SymbolTable.Symbols {
+		kind := ClassCompletion
+
+		if named, ok := definition.Type.(*typechecker.NamedType); ok {
+			if _, ok := named.Underlying.(*typechecker.TraitType); ok {
+				kind = InterfaceCompletion
+			}
+		}
+
+		items = append(items, CompletionItem{Label: name, Kind: kind})
+	}
+
+	for _, reference := range a.visible(f, position) {
+		kind := VariableCompletion
+
+		if reference.Kind == typechecker.FunctionReference {
+			kind = FunctionCompletion
+		}
+
+		items = append(items, CompletionItem{Label: reference.Name, Kind: kind, Detail: reference.Type.String()})
+	}
+
+	return filter(items, word)
+}
+
+// the variables and functions that can be referred to at a position, which are
+// the global ones of the package and the ones defined before it in its definition
+func (a *analysis) visible(f *file, position Position) []typechecker.Reference {
+	result := []typechecker.Reference{}
+	globals := []errors.Location{}
+
+	for _, file := range a.files {
+		for _, definition := range file.ast.Definitions {
+			switch definition := definition.(type) {
+			case parser.DeclarationStatement:
+				globals = append(globals, definition.Name.Location())
+			case *parser.UnboundFunDefinitionStatement:
+				globals = append(globals, definition.Signature.Name.Location())
+			}
+		}
+	}
+
+	enclosing := Range{}
+
+	for _, extent := range a.extents(f) {
+		if extent.Start.Line <= position.Line && position.Line < extent.End.Line {
+			enclosing = extent
+		}
+	}
+
+	for _, reference := range a.checker.References {
+		if !reference.IsDefinition() || (reference.Kind != typechecker.VariableReference && reference.Kind != typechecker.FunctionReference) {
+			continue
+		}
+
+		line := reference.Location.Start.Line - 1
+		is_local := reference.Location.File == f.ast.FileName && enclosing.Start.Line <= line && line <= position.Line
+
+		if slices.Contains(globals, reference.Location) || is_local {
+			result = append(result, reference)
+		}
+	}
+
+	return result
+}
+
+// finds the type of a name the way it was last defined before a position, files
+// that are being edited often do not parse at the position itself
+func (a *analysis) type_of(f *file, name string, position Position) typechecker.Type {
+	if name == "this" {
+		for i, extent := range a.extents(f) {
+			definition, ok := f.ast.Definitions[i].(*parser.BoundFunDefinitionStatement)
+
+			if ok && extent.Start.Line <= position.Line && position.Line < extent.End.Line {
+				if symbol := a.checker.SymbolTable.Get(name_of(definition.Signature.For.Name)); symbol != nil {
+					return symbol.Type
+				}
+			}
+		}
+
+		return nil
+	}
+
+	var result typechecker.Type
+
+	for _, reference := range a.visible(f, position) {
+		if reference.Name == name {
+			result = reference.Type
+		}
+	}
+
+	return result
+}
+
+func filter(items []CompletionItem, prefix string) []CompletionItem {
+	result := []CompletionItem{}
+
+	for _, item := range items {
+		if strings.HasPrefix(item.Label, prefix) && !slices.ContainsFunc(result, func(other CompletionItem) bool { return other.Label == item.Label }) {
+			result = append(result, item)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b CompletionItem) int { return strings.Compare(a.Label, b.Label) })
+
+	return result
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/json"
+	"unicode/utf16"
+
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// the parts of the language server protocol the server speaks, see
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+type message struct {
+	Version string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *response_error  `json:"error,omitempty"`
+}
+
+type response_error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	parse_error_code      = -32700
+	method_not_found_code = -32601
+	invalid_params_code   = -32602
+	invalid_request_code  = -32600
+)
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// locations of the parser count lines and columns from 1 and columns in runes, the
+// protocol counts them from 0 and characters in the UTF-16 code units of the line
+func to_position(position errors.Position, lines []string) Position {
+	line := max(position.Line-1, 0)
+	column := max(position.Column-1, 0)
+
+	if line >= len(lines) {
+		return Position{Line: line, Character: column}
+	}
+
+	// columns past the end of the line are the line break and what follows it
+	runes := []rune(lines[line])
+	count := min(column, len(runes))
+
+	return Position{Line: line, Character: len(utf16.Encode(runes[:count])) + column - count}
+}
+
+// the column of the parser a position of the protocol is at, counted from 0
+func to_column(position Position, lines []string) int {
+	if position.Line >= len(lines) {
+		return position.Character
+	}
+
+	units := 0
+	runes := []rune(lines[position.Line])
+
+	for i, r := range runes {
+		if units >= position.Character {
+			return i
+		}
+
+		units += len(utf16.Encode([]rune{r}))
+	}
+
+	return len(runes) + position.Character - units
+}
+
+func to_range(location errors.Location, lines []string) Range {
+	start := to_position(location.Start, lines)
+	end := to_position(location.End, lines)
+
+	// some errors do not know where they end
+	if end.Line < start.Line || (end.Line == start.Line && end.Character < start.Character) {
+		end = start
+	}
+
+	return Range{Start: start, End: end}
+}
+
+type text_document_identifier struct {
+	URI string `json:"uri"`
+}
+
+type text_document_item struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+type text_document_position_params struct {
+	TextDocument text_document_identifier `json:"textDocument"`
+	Position     Position                 `json:"position"`
+}
+
+type did_open_params struct {
+	TextDocument text_document_item `json:"textDocument"`
+}
+
+type did_change_params struct {
+	TextDocument   text_document_identifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type did_close_params struct {
+	TextDocument text_document_identifier `json:"textDocument"`
+}
+
+type document_symbol_params struct {
+	TextDocument text_document_identifier `json:"textDocument"`
+}
+
+type DiagnosticSeverity int
+
+const (
+	ErrorSeverity DiagnosticSeverity = 1
+)
+
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity"`
+	Source   string             `json:"source"`
+	Message  string             `json:"message"`
+}
+
+type publish_diagnostics_params struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MessageType int
+
+const (
+	ErrorMessage MessageType = 1
+)
+
+type log_message_params struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
+type markup_content struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents markup_content `json:"contents"`
+	Range    Range          `json:"range"`
+}
+
+type SymbolKind int
+
+const (
+	ClassSymbol     SymbolKind = 5
+	MethodSymbol    SymbolKind = 6
+	FieldSymbol     SymbolKind = 8
+	InterfaceSymbol SymbolKind = 11
+	FunctionSymbol  SymbolKind = 12
+	VariableSymbol  SymbolKind = 13
+	ConstantSymbol  SymbolKind = 14
+	StructSymbol    SymbolKind = 23
+)
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           SymbolKind       `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+type CompletionItemKind int
+
+const (
+	MethodCompletion    CompletionItemKind = 2
+	FunctionCompletion  CompletionItemKind = 3
+	FieldCompletion     CompletionItemKind = 5
+	VariableCompletion  CompletionItemKind = 6
+	ClassCompletion     CompletionItemKind = 7
+	InterfaceCompletion CompletionItemKind = 8
+	ModuleCompletion    CompletionItemKind = 9
+	KeywordCompletion   CompletionItemKind = 14
+)
+
+type CompletionItem struct {
+	Label  string             `json:"label"`
+	Kind   CompletionItemKind `json:"kind"`
+	Detail string             `json:"detail,omitempty"`
+}
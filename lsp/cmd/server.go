@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Server is a language server that talks JSON-RPC over a pair of streams, usually stdin and stdout
+type Server struct {
+	reader *bufio.Reader
+	writer io.Writer
+	// the open documents by their uri, they take the place of the files on disk
+	documents map[string]string
+	// the analyses of the packages by their directory
+	analyses    map[string]*analysis
+	is_shutdown bool
+}
+
+func New(reader io.Reader, writer io.Writer) *Server {
+	return &Server{
+		reader:    bufio.NewReader(reader),
+		writer:    writer,
+		documents: map[string]string{},
+		analyses:  map[string]*analysis{},
+	}
+}
+
+// Serve handles messages until the client asks the server to exit or closes the stream.
+// It returns whether the server was shut down before it exited.
+func (s *Server) Serve() (bool, error) {
+	for {
+		data, err := s.read()
+		if err == io.EOF {
+			return s.is_shutdown, nil
+		}
+
+		if err != nil {
+			return s.is_shutdown, err
+		}
+
+		var request message
+		if err := json.Unmarshal(data, &request); err != nil {
+			s.respond(nil, nil, &response_error{Code: parse_error_code, Message: err.Error()})
+			continue
+		}
+
+		if request.Method == "exit" {
+			return s.is_shutdown, nil
+		}
+
+		result, r_err := s.handle(request)
+
+		// notifications have no id and are never responded to
+		if request.Id != nil {
+			s.respond(request.Id, result, r_err)
+		}
+	}
+}
+
+func (s *Server) handle(request message) (any, *response_error) {
+	if s.is_shutdown && request.Method != "shutdown" {
+		return nil, &response_error{Code: invalid_request_code, Message: "the server is shut down"}
+	}
+
+	switch request.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				// documents are always sent in full
+				"textDocumentSync":       1,
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{"name": "moonls"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.is_shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params did_open_params
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, invalid_params(err)
+		}
+
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+		s.changed(params.TextDocument.URI)
+
+		return nil, nil
+	case "textDocument/didChange":
+		var params did_change_params
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, invalid_params(err)
+		}
+
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+
+		s.documents[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.changed(params.TextDocument.URI)
+
+		return nil, nil
+	case "textDocument/didClose":
+		var params did_close_params
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, invalid_params(err)
+		}
+
+		delete(s.documents, params.TextDocument.URI)
+		s.changed(params.TextDocument.URI)
+
+		// the diagnostics of a closed document are cleared
+		s.notify("textDocument/publishDiagnostics", publish_diagnostics_params{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+		return nil, nil
+	case "textDocument/definition":
+		return s.with_position(request, func(a *analysis, f *file, position Position) any {
+			if location := a.definition(f, position); location != nil {
+				return location
+			}
+
+			return nil
+		})
+	case "textDocument/hover":
+		return s.with_position(request, func(a *analysis, f *file, position Position) any {
+			if hover := a.hover(f, position); hover != nil {
+				return hover
+			}
+
+			return nil
+		})
+	case "textDocument/completion":
+		return s.with_position(request, func(a *analysis, f *file, position Position) any {
+			return a.completion(f, position)
+		})
+	case "textDocument/documentSymbol":
+		var params document_symbol_params
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, invalid_params(err)
+		}
+
+		a, f := s.analysis_of(params.TextDocument.URI)
+		if f == nil {
+			return []DocumentSymbol{}, nil
+		}
+
+		return a.symbols(f), nil
+	}
+
+	if strings.HasPrefix(request.Method, "$/") || request.Id == nil {
+		return nil, nil
+	}
+
+	return nil, &response_error{Code: method_not_found_code, Message: fmt.Sprintf("method '%s' is not supported", request.Method)}
+}
+
+func (s *Server) with_position(request message, handler func(a *analysis, f *file, position Position) any) (any, *response_error) {
+	var params text_document_position_params
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return nil, invalid_params(err)
+	}
+
+	a, f := s.analysis_of(params.TextDocument.URI)
+	if f == nil {
+		return nil, nil
+	}
+
+	// the handlers count characters in runes like the parser
+	position := Position{Line: params.Position.Line, Character: to_column(params.Position, f.lines)}
+
+	return handler(a, f, position), nil
+}
+
+func invalid_params(err error) *response_error {
+	return &response_error{Code: invalid_params_code, Message: err.Error()}
+}
+
+// a document changed, so its package is checked again and the diagnostics of its open documents are sent
+func (s *Server) changed(uri string) {
+	dir := path.Dir(uri_to_path(uri))
+	delete(s.analyses, dir)
+
+	a := s.analyze(dir)
+
+	for _, f := range a.files {
+		if _, ok := s.documents[f.uri]; ok {
+			s.notify("textDocument/publishDiagnostics", publish_diagnostics_params{URI: f.uri, Diagnostics: a.diagnostics(f)})
+		}
+	}
+}
+
+func (s *Server) analysis_of(uri string) (*analysis, *file) {
+	a := s.analyze(path.Dir(uri_to_path(uri)))
+	return a, a.file_of(uri)
+}
+
+// checks the files of a directory, the open documents take the place of the files on disk
+func (s *Server) analyze(dir string) *analysis {
+	if a, ok := s.analyses[dir]; ok {
+		return a
+	}
+
+	sources := map[string]string{}
+	open := map[string]bool{}
+
+	for uri, text := range s.documents {
+		if path.Dir(uri_to_path(uri)) == dir {
+			sources[uri] = text
+			open[uri_to_path(uri)] = true
+		}
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			entry_path := path.Join(dir, entry.Name())
+
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".mb" || open[entry_path] {
+				continue
+			}
+
+			if data, err := os.ReadFile(entry_path); err == nil {
+				sources[path_to_uri(entry_path)] = string(data)
+			}
+		}
+	}
+
+	a := analyze(sources)
+	s.analyses[dir] = a
+
+	if a.failure != "" {
+		s.notify("window/logMessage", log_message_params{Type: ErrorMessage, Message: fmt.Sprintf("the typechecker failed on %s: %s", dir, a.failure)})
+	}
+
+	return a
+}
+
+func uri_to_path(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+
+	return parsed.Path
+}
+
+func path_to_uri(file_path string) string {
+	return (&url.URL{Scheme: "file", Path: file_path}).String()
+}
+
+// reads the content of a message, messages start with headers that are separated from it by an empty line
+func (s *Server) read() ([]byte, error) {
+	length := -1
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid content length '%s'", value)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("message has no content length")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *Server) write(m message) {
+	m.Version = "2.0"
+	data, _ := json.Marshal(m)
+
+	fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *Server) respond(id *json.RawMessage, result any, err *response_error) {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+
+	// a successful response always has a result, even if it is null
+	if err == nil && result == nil {
+		result = json.RawMessage("null")
+	}
+
+	s.write(message{Id: id, Result: result, Error: err})
+}
+
+func (s *Server) notify(method string, params any) {
+	data, _ := json.Marshal(params)
+	s.write(message{Method: method, Params: data})
+}
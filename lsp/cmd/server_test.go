@@ -0,0 +1,335 @@
+package cmd_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	lsp "github.com/moonbite-org/moonbite/lsp/cmd"
+)
+
+type response struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// runs a server over the given requests and returns the messages it wrote
+func serve(t *testing.T, requests ...map[string]any) []response {
+	input := bytes.Buffer{}
+
+	for _, request := range requests {
+		request["jsonrpc"] = "2.0"
+		data, _ := json.Marshal(request)
+		fmt.Fprintf(&input, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+
+	output := bytes.Buffer{}
+	if _, err := lsp.New(&input, &output).Serve(); err != nil {
+		t.Fatalf("expected server to exit cleanly but got: %s", err)
+	}
+
+	result := []response{}
+	reader := bufio.NewReader(&output)
+
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		length, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		reader.ReadString('\n')
+
+		data := make([]byte, length)
+		io.ReadFull(reader, data)
+
+		var message response
+		json.Unmarshal(data, &message)
+		result = append(result, message)
+	}
+
+	return result
+}
+
+func find_response(t *testing.T, messages []response, id int, target any) {
+	for _, message := range messages {
+		if message.Id != nil && *message.Id == id {
+			if err := json.Unmarshal(message.Result, target); err != nil {
+				t.Fatalf("cannot decode result of request %d: %s", id, err)
+			}
+			return
+		}
+	}
+
+	t.Fatalf("no response to request %d", id)
+}
+
+func open(uri, text string) map[string]any {
+	return map[string]any{
+		"method": "textDocument/didOpen",
+		"params": map[string]any{"textDocument": map[string]any{"uri": uri, "version": 1, "text": text}},
+	}
+}
+
+func at(id int, method, uri string, line, character int) map[string]any {
+	return map[string]any{
+		"id":     id,
+		"method": method,
+		"params": map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": character},
+		},
+	}
+}
+
+const source = `package main
+
+type Point { x Int; y Int; }
+
+fun for Point length() Int {
+  return this.x + this.y
+}
+
+fun add(a Int, b Int) Int {
+  return a + b
+}
+
+fun main() {
+  var Point p
+  var total = add(1, 2)
+  p.
+}
+`
+
+func TestLifecycle(t *testing.T) {
+	messages := serve(t,
+		map[string]any{"id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"id": 2, "method": "unknown/method"},
+		map[string]any{"id": 3, "method": "shutdown"},
+		map[string]any{"method": "exit"},
+	)
+
+	var result struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	find_response(t, messages, 1, &result)
+
+	for _, capability := range []string{"definitionProvider", "hoverProvider", "documentSymbolProvider", "completionProvider"} {
+		if result.Capabilities[capability] == nil {
+			t.Errorf("expected server to provide %s", capability)
+		}
+	}
+
+	if messages[1].Error == nil || messages[1].Error.Code != -32601 {
+		t.Errorf("expected unknown methods to be reported as not found")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	uri := "file://" + path.Join(t.TempDir(), "main.mb")
+
+	messages := serve(t, open(uri, "package main\n\nvar Bool flag = 5\n\nvar = 1\n"), map[string]any{"method": "exit"})
+
+	var params struct {
+		URI         string `json:"uri"`
+		Diagnostics []struct {
+			Range struct {
+				Start struct {
+					Line int `json:"line"`
+				} `json:"start"`
+			} `json:"range"`
+			Message string `json:"message"`
+		} `json:"diagnostics"`
+	}
+
+	if len(messages) == 0 || messages[0].Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("expected diagnostics to be published")
+	}
+
+	json.Unmarshal(messages[0].Params, &params)
+
+	// type errors are not reported while there are syntax errors
+	if len(params.Diagnostics) != 1 || params.Diagnostics[0].Range.Start.Line != 4 {
+		t.Errorf("expected a syntax error at line 4 but got: %+v", params.Diagnostics)
+	}
+
+	messages = serve(t, open(uri, "package main\n\nvar Bool flag = 5\nvar String name = true\n"), map[string]any{"method": "exit"})
+	json.Unmarshal(messages[0].Params, &params)
+
+	if len(params.Diagnostics) != 2 {
+		t.Errorf("expected 2 type errors but got: %+v", params.Diagnostics)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	dir := t.TempDir()
+	uri := "file://" + path.Join(dir, "main.mb")
+
+	// the other files of the package are read from disk
+	os.WriteFile(path.Join(dir, "config.mb"), []byte("package main\n\nvar Int limit = 10\n"), 0644)
+
+	messages := serve(t,
+		open(uri, strings.Replace(source, "add(1, 2)", "add(1, limit)", 1)),
+		at(1, "textDocument/definition", uri, 14, 14),
+		at(2, "textDocument/hover", uri, 14, 7),
+		at(3, "textDocument/hover", uri, 5, 15),
+		at(4, "textDocument/definition", uri, 14, 22),
+		map[string]any{"method": "exit"},
+	)
+
+	var definition struct {
+		URI   string `json:"uri"`
+		Range struct {
+			Start struct {
+				Line      int `json:"line"`
+				Character int `json:"character"`
+			} `json:"start"`
+		} `json:"range"`
+	}
+
+	find_response(t, messages, 1, &definition)
+	if definition.URI != uri || definition.Range.Start.Line != 8 || definition.Range.Start.Character != 4 {
+		t.Errorf("expected 'add' to be defined at 8:4 but got: %+v", definition)
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+
+	find_response(t, messages, 2, &hover)
+	if !strings.Contains(hover.Contents.Value, "var Int total") {
+		t.Errorf("expected hover to show the type of 'total' but got: %s", hover.Contents.Value)
+	}
+
+	find_response(t, messages, 3, &hover)
+	if !strings.Contains(hover.Contents.Value, "x Int") {
+		t.Errorf("expected hover to show the type of field 'x' but got: %s", hover.Contents.Value)
+	}
+
+	find_response(t, messages, 4, &definition)
+	if !strings.HasSuffix(definition.URI, "config.mb") || definition.Range.Start.Line != 2 {
+		t.Errorf("expected 'limit' to be defined in config.mb but got: %+v", definition)
+	}
+}
+
+func TestUnicodeColumns(t *testing.T) {
+	uri := "file://" + path.Join(t.TempDir(), "main.mb")
+
+	// characters of the protocol are UTF-16 code units, the emoji takes two of them
+	messages := serve(t,
+		open(uri, "package main\n\nvar Int größe = 2\n\nfun main() {\n  io.println(\"😀\", größe)\n}\n"),
+		at(1, "textDocument/hover", uri, 5, 19),
+		at(2, "textDocument/definition", uri, 5, 23),
+		map[string]any{"method": "exit"},
+	)
+
+	var hover struct {
+		Range struct {
+			Start struct {
+				Character int `json:"character"`
+			} `json:"start"`
+			End struct {
+				Character int `json:"character"`
+			} `json:"end"`
+		} `json:"range"`
+	}
+
+	find_response(t, messages, 1, &hover)
+	if hover.Range.Start.Character != 19 || hover.Range.End.Character != 24 {
+		t.Errorf("expected hover to cover 'größe' from 19 to 24 but got: %+v", hover.Range)
+	}
+
+	var definition struct {
+		Range struct {
+			Start struct {
+				Line      int `json:"line"`
+				Character int `json:"character"`
+			} `json:"start"`
+		} `json:"range"`
+	}
+
+	find_response(t, messages, 2, &definition)
+	if definition.Range.Start.Line != 2 || definition.Range.Start.Character != 8 {
+		t.Errorf("expected 'größe' to be defined at 2:8 but got: %+v", definition)
+	}
+}
+
+func TestSymbolsAndCompletion(t *testing.T) {
+	uri := "file://" + path.Join(t.TempDir(), "main.mb")
+
+	messages := serve(t,
+		open(uri, strings.Replace(source, "package main\n", "package main\n\nuse \"std/io\" as io\n", 1)),
+		map[string]any{"id": 1, "method": "textDocument/documentSymbol", "params": map[string]any{"textDocument": map[string]any{"uri": uri}}},
+		// after 'p.' in main
+		at(2, "textDocument/completion", uri, 17, 4),
+		// at the start of the empty line of 'p.'
+		at(3, "textDocument/completion", uri, 17, 2),
+		map[string]any{"method": "exit"},
+	)
+
+	var symbols []struct {
+		Name     string `json:"name"`
+		Kind     int    `json:"kind"`
+		Children []struct {
+			Name string `json:"name"`
+		} `json:"children"`
+	}
+
+	find_response(t, messages, 1, &symbols)
+
+	names := []string{}
+	for _, symbol := range symbols {
+		names = append(names, symbol.Name)
+	}
+
+	if strings.Join(names, ",") != "Point,Point.length,add,main" {
+		t.Errorf("expected the definitions of the file as symbols but got: %v", names)
+	}
+
+	if len(symbols) > 0 && len(symbols[0].Children) != 2 {
+		t.Errorf("expected the fields of 'Point' as its children but got: %+v", symbols[0].Children)
+	}
+
+	var items []struct {
+		Label string `json:"label"`
+	}
+
+	labels := func() string {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item.Label)
+		}
+		return "," + strings.Join(result, ",") + ","
+	}
+
+	find_response(t, messages, 2, &items)
+	if labels() != ",length,x,y," {
+		t.Errorf("expected the fields and methods of 'Point' but got: %s", labels())
+	}
+
+	find_response(t, messages, 3, &items)
+	for _, expected := range []string{",p,", ",total,", ",add,", ",io,", ",Point,", ",var,", ",exit,"} {
+		if !strings.Contains(labels(), expected) {
+			t.Errorf("expected completion to contain %s but got: %s", expected, labels())
+		}
+	}
+
+	// the parameters of other functions are not visible
+	if strings.Contains(labels(), ",a,") {
+		t.Errorf("expected completion not to contain the parameters of 'add'")
+	}
+}
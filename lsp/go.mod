@@ -0,0 +1,3 @@
+module github.com/moonbite-org/moonbite/lsp
+
+go 1.21.0
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+
+	lsp "github.com/moonbite-org/moonbite/lsp/cmd"
+)
+
+// moonls is the language server of MoonBite, editors start it and talk to it over stdio
+func main() {
+	is_shutdown, err := lsp.New(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+
+	// the protocol asks for a failing exit code when the client exits without shutting the server down
+	if !is_shutdown {
+		os.Exit(1)
+	}
+}
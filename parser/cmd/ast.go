@@ -345,6 +345,12 @@ type Ast struct {
 	Uses        []UseStatement   `json:"uses"`
 	Package     PackageStatement `json:"package"`
 	Comments    []Comment        `json:"comments"`
+	// the file the tree is parsed from, kept so that edits to it can be parsed again
+	source []rune
+	tokens []Token
+	// how far the definitions Reparse reused are from where they were parsed
+	moves       []move
+	diagnostics errors.Diagnostics
 }
 
 // STATEMENTS
@@ -0,0 +1,860 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// the column after which collection literals are broken into one entry per line
+const max_line_width = 80
+
+type formatter struct {
+	input []rune
+	// every token of the file, used to recover the spelling of literals
+	tokens []Token
+	// the tokens that are not whitespace or comments together with the depth of braces they are in
+	significant []Token
+	depths      []int
+	comments    []Token
+	// the index of the first comment that is not written yet
+	next_comment int
+	output       []rune
+	indent       int
+	// the line being written is not indented yet
+	is_line_start bool
+	// nothing is written on the current level of braces yet
+	is_fresh bool
+	// the next line is separated by an empty line
+	is_separated bool
+}
+
+// Format pretty prints a file in the canonical layout of the language. The comments of
+// the file are kept next to the code they were written at. A file with syntax errors is
+// not formatted and its diagnostics are returned instead.
+func Format(input []byte, filepath string) ([]byte, errors.Diagnostics) {
+	ast, diagnostics := ParseAll(input, filepath)
+
+	if diagnostics.Exists() {
+		return nil, diagnostics
+	}
+
+	tokens, _ := lex(input, ast.FileName)
+	f := formatter{input: []rune(string(input)), tokens: tokens, is_fresh: true}
+	depth := 0
+
+	for _, token := range tokens {
+		switch token.Kind {
+		case whitespace, new_line, eof_token_kind:
+			continue
+		case single_line_comment, multi_line_comment:
+			f.comments = append(f.comments, token)
+			continue
+		case right_curly_bracks:
+			f.significant = append(f.significant, token)
+			f.depths = append(f.depths, depth)
+			depth--
+			continue
+		}
+
+		f.significant = append(f.significant, token)
+		f.depths = append(f.depths, depth)
+
+		if token.Kind == left_curly_bracks {
+			depth++
+		}
+	}
+
+	f.file(ast)
+
+	return []byte(string(f.output)), diagnostics
+}
+
+func (f *formatter) write(values ...string) {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+
+		if f.is_line_start {
+			f.output = append(f.output, []rune(strings.Repeat("  ", f.indent))...)
+			f.is_line_start = false
+		}
+
+		f.output = append(f.output, []rune(value)...)
+	}
+}
+
+func (f *formatter) newline() {
+	f.output = append(f.output, '\n')
+	f.is_line_start = true
+}
+
+// starts the line of the code at an offset, an empty line before it in the source is kept
+func (f *formatter) line(offset int) {
+	if f.is_fresh {
+		if len(f.output) > 0 {
+			f.newline()
+		}
+
+		f.is_fresh = false
+		f.is_separated = false
+		return
+	}
+
+	if f.is_separated || f.is_blank_before(offset) {
+		f.newline()
+	}
+
+	f.is_separated = false
+	f.newline()
+}
+
+// reports whether an empty line separates the code at an offset from the code before
+// it, members that share a line are not separated by the empty line before that line
+func (f *formatter) is_blank_before(offset int) bool {
+	lines := 0
+
+	for i := min(offset, len(f.input)) - 1; i >= 0; i-- {
+		switch f.input[i] {
+		case '\n':
+			lines++
+		case ' ', '\t', '\r':
+		default:
+			return lines > 1
+		}
+	}
+
+	return false
+}
+
+// reports whether there is code before an offset on its line
+func (f *formatter) follows_code(offset int) bool {
+	for i := offset - 1; i >= 0 && f.input[i] != '\n'; i-- {
+		if f.input[i] != ' ' && f.input[i] != '\t' && f.input[i] != '\r' {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *formatter) has_comments_before(offset int) bool {
+	return f.next_comment < len(f.comments) && f.comments[f.next_comment].Location.Offset < offset
+}
+
+// writes the comments that are before an offset and not written yet, a comment that
+// follows code on its line stays at the end of the line that is being written
+func (f *formatter) comments_before(offset int) {
+	for f.has_comments_before(offset) {
+		comment := f.comments[f.next_comment]
+		f.next_comment++
+
+		if f.follows_code(comment.Location.Offset) && !f.is_fresh {
+			f.write(" ", comment.Literal)
+			continue
+		}
+
+		f.line(comment.Location.Offset)
+		f.write(comment.Literal)
+	}
+}
+
+// the index of the first significant token at or after an offset
+func (f *formatter) token_at(offset int) int {
+	return sort.Search(len(f.significant), func(i int) bool {
+		return f.significant[i].Location.Offset >= offset
+	})
+}
+
+// the offset of the brace that closes the block that holds the token at an offset
+func (f *formatter) closing_brace(offset int) int {
+	i := f.token_at(offset)
+
+	if i >= len(f.significant) {
+		return len(f.input)
+	}
+
+	depth := f.depths[i]
+
+	for ; i < len(f.significant); i++ {
+		if f.significant[i].Kind == right_curly_bracks && f.depths[i] == depth {
+			return f.significant[i].Location.Offset
+		}
+	}
+
+	return len(f.input)
+}
+
+// the offset of the brace that closes the first block that opens after an offset
+func (f *formatter) closing_brace_after(offset int) int {
+	i := f.token_at(offset)
+
+	if i >= len(f.significant) {
+		return len(f.input)
+	}
+
+	depth := f.depths[i]
+
+	for ; i < len(f.significant); i++ {
+		if f.significant[i].Kind == left_curly_bracks && f.depths[i] == depth {
+			return f.closing_brace(f.significant[i].Location.Offset + 1)
+		}
+	}
+
+	return len(f.input)
+}
+
+// the source of the token at an offset if it is of a kind, literals are written as they are spelled
+func (f *formatter) spelling(offset int, kind token_kind) (string, bool) {
+	i := sort.Search(len(f.tokens), func(i int) bool {
+		return f.tokens[i].Location.Offset >= offset
+	})
+
+	if i >= len(f.tokens) || f.tokens[i].Location.Offset != offset || f.tokens[i].Kind != kind {
+		return "", false
+	}
+
+	end := len(f.input)
+	if i+1 < len(f.tokens) && f.tokens[i+1].Kind != eof_token_kind {
+		end = f.tokens[i+1].Location.Offset
+	}
+
+	return string(f.input[offset:end]), true
+}
+
+// writes the items of a braced block on their own lines together with the comments between them.
+// The block closes at the brace after the last item or, if it is empty, after the cursor.
+func (f *formatter) braced(cursor int, offsets []int, item func(i int)) {
+	closing := 0
+
+	if len(offsets) > 0 {
+		closing = f.closing_brace(offsets[len(offsets)-1])
+	} else {
+		closing = f.closing_brace_after(cursor)
+	}
+
+	if len(offsets) == 0 && !f.has_comments_before(closing) {
+		f.write("{}")
+		return
+	}
+
+	f.write("{")
+	f.indent++
+	f.is_fresh = true
+
+	for i, offset := range offsets {
+		f.comments_before(offset)
+		f.line(offset)
+		item(i)
+	}
+
+	f.comments_before(closing)
+	f.indent--
+	f.is_fresh = false
+	f.is_separated = false
+	f.newline()
+	f.write("}")
+}
+
+func (f *formatter) block(cursor int, body StatementList) {
+	statements := StatementList{}
+	offsets := []int{}
+
+	for _, statement := range body {
+		if statement.Kind() == SingleLineCommentStatementKind || statement.Kind() == MultiLineCommentStatementKind {
+			continue
+		}
+
+		statements = append(statements, statement)
+		offsets = append(offsets, statement.Location().Offset)
+	}
+
+	f.braced(cursor, offsets, func(i int) {
+		f.statement(statements[i])
+	})
+}
+
+func (f *formatter) file(ast Ast) {
+	f.comments_before(ast.Package.Location().Offset)
+	f.line(ast.Package.Location().Offset)
+	f.write("package ", ast.Package.Name.Value)
+	f.is_separated = true
+
+	for _, use := range ast.Uses {
+		f.comments_before(use.Location().Offset)
+		f.line(use.Location().Offset)
+		f.statement(use)
+	}
+
+	if len(ast.Uses) > 0 {
+		f.is_separated = true
+	}
+
+	for _, definition := range ast.Definitions {
+		if definition.Kind() == SingleLineCommentStatementKind || definition.Kind() == MultiLineCommentStatementKind {
+			continue
+		}
+
+		f.comments_before(definition.Location().Offset)
+		f.line(definition.Location().Offset)
+		f.statement(definition)
+	}
+
+	f.comments_before(len(f.input) + 1)
+	f.newline()
+}
+
+func (f *formatter) hidden(is_hidden bool) {
+	if is_hidden {
+		f.write("hidden ")
+	}
+}
+
+func (f *formatter) statement(statement Statement) {
+	switch statement.Kind() {
+	case UseStatementKind:
+		use := statement.(UseStatement)
+		f.write("use ")
+		f.literal(use.Resource)
+
+		if use.As != nil {
+			f.write(" as ", use.As.Value)
+		}
+	case DeclarationStatementKind:
+		f.declaration(statement.(DeclarationStatement))
+	case AssignmentStatementKind:
+		assignment := statement.(AssignmentStatement)
+		f.expression(assignment.LeftHandSide)
+		f.write(" ", assignment.Operator.Literal, " ")
+		f.expression(assignment.RightHandSide)
+	case ExpressionStatementKind:
+		f.expression(statement.(ExpressionStatement).Expression)
+	case ReturnStatementKind:
+		f.write("return")
+
+		if value := statement.(ReturnStatement).Value; value != nil && *value != nil {
+			f.write(" ")
+			f.expression(*value)
+		}
+	case YieldStatementKind:
+		f.write("yield")
+
+		if value := statement.(YieldStatement).Value; value != nil && *value != nil {
+			f.write(" ")
+			f.expression(*value)
+		}
+	case DeferStatementKind:
+		f.write("defer ")
+		f.expression(statement.(DeferStatement).Value)
+	case BreakStatementKind:
+		f.write("break")
+	case ContinueStatementKind:
+		f.write("continue")
+	case TypeDefinitionStatementKind:
+		definition := statement.(TypeDefinitionStatement)
+		f.hidden(definition.Hidden)
+		f.write("type ", definition.Name.Value)
+		f.generics(definition.Generics)
+
+		if len(definition.Implementations) > 0 {
+			f.write(" implements [")
+			for i, implementation := range definition.Implementations {
+				f.separator(i)
+				f.type_literal(implementation)
+			}
+			f.write("]")
+		}
+
+		f.write(" ")
+
+		// the fields of a defined struct go on their own lines
+		if definition.Definition.TypeKind() == StructLiteralKind {
+			fields := definition.Definition.(StructLiteral).Values
+			offsets := []int{}
+
+			for _, field := range fields {
+				offsets = append(offsets, field.Location.Offset)
+			}
+
+			f.braced(definition.Definition.Location().Offset, offsets, func(i int) {
+				f.field(fields[i])
+			})
+		} else {
+			f.type_literal(definition.Definition)
+		}
+	case TraitDefinitionStatementKind:
+		definition := statement.(TraitDefinitionStatement)
+		f.hidden(definition.Hidden)
+		f.write("trait ", definition.Name.Value)
+		f.generics(definition.Generics)
+
+		if len(definition.Mimics) > 0 {
+			f.write(" mimics [")
+			for i, mimic := range definition.Mimics {
+				f.separator(i)
+				f.type_literal(mimic)
+			}
+			f.write("]")
+		}
+
+		f.write(" ")
+		offsets := []int{}
+
+		for _, signature := range definition.Definition {
+			offsets = append(offsets, signature.location.Offset)
+		}
+
+		f.braced(definition.Location().Offset, offsets, func(i int) {
+			signature := definition.Definition[i]
+			f.write("fun ", signature.Name.Value)
+			f.signature(signature.Generics, signature.Parameters, signature.ReturnType)
+			f.write(";")
+		})
+	case UnboundFunDefinitionStatementKind:
+		definition := statement.(*UnboundFunDefinitionStatement)
+		f.hidden(definition.Hidden)
+		f.write("fun ", definition.Signature.Name.Value)
+		f.signature(definition.Signature.Generics, definition.Signature.Parameters, definition.Signature.ReturnType)
+		f.write(" ")
+		f.block(definition.Location().Offset, definition.Body)
+	case BoundFunDefinitionStatementKind:
+		definition := statement.(*BoundFunDefinitionStatement)
+		f.hidden(definition.Hidden)
+		f.write("fun for ")
+		f.type_literal(definition.Signature.For)
+		f.write(" ", definition.Signature.Name.Value)
+		f.signature(definition.Signature.Generics, definition.Signature.Parameters, definition.Signature.ReturnType)
+		f.write(" ")
+		f.block(definition.Location().Offset, definition.Body)
+	case IfStatementKind:
+		statement := statement.(IfStatement)
+		f.write("if (")
+		f.expression(statement.MainBlock.Predicate)
+		f.write(") ")
+		f.block(statement.Location().Offset, statement.MainBlock.Body)
+
+		for _, block := range statement.ElseIfBlocks {
+			f.write(" else if (")
+			f.expression(block.Predicate)
+			f.write(") ")
+			f.block(block.Predicate.Location().Offset, block.Body)
+		}
+
+		if len(statement.ElseBlock) > 0 {
+			f.write(" else ")
+			f.block(statement.ElseBlock[0].Location().Offset, statement.ElseBlock)
+		}
+	case LoopStatementKind:
+		statement := statement.(LoopStatement)
+		f.write("for (")
+		f.loop_predicate(statement.Predicate)
+		f.write(") ")
+		f.block(statement.Location().Offset, statement.Body)
+	}
+}
+
+func (f *formatter) declaration(declaration DeclarationStatement) {
+	f.hidden(declaration.Hidden)
+	f.write(string(declaration.VarKind), " ")
+
+	if declaration.Type != nil && *declaration.Type != nil {
+		f.type_literal(*declaration.Type)
+		f.write(" ")
+	}
+
+	f.write(declaration.Name.Value)
+
+	if declaration.Value != nil && *declaration.Value != nil {
+		f.write(" = ")
+		f.expression(*declaration.Value)
+	}
+}
+
+func (f *formatter) loop_predicate(predicate LoopPredicate) {
+	switch predicate.LoopKind() {
+	case UnipartiteLoopKind:
+		f.expression(predicate.(UnipartiteLoopPredicate).Expression)
+	case BipartiteLoopKind:
+		predicate := predicate.(BipartiteLoopPredicate)
+
+		if predicate.Key != nil {
+			f.write(predicate.Key.Value)
+		}
+
+		f.write(",")
+
+		if predicate.Value != nil {
+			f.write(" ", predicate.Value.Value)
+		}
+
+		f.write(" of ")
+		f.expression(predicate.Iterator)
+	case TripartiteLoopKind:
+		predicate := predicate.(TripartiteLoopPredicate)
+
+		if predicate.Declaration != nil {
+			f.declaration(*predicate.Declaration)
+		}
+
+		f.write("; ")
+		f.expression(predicate.Predicate)
+		f.write(";")
+
+		if predicate.Procedure != nil && *predicate.Procedure != nil {
+			f.write(" ")
+			f.expression(*predicate.Procedure)
+		}
+	}
+}
+
+func (f *formatter) separator(i int) {
+	if i > 0 {
+		f.write(", ")
+	}
+}
+
+func (f *formatter) generics(generics map[string]ConstrainedType) {
+	if len(generics) == 0 {
+		return
+	}
+
+	sorted := []ConstrainedType{}
+	for _, generic := range generics {
+		sorted = append(sorted, generic)
+	}
+
+	slices.SortFunc(sorted, func(a, b ConstrainedType) int {
+		return a.Index - b.Index
+	})
+
+	f.write("<")
+	for i, generic := range sorted {
+		f.separator(i)
+		f.write(generic.Name.Value)
+
+		if generic.Constraint != nil && *generic.Constraint != nil {
+			f.write(" ")
+			f.type_literal(*generic.Constraint)
+		}
+	}
+	f.write(">")
+}
+
+func (f *formatter) signature(generics map[string]ConstrainedType, parameters []TypedParameter, return_type *TypeLiteral) {
+	f.generics(generics)
+	f.write("(")
+
+	for i, parameter := range parameters {
+		f.separator(i)
+
+		if parameter.Variadic {
+			f.write("...")
+		}
+
+		f.write(parameter.Name.Value, " ")
+		f.type_literal(parameter.Type)
+	}
+
+	f.write(")")
+
+	if return_type != nil && *return_type != nil {
+		f.write(" ")
+		f.type_literal(*return_type)
+	}
+}
+
+func (f *formatter) field(field ValueTypePair) {
+	f.hidden(field.Hidden)
+	f.write(field.Key.Value, " ")
+	f.type_literal(field.Type)
+	f.write(";")
+}
+
+func (f *formatter) type_literal(literal TypeLiteral) {
+	switch literal.TypeKind() {
+	case TypeIdentifierKind:
+		identifier := literal.(TypeIdentifier)
+		f.expression(identifier.Name)
+
+		if len(identifier.Generics) > 0 {
+			f.write("<")
+			for i := 0; i < len(identifier.Generics); i++ {
+				f.separator(i)
+				f.type_literal(identifier.Generics[i])
+			}
+			f.write(">")
+		}
+	case StructLiteralKind:
+		values := literal.(StructLiteral).Values
+
+		if len(values) == 0 {
+			f.write("{}")
+			return
+		}
+
+		f.write("{ ")
+		for _, value := range values {
+			f.field(value)
+			f.write(" ")
+		}
+		f.write("}")
+	case OperatedTypeKind:
+		operated := literal.(OperatedType)
+		f.type_literal(operated.LeftHandSide)
+		f.write(" ", operated.Operator.Literal, " ")
+		f.type_literal(operated.RightHandSide)
+	case TypedLiteralKind:
+		typed := literal.(TypedLiteral)
+		f.type_literal(typed.Type)
+		f.write("(")
+		f.literal(typed.Literal)
+		f.write(")")
+	case GroupTypeKind:
+		f.write("(")
+		f.type_literal(literal.(GroupType).Type)
+		f.write(")")
+	case FunTypeKind:
+		signature := literal.(AnonymousFunctionSignature)
+		f.write("fun")
+		f.signature(signature.Generics, signature.Parameters, signature.ReturnType)
+	}
+}
+
+func (f *formatter) literal(literal LiteralExpression) {
+	offset := literal.Location().Offset
+
+	switch literal.LiteralKind() {
+	case StringLiteralKind:
+		if spelling, ok := f.spelling(offset, string_literal); ok {
+			f.write(spelling)
+		} else {
+			f.write(fmt.Sprintf("%q", literal.(StringLiteralExpression).Value))
+		}
+	case RuneLiteralKind:
+		if spelling, ok := f.spelling(offset, rune_literal); ok {
+			f.write(spelling)
+		} else {
+			f.write(fmt.Sprintf("%q", literal.(RuneLiteralExpression).Value))
+		}
+	case NumberLiteralKind:
+		if spelling, ok := f.spelling(offset, number_literal); ok {
+			f.write(spelling)
+		} else {
+			f.write(fmt.Sprint(literal.(NumberLiteralExpression).Value.Value))
+		}
+	case BoolLiteralKind:
+		f.write(fmt.Sprint(literal.(BoolLiteralExpression).Value))
+	case ListLiteralKind:
+		f.entries("[", "]", literal.(ListLiteralExpression).Value, false)
+	case MapLiteralKind:
+		f.entries("{", "}", literal.(MapLiteralExpression).Value, true)
+	case InstanceLiteralKind:
+		instance := literal.(InstanceLiteralExpression)
+		f.type_literal(instance.Type)
+		f.entries("{", "}", instance.Value, true)
+	}
+}
+
+// writes the entries of a collection literal on the line they start at if they fit in it
+// and on a line of their own otherwise
+func (f *formatter) entries(opener, closer string, entries []KeyValueEntry, is_keyed bool) {
+	if len(entries) == 0 {
+		f.write(opener, closer)
+		return
+	}
+
+	entry := func(entry KeyValueEntry) {
+		if is_keyed {
+			f.write(entry.Key.Value, ": ")
+		}
+
+		f.expression(entry.Value)
+	}
+
+	state := *f
+	padding := ""
+
+	if is_keyed {
+		padding = " "
+	}
+
+	f.write(opener, padding)
+	for i, value := range entries {
+		f.separator(i)
+		entry(value)
+	}
+	f.write(padding, closer)
+
+	written := f.output[len(state.output):]
+
+	if !slices.Contains(written, '\n') && f.column() <= max_line_width {
+		return
+	}
+
+	*f = state
+	f.write(opener)
+	f.indent++
+
+	for i, value := range entries {
+		f.newline()
+		entry(value)
+
+		// lists cannot end with a separator
+		if is_keyed || i < len(entries)-1 {
+			f.write(",")
+		}
+	}
+
+	f.indent--
+	f.newline()
+	f.write(closer)
+}
+
+// the number of characters on the last line of the output
+func (f *formatter) column() int {
+	for i := len(f.output) - 1; i >= 0; i-- {
+		if f.output[i] == '\n' {
+			return len(f.output) - i - 1
+		}
+	}
+
+	return len(f.output)
+}
+
+func (f *formatter) operation(lhs Expression, operator string, rhs Expression) {
+	f.expression(lhs)
+	f.write(" ", operator, " ")
+	f.expression(rhs)
+}
+
+func (f *formatter) expression(expression Expression) {
+	if expression == nil {
+		return
+	}
+
+	switch expression.Kind() {
+	case IdentifierExpressionKind:
+		f.write(expression.(IdentifierExpression).Value)
+	case ArithmeticExpressionKind:
+		arithmetic := expression.(ArithmeticExpression)
+		f.operation(arithmetic.LeftHandSide, arithmetic.Operator.Literal, arithmetic.RightHandSide)
+	case BinaryExpressionKind:
+		binary := expression.(BinaryExpression)
+		f.operation(binary.LeftHandSide, binary.Operator.Literal, binary.RightHandSide)
+	case ComparisonExpressionKind:
+		comparison := expression.(ComparisonExpression)
+		f.operation(comparison.LeftHandSide, comparison.Operator.Literal, comparison.RightHandSide)
+	case CallExpressionKind:
+		call := expression.(CallExpression)
+		f.expression(call.Callee)
+		f.write("(")
+		for i, argument := range call.Arguments {
+			f.separator(i)
+			f.expression(argument)
+		}
+		f.write(")")
+	case WarnExpressionKind:
+		f.write("warn(")
+		f.expression(expression.(WarnExpression).Argument)
+		f.write(")")
+	case MemberExpressionKind:
+		member := expression.(MemberExpression)
+
+		// a member of the value that is matched is written without it
+		if member.LeftHandSide.Kind() != MatchSelfExpressionKind {
+			f.expression(member.LeftHandSide)
+		}
+
+		f.write(".", member.RightHandSide.Value)
+	case IndexExpressionKind:
+		index := expression.(IndexExpression)
+		f.expression(index.Host)
+		f.write("[")
+		f.expression(index.Index)
+		f.write("]")
+	case MatchExpressionKind:
+		match := expression.(MatchExpression)
+		f.write("match (")
+		f.expression(match.Against)
+		f.write(") ")
+
+		offsets := []int{}
+		for _, block := range match.Blocks {
+			offsets = append(offsets, block.Predicate.Location().Offset)
+		}
+
+		f.braced(match.Location().Offset, offsets, func(i int) {
+			f.write("(")
+			f.expression(match.Blocks[i].Predicate)
+			f.write(") ")
+			f.block(match.Blocks[i].Predicate.Location().Offset, match.Blocks[i].Body)
+
+			if i == len(match.Blocks)-1 && len(match.BaseBlock) > 0 {
+				f.newline()
+				f.write("base ")
+				f.block(match.BaseBlock[0].Location().Offset, match.BaseBlock)
+			}
+		})
+	case TypeCastExpressionKind:
+		cast := expression.(TypeCastExpression)
+		f.expression(cast.Value)
+		f.write(".(")
+		f.type_literal(cast.Type)
+		f.write(")")
+	case CaretExpressionKind:
+		f.write("^")
+	case InstanceofExpressionKind:
+		instanceof := expression.(InstanceofExpression)
+		f.expression(instanceof.LeftHandSide)
+		f.write(" instanceof ")
+		f.type_literal(instanceof.RightHandSide)
+	case MatchSelfExpressionKind:
+		f.write(".")
+	case GroupExpressionKind:
+		f.write("(")
+		f.expression(expression.(GroupExpression).Expression)
+		f.write(")")
+	case ThisExpressionKind:
+		f.write("this")
+	case ArithmeticUnaryExpressionKind:
+		unary := expression.(ArithmeticUnaryExpression)
+		f.expression(unary.Expression)
+
+		if unary.Operation == IncrementKind {
+			f.write("++")
+		} else {
+			f.write("--")
+		}
+	case AnonymousFunExpressionKind:
+		f.fun(expression.(AnonymousFunExpression))
+	case CoroutFunExpressionKind:
+		f.write("corout ")
+		f.fun(expression.(CoroutFunExpression).Fun)
+	case GenFunExpressionKind:
+		f.write("gen ")
+		f.fun(expression.(GenFunExpression).Fun)
+	case OrExpressionKind:
+		or := expression.(OrExpression)
+		f.operation(or.LeftHandSide, "or", or.RightHandSide)
+	case NotExpressionKind:
+		f.write("!")
+		f.expression(expression.(NotExpression).Expression)
+	case GiveupExpressionKind:
+		f.write("give up")
+	default:
+		if literal, ok := expression.(LiteralExpression); ok {
+			f.literal(literal)
+		}
+	}
+}
+
+func (f *formatter) fun(fun AnonymousFunExpression) {
+	f.write("fun")
+	f.signature(fun.Signature.Generics, fun.Signature.Parameters, fun.Signature.ReturnType)
+	f.write(" ")
+	f.block(fun.Location().Offset, fun.Body)
+}
@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"sort"
+
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// Edit replaces the runes of a file from Start up to End with Text, the offsets count runes
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Reparse parses a file again after an edit to it. previous must be returned by ParseAll
+// or Reparse. Only the tokens of the top-level definition that holds the edit are lexed
+// and parsed again, the other definitions are reused. The definitions after the edit
+// keep the locations they were parsed with, Locate gives where they are after the edit.
+// The whole file is parsed again if the edit is not within a single definition or if
+// the file has syntax errors.
+func Reparse(previous Ast, edit Edit) (Ast, errors.Diagnostics) {
+	edit.Start = min(max(edit.Start, 0), len(previous.source))
+	edit.End = min(max(edit.End, edit.Start), len(previous.source))
+
+	text := []rune(edit.Text)
+	source := make([]rune, 0, len(previous.source)-(edit.End-edit.Start)+len(text))
+	source = append(source, previous.source[:edit.Start]...)
+	source = append(source, text...)
+	source = append(source, previous.source[edit.End:]...)
+
+	if ast, ok := reparse(previous, edit, source); ok {
+		return ast, ast.diagnostics
+	}
+
+	return parse(source, previous.FilePath)
+}
+
+// the index of the first token at or after an offset
+func token_index(tokens []Token, offset int) int {
+	return sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].Location.Offset >= offset
+	})
+}
+
+// Locate gives where a location in a definition of the tree is in the source of the tree.
+// The definitions Reparse reuses are not changed, so their locations are moved when
+// they are read.
+func (a Ast) Locate(definition int, location errors.Location) errors.Location {
+	if definition < 0 || definition >= len(a.moves) {
+		return location
+	}
+
+	return a.moves[definition].apply(location)
+}
+
+// the offset a top-level definition starts at, hidden functions are located at their fun keyword
+func (a Ast) start_of(index int) int {
+	offset := a.Locate(index, a.Definitions[index].Location()).Offset
+	i := token_index(a.tokens, offset) - 1
+
+	for i >= 0 && (a.tokens[i].Kind == whitespace || a.tokens[i].Kind == new_line) {
+		i--
+	}
+
+	if i >= 0 && a.tokens[i].Kind == hidden_keyword {
+		return a.tokens[i].Location.Offset
+	}
+
+	return offset
+}
+
+func reparse(previous Ast, edit Edit, source []rune) (Ast, bool) {
+	if previous.diagnostics.Exists() || len(previous.tokens) == 0 {
+		return Ast{}, false
+	}
+
+	// the definition that holds the edit, it ends where the next one starts
+	index := -1
+	start, end := 0, 0
+
+	for i := range previous.Definitions {
+		start = previous.start_of(i)
+		end = len(previous.source) + 1
+
+		if i+1 < len(previous.Definitions) {
+			end = previous.start_of(i + 1)
+		}
+
+		if start <= edit.Start && edit.End < end {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		return Ast{}, false
+	}
+
+	delta := len(source) - len(previous.source)
+	first := token_index(previous.tokens, start)
+	last := token_index(previous.tokens, end)
+	new_end := min(end+delta, len(source))
+
+	tokens, diagnostics := lex_from(source[:new_end], previous.tokens[first].Location)
+	if diagnostics.Exists() {
+		return Ast{}, false
+	}
+
+	p := parser_s{
+		input:        source[:new_end],
+		tokens:       tokens,
+		body_context: []token_kind{},
+	}
+
+	result := p.parse_top_level_statements()
+
+	// the edit turned the definition into something that is not one
+	if p.diagnostics.Exists() || len(result.Uses) > 0 {
+		return Ast{}, false
+	}
+
+	// the tokens after the definition move by the runes and lines the edit added, and
+	// the ones on the line it ends at move by the columns it added
+	s := shift{offset: end, delta: delta}
+
+	if last < len(previous.tokens) {
+		old_start := previous.tokens[last].Location.Start
+		lexer := lexer{input: source, location: previous.tokens[first].Location}
+		new_start := lexer.location_at(new_end).Start
+
+		s.line = old_start.Line
+		s.lines = new_start.Line - old_start.Line
+		s.columns = new_start.Column - old_start.Column
+	}
+
+	ast := Ast{
+		FileName:    previous.FileName,
+		FilePath:    previous.FilePath,
+		Definitions: make([]Definition, 0, len(previous.Definitions)-1+len(result.Definitions)),
+		Uses:        previous.Uses,
+		Package:     previous.Package,
+		Comments:    []Comment{},
+		source:      source,
+		tokens:      make([]Token, 0, first+len(tokens)+len(previous.tokens)-last),
+		moves:       make([]move, 0, len(previous.Definitions)-1+len(result.Definitions)),
+		diagnostics: errors.Diagnostics{},
+	}
+
+	ast.tokens = append(ast.tokens, previous.tokens[:first]...)
+	ast.tokens = append(ast.tokens, tokens...)
+
+	for _, token := range previous.tokens[last:] {
+		token.Location = s.apply(token.Location)
+		token.Offset += delta
+		ast.tokens = append(ast.tokens, token)
+	}
+
+	ast.Definitions = append(ast.Definitions, previous.Definitions[:index]...)
+	ast.Definitions = append(ast.Definitions, result.Definitions...)
+
+	for i := range previous.Definitions[:index] {
+		ast.moves = append(ast.moves, previous.move_of(i))
+	}
+
+	for range result.Definitions {
+		ast.moves = append(ast.moves, move{})
+	}
+
+	for i, definition := range previous.Definitions[index+1:] {
+		ast.Definitions = append(ast.Definitions, definition)
+		ast.moves = append(ast.moves, previous.move_of(index+1+i).then(s, definition.Location()))
+	}
+
+	for _, definition := range ast.Definitions {
+		if comment, ok := definition.(Comment); ok {
+			ast.Comments = append(ast.Comments, comment)
+		}
+	}
+
+	return ast, true
+}
+
+// moves the locations after an offset by the runes and lines an edit added before them
+type shift struct {
+	offset int
+	delta  int
+	// the line the edit ends at, the locations that start on it move by columns too
+	line    int
+	lines   int
+	columns int
+}
+
+func (s shift) apply(location errors.Location) errors.Location {
+	if location.Offset < s.offset {
+		return location
+	}
+
+	if location.Start.Line == s.line {
+		location.Start.Column += s.columns
+		location.End.Column += s.columns
+	}
+
+	location.Offset += s.delta
+	location.Start.Line += s.lines
+	location.End.Line += s.lines
+
+	return location
+}
+
+// move is how far a definition that Reparse reused is from where it was parsed. The
+// definitions after an edit are on the lines after it, except for the one that starts
+// on the line the edit ends at, so only the line a definition starts at moves by columns.
+type move struct {
+	delta int
+	lines int
+	// the line the definition starts at when it is parsed
+	line    int
+	columns int
+}
+
+func (m move) apply(location errors.Location) errors.Location {
+	if location.Start.Line == m.line {
+		location.Start.Column += m.columns
+		location.End.Column += m.columns
+	}
+
+	location.Offset += m.delta
+	location.Start.Line += m.lines
+	location.End.Line += m.lines
+
+	return location
+}
+
+// the move of a definition after it is moved by another edit, start is the location
+// the definition is parsed with
+func (m move) then(s shift, start errors.Location) move {
+	if m.apply(start).Start.Line == s.line {
+		m.columns += s.columns
+	}
+
+	m.line = start.Start.Line
+	m.delta += s.delta
+	m.lines += s.lines
+
+	return m
+}
+
+func (a Ast) move_of(definition int) move {
+	if definition < len(a.moves) {
+		return a.moves[definition]
+	}
+
+	return move{}
+}
@@ -10,11 +10,11 @@ import (
 )
 
 type lexer struct {
-	input    []rune
-	offset   int
-	tokens   []Token
-	location errors.Location
-	error    errors.Error
+	input       []rune
+	offset      int
+	tokens      []Token
+	location    errors.Location
+	diagnostics errors.Diagnostics
 }
 
 var keywords = map[string]token_kind{
@@ -48,16 +48,55 @@ var keywords = map[string]token_kind{
 	"yield":      yield_keyword,
 }
 
+// Keywords returns the reserved words of the language in alphabetical order
+func Keywords() []string {
+	result := []string{}
+
+	for keyword := range keywords {
+		result = append(result, keyword)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
 var bool_literals = []string{"true", "false"}
 var cardinal_literals = []string{"bool", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64"}
 
 func (l *lexer) throw(reason string) {
-	l.error = errors.Error{
+	l.diagnostics.Add(errors.Error{
 		Kind:     errors.SyntaxError,
 		Reason:   reason,
 		Location: l.location,
 		Exists:   true,
+	})
+}
+
+// skips the runes of a token that could not be lexed so that lexing can go on after it
+func (l *lexer) skip_to(offset int) {
+	l.location = l.location_at(offset)
+	l.offset = offset
+}
+
+// the location of an offset that is not before the current location. Every rune of
+// the input is counted, including the ones like quotes that are not part of a token.
+func (l lexer) location_at(offset int) errors.Location {
+	location := l.location
+
+	for i := location.Offset; i < offset && i < len(l.input); i++ {
+		if l.input[i] == '\n' {
+			location.Start.Line++
+			location.Start.Column = 1
+		} else {
+			location.Start.Column++
+		}
 	}
+
+	location.Offset = offset
+	location.End = location.Start
+
+	return location
 }
 
 func (l lexer) next_rune() rune {
@@ -129,8 +168,14 @@ func (l lexer) create_token(kind token_kind, length int) Token {
 		literal = []rune(strings.ReplaceAll(string(literal), "\\", ""))
 	}
 
-	location := l.location
-	location.End.Column = location.Start.Column + length
+	// the location of a quoted literal starts at its opening quote
+	start := l.offset
+	if kind == string_literal || kind == rune_literal {
+		start--
+	}
+
+	location := l.location_at(start)
+	location.End.Column = location.Start.Column + l.offset + length - start
 	location.End.Line = location.Start.Line + line_breaks
 
 	return Token{
@@ -144,28 +189,31 @@ func (l lexer) create_token(kind token_kind, length int) Token {
 }
 
 func (l *lexer) register_token(token Token) {
-	if token.LineBreaks != 0 {
-		l.location.Start.Column = 1
-	} else {
-		l.location.Start.Column += len(token.Raw)
-	}
-
-	l.location.Start.Line += token.LineBreaks
-	l.location.Offset += len(token.Raw)
-
+	l.location = l.location_at(token.Offset + len(token.Raw))
 	l.tokens = append(l.tokens, token)
 	l.advance_by(len(token.Raw))
 }
 
-func lex(input []byte, filename string) ([]Token, errors.Error) {
+func lex(input []byte, filename string) ([]Token, errors.Diagnostics) {
+	return lex_from([]rune(string(input)), file_start(filename))
+}
+
+// the location of the first rune of a file
+func file_start(filename string) errors.Location {
+	return errors.Location{
+		Start:  errors.Position{Line: 1, Column: 1},
+		End:    errors.Position{Line: 1, Column: 1},
+		Offset: 0,
+		File:   filename,
+	}
+}
+
+// lexes the input from the offset of a location to its end
+func lex_from(input []rune, location errors.Location) ([]Token, errors.Diagnostics) {
 	lexer := lexer{
-		input: []rune(string(input)),
-		location: errors.Location{
-			Start:  errors.Position{Line: 1, Column: 1},
-			End:    errors.Position{Line: 1, Column: 1},
-			Offset: 0,
-			File:   filename,
-		},
+		input:    input,
+		offset:   location.Offset,
+		location: location,
 	}
 
 	control_chars := []rune{'(', ')', '<', '>', '[', ']', '{', '}', '.', ',', ':', ';'}
@@ -173,9 +221,8 @@ func lex(input []byte, filename string) ([]Token, errors.Error) {
 
 	current := lexer.current_rune()
 	for lexer.current_rune() != eof {
-		if lexer.error.Exists {
-			return []Token{}, lexer.error
-		}
+		found := len(lexer.diagnostics)
+		registered := len(lexer.tokens)
 
 		switch {
 		case unicode.IsSpace(current):
@@ -195,10 +242,16 @@ func lex(input []byte, filename string) ([]Token, errors.Error) {
 		default:
 			lexer.lex_alpha_numeric()
 		}
+
+		// the rune an error is found at is skipped unless the error still produced a token
+		if len(lexer.diagnostics) > found && len(lexer.tokens) == registered {
+			lexer.skip_to(lexer.offset + 1)
+		}
+
 		current = lexer.current_rune()
 	}
 
-	return lexer.tokens, errors.Error{}
+	return lexer.tokens, lexer.diagnostics
 }
 
 func (l *lexer) lex_whitespace() {
@@ -238,6 +291,9 @@ func (l *lexer) lex_string_literal() {
 
 	if l.next_rune() == eof || l.next_rune() == '\n' || l.next_rune() == '\r' {
 		l.throw(fmt.Sprintf(errors.ErrorMessages["u_eof"], "a '\"' (double quote) to close the string literal"))
+		// the literal still ends the line so that the parser does not trip over it
+		l.backup_by(length - 1)
+		l.register_token(l.create_token(string_literal, length))
 	} else {
 		l.backup_by(length - 1)
 		l.register_token(l.create_token(string_literal, length))
@@ -259,6 +315,8 @@ func (l *lexer) lex_multi_line_string_literal() {
 
 	if l.next_rune() == eof {
 		l.throw(fmt.Sprintf(errors.ErrorMessages["u_eof"], "a '`' (back quote) to close the multiline string literal"))
+		l.backup_by(length - 1)
+		l.register_token(l.create_token(string_literal, length))
 	} else {
 		l.backup_by(length - 1)
 		l.register_token(l.create_token(string_literal, length))
@@ -280,6 +338,8 @@ func (l *lexer) lex_rune_literal() {
 
 	if l.next_rune() == eof || l.next_rune() == '\n' || l.next_rune() == '\r' {
 		l.throw(fmt.Sprintf(errors.ErrorMessages["u_eof"], "a \"'\" (single quote) to close the rune literal"))
+		l.backup_by(length - 1)
+		l.register_token(l.create_token(rune_literal, length))
 	} else {
 		// if length == 1 {
 		// 	l.backup_by(length - 1)
@@ -297,14 +357,10 @@ func (l *lexer) lex_rune_literal() {
 func (l *lexer) lex_number_literal() {
 	length := 1
 
-	if l.current_rune() == '0' {
-		if unicode.IsDigit(l.next_rune()) {
-			l.throw("malformed number")
-			return
-		} else {
-			l.register_token(l.create_token(number_literal, 1))
-			return
-		}
+	// a leading zero is only followed by a fraction, as in 0.5
+	if l.current_rune() == '0' && unicode.IsDigit(l.next_rune()) {
+		l.throw("malformed number")
+		return
 	}
 
 	for unicode.IsDigit(l.next_rune()) {
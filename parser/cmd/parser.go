@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 	"reflect"
+	"slices"
 
 	errors "github.com/moonbite-org/moonbite/error"
 )
@@ -14,11 +15,18 @@ var function_context = []token_kind{return_keyword}
 var loop_context = []token_kind{break_keyword, continue_keyword}
 var predicate_body_context = []token_kind{}
 
+// statements start with these keywords at the start of a line, the parser
+// continues from them after a statement that cannot be parsed
+var top_level_keywords = []token_kind{use_keyword, type_keyword, trait_keyword, fun_keyword, var_keyword, const_keyword, hidden_keyword}
+
 type parser_s struct {
-	input                 []byte
-	offset                int
-	tokens                []Token
-	error                 errors.Error
+	input       []rune
+	offset      int
+	tokens      []Token
+	diagnostics errors.Diagnostics
+	// set by the first error of a statement, the errors that follow it are
+	// not reported until the parser continues with the next statement
+	recovering            bool
 	ast                   Ast
 	expressions           []Expression
 	is_match_context      bool
@@ -86,18 +94,48 @@ func (p *parser_s) parse_program() {
 }
 
 func (p *parser_s) parse_top_level_statements() TopLevelResult {
-	defer p.catch()
-
-	token := p.might_only_expect([]token_kind{use_keyword, type_keyword, trait_keyword, fun_keyword, var_keyword, const_keyword, single_line_comment, multi_line_comment, hidden_keyword})
-
 	result := TopLevelResult{
 		Definitions: []Definition{},
 		Uses:        []UseStatement{},
 		Comments:    []Comment{},
 	}
 
+	// the package statement could not be parsed
+	if p.recovering {
+		p.synchronise_top_level()
+	}
+
+	for {
+		state := p.save()
+		statement, done := p.parse_top_level_statement()
+
+		// a statement that does not move the parser forward would be parsed forever
+		if !done && p.offset == state.offset {
+			p.report(fmt.Sprintf(errors.ErrorMessages["u_tok"], token_map[p.current_token().Kind]))
+		}
+
+		// a statement that cannot be parsed is left out and parsing continues with the next one
+		if p.recovering {
+			p.restore(state)
+			p.synchronise_top_level()
+			continue
+		}
+
+		if done {
+			return result
+		}
+
+		result.merge(statement)
+	}
+}
+
+func (p *parser_s) parse_top_level_statement() (result TopLevelResult, done bool) {
+	defer p.catch()
+
+	token := p.might_only_expect([]token_kind{use_keyword, type_keyword, trait_keyword, fun_keyword, var_keyword, const_keyword, single_line_comment, multi_line_comment, hidden_keyword})
+
 	if token == nil {
-		return result
+		return result, true
 	}
 
 	if token.Kind == hidden_keyword {
@@ -112,40 +150,64 @@ func (p *parser_s) parse_top_level_statements() TopLevelResult {
 	case use_keyword:
 		p.backup()
 		result.Uses = append(result.Uses, p.parse_use_statement())
-		result.merge(p.parse_top_level_statements())
 	case fun_keyword:
 		p.backup()
 		result.Definitions = append(result.Definitions, p.parse_fun_definition_statement())
-		result.merge(p.parse_top_level_statements())
 	case type_keyword:
 		p.backup()
 		result.Definitions = append(result.Definitions, p.parse_type_definition_statement())
-		result.merge(p.parse_top_level_statements())
 	case trait_keyword:
 		p.backup()
 		result.Definitions = append(result.Definitions, p.parse_trait_definition_statement())
-		result.merge(p.parse_top_level_statements())
 	case var_keyword, const_keyword:
 		p.backup()
 		result.Definitions = append(result.Definitions, p.parse_declaration_statement())
-		result.merge(p.parse_top_level_statements())
 	case single_line_comment, multi_line_comment:
 		p.backup()
 		comment := p.parse_comment()
 		result.Definitions = append(result.Definitions, comment)
 		result.Comments = append(result.Comments, comment)
-		result.merge(p.parse_top_level_statements())
 	}
 
-	return result
+	return result, false
 }
 
 func (p *parser_s) parse_inline_level_statements() StatementList {
-	defer p.catch()
-
-	p.skip()
 	result := StatementList{}
 
+	for {
+		// an error of the statement that contains this block is handled by the loop that parses it
+		if p.recovering {
+			return result
+		}
+
+		p.skip()
+		state := p.save()
+		statement, done := p.parse_inline_level_statement()
+
+		// a statement that does not move the parser forward would be parsed forever
+		if !done && (statement == nil || p.offset == state.offset) {
+			p.report(fmt.Sprintf(errors.ErrorMessages["u_tok"], token_map[p.current_token().Kind]))
+		}
+
+		// a statement that cannot be parsed is left out and parsing continues with the next one
+		if p.recovering {
+			p.restore(state)
+			p.synchronise_inline()
+			continue
+		}
+
+		if done {
+			return result
+		}
+
+		result = append(result, statement)
+	}
+}
+
+func (p *parser_s) parse_inline_level_statement() (result Statement, done bool) {
+	defer p.catch()
+
 	allowed := []token_kind{var_keyword, const_keyword, defer_keyword, for_keyword, match_keyword, if_keyword, identifier, right_curly_bracks, single_line_comment, multi_line_comment, hidden_keyword, corout_keyword, gen_keyword}
 	allowed = append(allowed, p.body_context...)
 
@@ -155,6 +217,10 @@ func (p *parser_s) parse_inline_level_statements() StatementList {
 
 	token := p.might_only_expect(allowed)
 
+	if token == nil {
+		return nil, true
+	}
+
 	if token.Kind == hidden_keyword {
 		p.unexpected_token("Hidden keyword is only allwed in global scope.")
 	}
@@ -162,39 +228,31 @@ func (p *parser_s) parse_inline_level_statements() StatementList {
 	switch token.Kind {
 	case var_keyword, const_keyword:
 		p.backup()
-		result = append(result, p.parse_declaration_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_declaration_statement()
 	case return_keyword:
 		p.backup()
-		result = append(result, p.parse_return_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_return_statement()
 	case defer_keyword:
 		p.backup()
-		result = append(result, p.parse_defer_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_defer_statement()
 	case if_keyword:
 		p.backup()
-		result = append(result, p.parse_if_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_if_statement()
 	case yield_keyword:
 		p.backup()
-		result = append(result, p.parse_yield_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_yield_statement()
 	case break_keyword, continue_keyword:
 		p.backup()
-		result = append(result, p.parse_flow_control_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_flow_control_statement()
 	case single_line_comment, multi_line_comment:
 		p.backup()
-		result = append(result, p.parse_comment())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_comment()
 	case for_keyword:
 		p.backup()
-		result = append(result, p.parse_loop_statement())
-		result = append(result, p.parse_inline_level_statements()...)
+		result = p.parse_loop_statement()
 	case right_curly_bracks:
 		p.backup()
-		return result
+		return nil, true
 	default:
 		// Could be an expression statement or an assignment statement
 		p.backup()
@@ -208,19 +266,17 @@ func (p *parser_s) parse_inline_level_statements() StatementList {
 		if is_assignment != nil {
 			p.backup_by(p.offset - last_offset)
 
-			result = append(result, p.parse_assignment_statement())
-			result = append(result, p.parse_inline_level_statements()...)
+			result = p.parse_assignment_statement()
 		} else {
-			result = append(result, ExpressionStatement{
+			result = ExpressionStatement{
 				Expression: expression,
 				Kind_:      ExpressionStatementKind,
 				location:   expression.Location(),
-			})
-			result = append(result, p.parse_inline_level_statements()...)
+			}
 		}
 	}
 
-	return result
+	return result, false
 }
 
 func (p *parser_s) parse_package_statement() PackageStatement {
@@ -349,7 +405,8 @@ func (p *parser_s) parse_declaration_statement() DeclarationStatement {
 
 	p.advance()
 	ws := p.skip()
-	next := p.must_expect([]token_kind{identifier, assignment})
+	// a type with generic arguments is followed by '<' instead of the name
+	next := p.must_expect([]token_kind{identifier, assignment, left_angle_bracks})
 
 	var value *Expression
 	var typ *TypeLiteral
@@ -362,7 +419,7 @@ func (p *parser_s) parse_declaration_statement() DeclarationStatement {
 		n := p.must_expect([]token_kind{identifier})
 		name = *p.create_ident(n)
 		p.skip()
-	case identifier:
+	case identifier, left_angle_bracks:
 		t := p.parse_type_literal()
 		typ = &t
 		p.skip()
@@ -412,7 +469,7 @@ func (p *parser_s) parse_assignment_statement() AssignmentStatement {
 	p.skip()
 	operator := p.must_expect([]token_kind{assignment, arithmetic_assignment})
 	p.skip()
-	rhs := p.parse_expression()
+	rhs := p.parse_required_expression()
 
 	return AssignmentStatement{
 		Kind_: AssignmentStatementKind,
@@ -1238,12 +1295,18 @@ func (p *parser_s) parse_yield_statement() YieldStatement {
 
 	p.skip()
 
-	return YieldStatement{
+	result := YieldStatement{
 		Kind_: YieldStatementKind,
 
-		Value:    &expression,
 		location: start.Location,
 	}
+
+	// empty yields are reported by the compiler
+	if expression != nil {
+		result.Value = &expression
+	}
+
+	return result
 }
 
 func (p *parser_s) parse_flow_control_statement() Statement {
@@ -1653,7 +1716,7 @@ func (p *parser_s) parse_or_expression() Expression {
 	p.must_expect([]token_kind{whitespace, new_line})
 	p.skip()
 
-	rhs := p.parse_expression()
+	rhs := p.parse_required_expression()
 
 	p.set_current_expression(OrExpression{
 		LeftHandSide:  lhs,
@@ -1977,7 +2040,7 @@ func (p *parser_s) parse_key_value_entry() KeyValueEntry {
 	p.skip()
 	p.must_expect([]token_kind{colon})
 	p.skip()
-	value := p.parse_expression()
+	value := p.parse_required_expression()
 
 	return KeyValueEntry{
 		Key:   *p.create_ident(key),
@@ -2000,12 +2063,18 @@ func (p *parser_s) parse_literal_expression() LiteralExpression {
 		}
 		p.advance()
 	case rune_literal:
+		p.advance()
+
+		// the token is moved past first so that parsing goes on after the error
+		if len(current.Literal) == 0 {
+			p.throw("rune literals cannot be empty", current.Location)
+		}
+
 		result = RuneLiteralExpression{
 			Value:    rune(current.Literal[0]),
 			Kind_:    RuneLiteralExpressionKind,
 			location: current.Location,
 		}
-		p.advance()
 	case bool_literal:
 		result = BoolLiteralExpression{
 			Value:    current.Literal == "true",
@@ -2046,13 +2115,15 @@ func (p *parser_s) parse_literal_expression() LiteralExpression {
 		current := p.current_expression()
 
 		if current == nil {
+			// the literal is located at its opening brace
+			location := p.current_token().Location
 			entries := parse_seperated_list(p, p.parse_key_value_entry, comma, left_curly_bracks, right_curly_bracks, true, true)
 
 			result = MapLiteralExpression{
 				Kind_: MapLiteralExpressionKind,
 
 				Value:    entries,
-				location: p.current_token().Location,
+				location: location,
 			}
 		} else {
 			if reflect.TypeOf(current) != reflect.TypeOf(IdentifierExpression{}) && reflect.TypeOf(current) != reflect.TypeOf(MemberExpression{}) {
@@ -2176,11 +2247,17 @@ func (p *parser_s) parse_match_expression() Expression {
 	}
 }
 
-func Parse(input []byte, filepath string) (Ast, errors.Error) {
+// ParseAll parses a file and reports every syntax error in it. The returned Ast
+// holds the statements that could be parsed.
+func ParseAll(input []byte, filepath string) (Ast, errors.Diagnostics) {
+	return parse([]rune(string(input)), filepath)
+}
+
+func parse(source []rune, filepath string) (Ast, errors.Diagnostics) {
 	filename := path.Base(filepath)
 
 	parser := parser_s{
-		input: input,
+		input: source,
 		ast: Ast{
 			FileName: filename,
 			FilePath: filepath,
@@ -2190,18 +2267,41 @@ func Parse(input []byte, filepath string) (Ast, errors.Error) {
 		body_context: []token_kind{},
 	}
 
-	tokens, err := lex(input, filename)
+	tokens, diagnostics := lex_from(source, file_start(filename))
 	parser.tokens = tokens
+	parser.parse_program()
 
-	if err.Exists {
-		return Ast{}, err
+	// tokens that could not be lexed cause errors after them on their line that are not worth reporting
+	for _, err := range parser.diagnostics {
+		if !slices.ContainsFunc(diagnostics, func(lexer_err errors.Error) bool {
+			return lexer_err.Location.Start.Line == err.Location.Start.Line && lexer_err.Location.Start.Column <= err.Location.Start.Column
+		}) {
+			diagnostics = append(diagnostics, err)
+		}
 	}
 
-	parser.parse_program()
+	slices.SortStableFunc(diagnostics, func(a, b errors.Error) int {
+		if a.Location.Start.Line != b.Location.Start.Line {
+			return a.Location.Start.Line - b.Location.Start.Line
+		}
+
+		return a.Location.Start.Column - b.Location.Start.Column
+	})
+
+	parser.ast.source = source
+	parser.ast.tokens = tokens
+	parser.ast.diagnostics = diagnostics
+
+	return parser.ast, diagnostics
+}
+
+// Parse parses a file and returns the first syntax error in it
+func Parse(input []byte, filepath string) (Ast, errors.Error) {
+	ast, diagnostics := ParseAll(input, filepath)
 
-	if parser.error.Exists {
-		return Ast{}, parser.error
+	if diagnostics.Exists() {
+		return Ast{}, diagnostics.First()
 	}
 
-	return parser.ast, parser.error
+	return ast, errors.EmptyError
 }
@@ -1,7 +1,9 @@
 package parser_test
 
 import (
+	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 
 	errors "github.com/moonbite-org/moonbite/error"
@@ -261,6 +263,17 @@ func TestDeclarationStatement(t *testing.T) {
 	ast, err = parser.Parse(input, "test.mb")
 
 	assert_no_error(t, err)
+	input = []byte("package main var List<Int> test = []")
+	ast, err = parser.Parse(input, "test.mb")
+
+	assert_no_error(t, err)
+
+	typ := (*ast.Definitions[0].(parser.DeclarationStatement).Type).(parser.TypeIdentifier)
+	assert_string(t, typ.Name.(parser.IdentifierExpression).Value, "List")
+
+	if len(typ.Generics) != 1 {
+		t.Errorf("expected 1 generic argument but found %d", len(typ.Generics))
+	}
 }
 
 func TestAssignmentStatement(t *testing.T) {
@@ -1361,3 +1374,324 @@ func TestMisc(t *testing.T) {
 
 	assert_no_error(t, err)
 }
+
+func TestErrorRecovery(t *testing.T) {
+	input := []byte(`package main
+
+var = 1
+
+fun main() {
+  var a = (1 + )
+  var b = 2
+  const = 3
+}
+
+fun other() {}
+
+type { x Int; }
+`)
+
+	ast, diagnostics := parser.ParseAll(input, "test.mb")
+
+	assert_int(t, len(diagnostics), 4)
+
+	lines := []int{3, 6, 8, 13}
+	for i, err := range diagnostics {
+		if i < len(lines) && err.Location.Start.Line != lines[i] {
+			t.Errorf("expected error %d to be at line %d but got: %s", i, lines[i], err)
+		}
+	}
+
+	// the definitions around the errors are still parsed
+	found := false
+	for _, definition := range ast.Definitions {
+		if statement, ok := definition.(*parser.UnboundFunDefinitionStatement); ok && statement.Signature.Name.Value == "other" {
+			found = true
+		}
+	}
+
+	assert_bool(t, found, true)
+
+	_, err := parser.Parse(input, "test.mb")
+	assert_error(t, err)
+
+	// expressions that are left out are errors instead of missing nodes
+	for _, source := range []string{
+		"count =\n}",
+		"var a = f() or\n}",
+		"var a = [1, , 2]\n}",
+		"var a = P{x: , y: 2}\n}",
+		"var a = '",
+	} {
+		_, err := parser.Parse([]byte("package main\nfun main() {\n"+source), "test.mb")
+		assert_error(t, err)
+	}
+}
+
+// the tree of a file without the locations of its nodes, so that trees of differently laid out sources can be compared
+func shape_of(t *testing.T, input []byte) any {
+	ast, diagnostics := parser.ParseAll(input, "test.mb")
+
+	if diagnostics.Exists() {
+		t.Fatalf("expected no syntax errors but got: %s\n%s", diagnostics, input)
+	}
+
+	return shape_of_ast(ast)
+}
+
+// the tree without its locations
+func shape_of_ast(ast parser.Ast) any {
+	data, _ := json.Marshal(ast)
+	var result any
+	json.Unmarshal(data, &result)
+
+	var strip func(value any)
+	strip = func(value any) {
+		switch value := value.(type) {
+		case map[string]any:
+			delete(value, "location")
+			for _, child := range value {
+				strip(child)
+			}
+		case []any:
+			for _, child := range value {
+				strip(child)
+			}
+		}
+	}
+
+	strip(result)
+
+	return result
+}
+
+func TestFormat(t *testing.T) {
+	input := []byte(`package main
+use "std/io"   as io
+// the point type
+type Point implements [Shape]{ x Int;hidden y Int; }
+trait Shape mimics [Thing] { fun area() Int; fun scale<T>(by T, ...rest Int) Shape }
+
+type Size { w Int; h Int; d Int; }
+hidden var Int total=5
+const names = [ "a",'b', 1.50 ]
+
+
+/* block
+   comment */
+fun for Point length() Int { return this.x+this.y*2 // trailing
+}
+fun main() {
+  var Point p = Point{x: 1, y: 2}
+  if (p.x > 0 && !(p.y == 1)) { p.x++ }
+  else if (p instanceof Point) { p.x-- } else { p.x = 0 }
+  for (var i = 0; i < 10; i++) {}
+  for (, v of names) { break }
+  var r = match (p) {
+    (.x > 1) { return 1 }
+    base { return 0 }
+  }
+  var c = corout fun() Int { return 1 }
+  var res = read_file() or give up
+  var n = p.(Point)
+  defer warn(n)
+  // end of main
+}
+`)
+
+	expected := `package main
+
+use "std/io" as io
+
+// the point type
+type Point implements [Shape] {
+  x Int;
+  hidden y Int;
+}
+trait Shape mimics [Thing] {
+  fun area() Int;
+  fun scale<T>(by T, ...rest Int) Shape;
+}
+
+type Size {
+  w Int;
+  h Int;
+  d Int;
+}
+hidden var Int total = 5
+const names = ["a", 'b', 1.50]
+
+/* block
+   comment */
+fun for Point length() Int {
+  return this.x + this.y * 2 // trailing
+}
+fun main() {
+  var Point p = Point{ x: 1, y: 2 }
+  if (p.x > 0 && !(p.y == 1)) {
+    p.x++
+  } else if (p instanceof Point) {
+    p.x--
+  } else {
+    p.x = 0
+  }
+  for (var i = 0; i < 10; i++) {}
+  for (, v of names) {
+    break
+  }
+  var r = match (p) {
+    (.x > 1) {
+      return 1
+    }
+    base {
+      return 0
+    }
+  }
+  var c = corout fun() Int {
+    return 1
+  }
+  var res = read_file() or give up
+  var n = p.(Point)
+  defer warn(n)
+  // end of main
+}
+`
+
+	output, diagnostics := parser.Format(input, "test.mb")
+	if diagnostics.Exists() {
+		t.Fatalf("expected no syntax errors but got: %s", diagnostics)
+	}
+
+	assert_string(t, string(output), expected)
+
+	// the formatted file means the same as the original
+	if !reflect.DeepEqual(shape_of(t, input), shape_of(t, output)) {
+		t.Errorf("expected the formatted file to parse to the same tree")
+	}
+
+	// formatting a formatted file changes nothing
+	again, _ := parser.Format(output, "test.mb")
+	assert_string(t, string(again), string(output))
+
+	_, diagnostics = parser.Format([]byte("package main\nvar = 1\n"), "test.mb")
+	assert_bool(t, diagnostics.Exists(), true)
+}
+
+func TestFormatLongLiterals(t *testing.T) {
+	input := []byte(`package main
+var data = { name: "a rather long value", other: "another rather long value", third: 3 }
+var list = [1, 2]
+`)
+
+	expected := `package main
+
+var data = {
+  name: "a rather long value",
+  other: "another rather long value",
+  third: 3,
+}
+var list = [1, 2]
+`
+
+	output, _ := parser.Format(input, "test.mb")
+	assert_string(t, string(output), expected)
+
+	if !reflect.DeepEqual(shape_of(t, input), shape_of(t, output)) {
+		t.Errorf("expected the formatted file to parse to the same tree")
+	}
+}
+
+func TestReparse(t *testing.T) {
+	source := `package main
+
+use "os"
+
+// the first one
+fun first() {
+  var b = 'c'
+  print(b)
+}
+
+hidden fun second(x Int) Int { return x }
+type Point { x Int; }
+`
+
+	edit := func(previous parser.Ast, from, to, text string) (parser.Ast, string) {
+		start := len([]rune(source[:strings.Index(source, from)]))
+		end := start + len([]rune(to))
+		source = string([]rune(source)[:start]) + text + string([]rune(source)[end:])
+
+		ast, _ := parser.Reparse(previous, parser.Edit{Start: start, End: end, Text: text})
+		return ast, source
+	}
+
+	// the edited tree is the parsed one once the locations of the reused definitions are moved
+	same := func(ast, expected parser.Ast) {
+		t.Helper()
+
+		if !reflect.DeepEqual(shape_of_ast(ast), shape_of_ast(expected)) {
+			t.Errorf("expected the edited tree to be the same as the parsed one")
+		}
+
+		for i, definition := range ast.Definitions {
+			location := ast.Locate(i, definition.Location())
+
+			if !reflect.DeepEqual(location, expected.Definitions[i].Location()) {
+				t.Errorf("expected definition %d to be at %v but it is at %v", i, expected.Definitions[i].Location(), location)
+			}
+		}
+	}
+
+	previous, _ := parser.ParseAll([]byte(source), "test.mb")
+
+	// an edit inside the body of a function moves the definitions after it
+	ast, source := edit(previous, "print", "", "b = \"a string\"\n  ")
+	expected, _ := parser.ParseAll([]byte(source), "test.mb")
+	same(ast, expected)
+
+	// the definitions before the edit are reused and so are the ones after it
+	previous = ast
+	ast, source = edit(previous, "return x", "", "\n")
+	expected, _ = parser.ParseAll([]byte(source), "test.mb")
+	same(ast, expected)
+
+	if ast.Definitions[0] != previous.Definitions[0] {
+		t.Errorf("expected the definition before the edit to be reused")
+	}
+
+	field := func(ast parser.Ast) *parser.ValueTypePair {
+		return &ast.Definitions[2].(parser.TypeDefinitionStatement).Definition.(parser.StructLiteral).Values[0]
+	}
+
+	if field(ast) != field(previous) {
+		t.Errorf("expected the definition after the edit to be reused")
+	}
+
+	assert_int(t, ast.Locate(2, ast.Definitions[2].Location()).Start.Line, 14)
+
+	// the locations in a reused definition move along with it
+	assert_bool(t, reflect.DeepEqual(ast.Locate(2, field(ast).Location), field(expected).Location), true)
+
+	// an edit that breaks a definition reports the errors of the whole file
+	start := len([]rune(source[:strings.Index(source, "Point")]))
+	_, diagnostics := parser.Reparse(ast, parser.Edit{Start: start, End: start + len("Point")})
+	_, expected_diagnostics := parser.ParseAll([]byte(strings.Replace(source, "Point", "", 1)), "test.mb")
+
+	assert_int(t, len(diagnostics), len(expected_diagnostics))
+	assert_bool(t, diagnostics.Exists(), true)
+}
+
+func TestLiteralLocations(t *testing.T) {
+	input := []byte("package main\nconst s = \"ab\" + 'c' + name")
+	ast, err := parser.Parse(input, "test.mb")
+
+	assert_no_error(t, err)
+
+	// the quotes of literals are counted by the locations after them
+	value := (*ast.Definitions[0].(parser.DeclarationStatement).Value).(parser.ArithmeticExpression)
+	assert_int(t, value.LeftHandSide.Location().Start.Column, 11)
+
+	name := value.RightHandSide.(parser.ArithmeticExpression).RightHandSide
+	assert_int(t, name.Location().Start.Column, 24)
+	assert_int(t, name.Location().Offset, 36)
+}
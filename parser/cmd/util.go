@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -9,6 +10,17 @@ import (
 )
 
 func (p *parser_s) throw(reason string, l ...errors.Location) {
+	p.report(reason, l...)
+	panic(nil)
+}
+
+// records a syntax error without stopping the parser, only the first error of a statement
+// is recorded since the ones after it are usually caused by it
+func (p *parser_s) report(reason string, l ...errors.Location) {
+	if p.recovering {
+		return
+	}
+
 	var location errors.Location
 	current := p.current_token()
 
@@ -29,13 +41,86 @@ func (p *parser_s) throw(reason string, l ...errors.Location) {
 		}
 	}
 
-	p.error = errors.Error{
+	p.diagnostics.Add(errors.Error{
 		Kind:     errors.SyntaxError,
 		Reason:   reason,
 		Location: location,
 		Exists:   true,
+	})
+	p.recovering = true
+}
+
+// the state a statement starts parsing with, the parser returns to it when the statement fails
+type parser_state struct {
+	offset                int
+	expressions           int
+	is_match_context      bool
+	is_this_context       bool
+	body_context          []token_kind
+	previous_body_context []token_kind
+}
+
+func (p *parser_s) save() parser_state {
+	return parser_state{
+		offset:                p.offset,
+		expressions:           len(p.expressions),
+		is_match_context:      p.is_match_context,
+		is_this_context:       p.is_this_context,
+		body_context:          p.body_context,
+		previous_body_context: p.previous_body_context,
+	}
+}
+
+func (p *parser_s) restore(state parser_state) {
+	p.offset = state.offset
+	p.expressions = p.expressions[:min(state.expressions, len(p.expressions))]
+	p.is_match_context = state.is_match_context
+	p.is_this_context = state.is_this_context
+	p.body_context = state.body_context
+	p.previous_body_context = state.previous_body_context
+}
+
+// skips to the next top level keyword that starts a line
+func (p *parser_s) synchronise_top_level() {
+	p.recovering = false
+	p.advance()
+
+	for p.current_token().Kind != eof_token_kind {
+		token := p.current_token()
+
+		if slices.Contains(top_level_keywords, token.Kind) && token.Location.Start.Column == 1 {
+			return
+		}
+
+		p.advance()
+	}
+}
+
+// skips to the end of the statement, which is the end of its line unless it opens a block
+func (p *parser_s) synchronise_inline() {
+	p.recovering = false
+	depth := 0
+
+	for {
+		switch p.current_token().Kind {
+		case eof_token_kind:
+			return
+		case left_curly_bracks:
+			depth++
+		case right_curly_bracks:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case new_line, semicolon:
+			if depth == 0 {
+				p.advance()
+				return
+			}
+		}
+
+		p.advance()
 	}
-	panic(nil)
 }
 
 func (p *parser_s) catch() {
@@ -186,6 +271,12 @@ func parse_seperated_list[T any](p *parser_s, parser_func func() T, seperator to
 
 	for !done {
 		value := parser_func()
+
+		// an entry is left out, like the second one of [1, , 2]
+		if any(value) == nil {
+			p.unexpected_token("")
+		}
+
 		result = append(result, value)
 		p.skip_whitespace()
 		p.skip()
@@ -212,6 +303,17 @@ func parse_seperated_list[T any](p *parser_s, parser_func func() T, seperator to
 	return result
 }
 
+// parses an expression that cannot be left out
+func (p *parser_s) parse_required_expression() Expression {
+	expression := p.parse_expression()
+
+	if expression == nil {
+		p.unexpected_token("")
+	}
+
+	return expression
+}
+
 func (p *parser_s) create_ident(token Token) *IdentifierExpression {
 	return &IdentifierExpression{Value: token.Literal, Kind_: IdentifierExpressionKind, location: token.Location}
 }
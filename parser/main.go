@@ -46,10 +46,11 @@ func main() {
 		file_path = os.Args[2]
 	}
 
-	ast, p_err := parser.Parse(input, file_path)
+	ast, diagnostics := parser.ParseAll(input, file_path)
 
-	if p_err.Exists {
-		message, _ := json.Marshal(p_err)
+	// every syntax error is reported at once
+	if diagnostics.Exists() {
+		message, _ := json.Marshal(diagnostics)
 		os.Stderr.Write(message)
 		os.Exit(0)
 	}
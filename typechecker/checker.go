@@ -0,0 +1,820 @@
+package typechecker
+
+import (
+	"fmt"
+	"slices"
+
+	errors "github.com/moonbite-org/moonbite/error"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+)
+
+type variable struct {
+	Kind parser.VarKind
+	Type Type
+	// only set for functions that are defined with a name
+	Signature parser.FunctionSignature
+	Location  errors.Location
+}
+
+type scope struct {
+	variables map[string]*variable
+	outer     *scope
+}
+
+func new_scope(outer *scope) *scope {
+	return &scope{
+		variables: map[string]*variable{},
+		outer:     outer,
+	}
+}
+
+func (s *scope) define(name string, v *variable) {
+	s.variables[name] = v
+}
+
+func (s *scope) resolve(name string) *variable {
+	if v, ok := s.variables[name]; ok {
+		return v
+	}
+
+	if s.outer != nil {
+		return s.outer.resolve(name)
+	}
+
+	return nil
+}
+
+type function_context struct {
+	return_type Type
+	this        Type
+}
+
+// CheckDefinitions checks the definitions of a package. Types and function signatures
+// are collected before any body is checked so definitions can refer to the ones after them.
+// Every error is added to the diagnostics of the checker and the first one is returned.
+func (c *Typechecker) CheckDefinitions(definitions []parser.Definition) errors.Error {
+	c.Diagnostics = errors.Diagnostics{}
+	c.References = []Reference{}
+
+	c.define_types(definitions)
+	c.bind_methods(definitions)
+	c.check_conformance(definitions)
+
+	for _, definition := range definitions {
+		if definition.Kind() != parser.UnboundFunDefinitionStatementKind {
+			continue
+		}
+
+		signature := definition.(*parser.UnboundFunDefinitionStatement).Signature
+
+		typ, err := c.resolve_signature(signature)
+		if c.report(err) {
+			continue
+		}
+
+		c.scope.define(signature.Name.Value, &variable{
+			Kind:      parser.ConstantKind,
+			Type:      typ,
+			Signature: signature,
+			Location:  signature.Name.Location(),
+		})
+		c.refer(signature.Name.Value, FunctionReference, typ, signature.Name.Location(), signature.Name.Location())
+	}
+
+	for _, definition := range definitions {
+		c.report(c.check_statement(definition))
+	}
+
+	return c.Diagnostics.First()
+}
+
+// TypeOf finds the type of a variable or a function that is defined at the top level of
+// the definitions the last CheckDefinitions call checked
+func (c *Typechecker) TypeOf(name string) (Type, bool) {
+	if v := c.scope.resolve(name); v != nil {
+		return v.Type, true
+	}
+
+	return nil, false
+}
+
+// adds an error to the diagnostics and reports whether there was one
+func (c *Typechecker) report(err errors.Error) bool {
+	c.Diagnostics.Add(err)
+	return err.Exists
+}
+
+func (c *Typechecker) define_types(definitions []parser.Definition) {
+	for _, definition := range definitions {
+		switch definition.Kind() {
+		case parser.TypeDefinitionStatementKind:
+			c.report(c.Define(definition.(parser.TypeDefinitionStatement)))
+		case parser.TraitDefinitionStatementKind:
+			c.report(c.DefineTrait(definition.(parser.TraitDefinitionStatement)))
+		}
+	}
+}
+
+func (c *Typechecker) enter_scope() {
+	c.scope = new_scope(c.scope)
+}
+
+func (c *Typechecker) leave_scope() {
+	c.scope = c.scope.outer
+}
+
+func (c *Typechecker) check_block(body parser.StatementList) errors.Error {
+	c.enter_scope()
+	defer c.leave_scope()
+
+	// the statements after one with an error are still checked
+	for _, statement := range body {
+		c.report(c.check_statement(statement))
+	}
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) check_statement(statement parser.Statement) errors.Error {
+	switch statement.Kind() {
+	case parser.ExpressionStatementKind:
+		_, err := c.infer(statement.(parser.ExpressionStatement).Expression)
+		return err
+	case parser.DeclarationStatementKind:
+		return c.check_declaration_statement(statement.(parser.DeclarationStatement))
+	case parser.AssignmentStatementKind:
+		return c.check_assignment_statement(statement.(parser.AssignmentStatement))
+	case parser.UnboundFunDefinitionStatementKind:
+		definition := statement.(*parser.UnboundFunDefinitionStatement)
+		return c.check_function(definition.Signature, definition.Body, nil)
+	case parser.BoundFunDefinitionStatementKind:
+		definition := statement.(*parser.BoundFunDefinitionStatement)
+		var this Type = Any
+
+		if symbol := c.SymbolTable.Get(resolve_name(definition.Signature.For.Name)); symbol != nil {
+			this = symbol.Type
+		}
+
+		// methods of generic types can refer to the parameters of the type
+		if named, ok := this.(*NamedType); ok {
+			restore := c.with_parameters(named.Parameters)
+			defer restore()
+
+			if method, ok := find_method(named, definition.Signature.Name.Value); ok {
+				c.refer(method.Name, MethodReference, method.Type, definition.Signature.Name.Location(), method.Location)
+			}
+		}
+
+		return c.check_function(definition.Signature, definition.Body, this)
+	case parser.ReturnStatementKind:
+		return c.check_return_statement(statement.(parser.ReturnStatement))
+	case parser.DeferStatementKind:
+		_, err := c.infer(statement.(parser.DeferStatement).Value)
+		return err
+	case parser.YieldStatementKind:
+		if value := statement.(parser.YieldStatement).Value; value != nil {
+			_, err := c.infer(*value)
+			return err
+		}
+	case parser.IfStatementKind:
+		return c.check_if_statement(statement.(parser.IfStatement))
+	case parser.LoopStatementKind:
+		return c.check_loop_statement(statement.(parser.LoopStatement))
+	}
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) check_declaration_statement(statement parser.DeclarationStatement) errors.Error {
+	var declared Type
+
+	if statement.Type != nil {
+		literal, err := c.ResolveLiteral(*statement.Type)
+		if err.Exists {
+			return err
+		}
+		declared = literal
+	}
+
+	if statement.Value != nil {
+		value, err := c.infer(*statement.Value)
+		if err.Exists {
+			return err
+		}
+
+		if declared == nil {
+			declared = c.widen(value)
+		} else if !IsSubtype(value, declared) {
+			return errors.CreateTypeError(fmt.Sprintf("cannot assign type '%s' to variable '%s' of type '%s'", value, statement.Name.Value, declared), (*statement.Value).Location())
+		}
+	}
+
+	if declared == nil {
+		declared = Any
+	}
+
+	c.scope.define(statement.Name.Value, &variable{
+		Kind:     statement.VarKind,
+		Type:     declared,
+		Location: statement.Name.Location(),
+	})
+	c.refer(statement.Name.Value, VariableReference, declared, statement.Name.Location(), statement.Name.Location())
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) check_assignment_statement(statement parser.AssignmentStatement) errors.Error {
+	target, err := c.infer(statement.LeftHandSide)
+	if err.Exists {
+		return err
+	}
+
+	value, err := c.infer(statement.RightHandSide)
+	if err.Exists {
+		return err
+	}
+
+	if !IsSubtype(value, target) {
+		return errors.CreateTypeError(fmt.Sprintf("cannot assign type '%s' to type '%s'", value, target), statement.RightHandSide.Location())
+	}
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) check_return_statement(statement parser.ReturnStatement) errors.Error {
+	if c.function == nil {
+		return errors.EmptyError
+	}
+
+	expected := c.function.return_type
+
+	if statement.Value == nil || *statement.Value == nil {
+		if expected != nil {
+			return errors.CreateTypeError(fmt.Sprintf("missing return value, function returns '%s'", expected), statement.Location())
+		}
+
+		return errors.EmptyError
+	}
+
+	value, err := c.infer(*statement.Value)
+	if err.Exists {
+		return err
+	}
+
+	if expected == nil {
+		return errors.CreateTypeError("cannot return a value from a function without a return type", (*statement.Value).Location())
+	}
+
+	if !IsSubtype(value, expected) {
+		return errors.CreateTypeError(fmt.Sprintf("cannot return type '%s' from a function that returns '%s'", value, expected), (*statement.Value).Location())
+	}
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) check_if_statement(statement parser.IfStatement) errors.Error {
+	blocks := append([]parser.PredicateBlock{statement.MainBlock}, statement.ElseIfBlocks...)
+
+	for _, block := range blocks {
+		if _, err := c.infer(block.Predicate); err.Exists {
+			return err
+		}
+
+		if err := c.check_block(block.Body); err.Exists {
+			return err
+		}
+	}
+
+	return c.check_block(statement.ElseBlock)
+}
+
+func (c *Typechecker) check_loop_statement(statement parser.LoopStatement) errors.Error {
+	c.enter_scope()
+	defer c.leave_scope()
+
+	switch predicate := statement.Predicate.(type) {
+	case parser.UnipartiteLoopPredicate:
+		if _, err := c.infer(predicate.Expression); err.Exists {
+			return err
+		}
+	case parser.TripartiteLoopPredicate:
+		if predicate.Declaration != nil {
+			if err := c.check_declaration_statement(*predicate.Declaration); err.Exists {
+				return err
+			}
+		}
+
+		if predicate.Predicate != nil {
+			if _, err := c.infer(predicate.Predicate); err.Exists {
+				return err
+			}
+		}
+
+		if predicate.Procedure != nil {
+			if _, err := c.infer(*predicate.Procedure); err.Exists {
+				return err
+			}
+		}
+	case parser.BipartiteLoopPredicate:
+		if _, err := c.infer(predicate.Iterator); err.Exists {
+			return err
+		}
+
+		for _, name := range []*parser.IdentifierExpression{predicate.Key, predicate.Value} {
+			if name != nil {
+				c.scope.define(name.Value, &variable{Kind: parser.VariableKind, Type: Any, Location: name.Location()})
+				c.refer(name.Value, VariableReference, Any, name.Location(), name.Location())
+			}
+		}
+	}
+
+	return c.check_block(statement.Body)
+}
+
+func (c *Typechecker) check_function(signature parser.FunctionSignature, body parser.StatementList, this Type) errors.Error {
+	_, restore, err := c.with_generics(signature.GetGenerics())
+	defer restore()
+
+	if err.Exists {
+		return err
+	}
+
+	context := &function_context{this: this}
+
+	if signature.GetReturnType() != nil {
+		return_type, err := c.ResolveLiteral(*signature.GetReturnType())
+		if err.Exists {
+			return err
+		}
+		context.return_type = return_type
+	}
+
+	previous := c.function
+	c.function = context
+	c.enter_scope()
+
+	defer func() {
+		c.leave_scope()
+		c.function = previous
+	}()
+
+	for _, parameter := range signature.GetParameters() {
+		typ, err := c.ResolveLiteral(parameter.Type)
+		if err.Exists {
+			return err
+		}
+
+		if parameter.Variadic {
+			typ = c.list_of(typ)
+		}
+
+		c.scope.define(parameter.Name.Value, &variable{Kind: parser.VariableKind, Type: typ, Location: parameter.Name.Location()})
+		c.refer(parameter.Name.Value, VariableReference, typ, parameter.Name.Location(), parameter.Name.Location())
+	}
+
+	return c.check_block(body)
+}
+
+// infers the type of an expression, checking the expressions it is made of along the way
+func (c *Typechecker) infer(expression parser.Expression) (Type, errors.Error) {
+	switch expression.Kind() {
+	case parser.IdentifierExpressionKind:
+		identifier := expression.(parser.IdentifierExpression)
+
+		if v := c.scope.resolve(identifier.Value); v != nil {
+			c.refer_variable(identifier.Value, v, identifier.Location())
+			return v.Type, errors.EmptyError
+		}
+
+		// undefined variables are reported by the compiler
+		return Any, errors.EmptyError
+	case parser.NumberLiteralExpressionKind:
+		switch value := expression.(parser.NumberLiteralExpression).Value.Value.(type) {
+		case float64:
+			return &NumberLiteralType{Float: true, Value: value}, errors.EmptyError
+		case int:
+			return &NumberLiteralType{Value: float64(value)}, errors.EmptyError
+		}
+
+		return Any, errors.EmptyError
+	case parser.StringLiteralExpressionKind:
+		return &LiteralType{Type: c.named("String"), Literal: expression.(parser.LiteralExpression)}, errors.EmptyError
+	case parser.RuneLiteralExpressionKind:
+		return &LiteralType{Type: c.named("Rune"), Literal: expression.(parser.LiteralExpression)}, errors.EmptyError
+	case parser.BoolLiteralExpressionKind:
+		return &LiteralType{Type: c.named("Bool"), Literal: expression.(parser.LiteralExpression)}, errors.EmptyError
+	case parser.ListLiteralExpressionKind:
+		return c.infer_list_literal(expression.(parser.ListLiteralExpression))
+	case parser.MapLiteralExpressionKind:
+		result := &MapLiteralType{}
+
+		for _, entry := range expression.(parser.MapLiteralExpression).Value {
+			value, err := c.infer(entry.Value)
+			if err.Exists {
+				return nil, err
+			}
+
+			result.Fields = append(result.Fields, Field{Name: entry.Key.Value, Type: value})
+		}
+
+		return result, errors.EmptyError
+	case parser.InstanceLiteralExpressionKind:
+		return c.infer_instance_literal(expression.(parser.InstanceLiteralExpression))
+	case parser.ArithmeticExpressionKind:
+		arithmetic := expression.(parser.ArithmeticExpression)
+		left, err := c.infer(arithmetic.LeftHandSide)
+		if err.Exists {
+			return nil, err
+		}
+		right, err := c.infer(arithmetic.RightHandSide)
+		if err.Exists {
+			return nil, err
+		}
+
+		if _, ok := left.(*NumberLiteralType); ok {
+			return c.widen(right), errors.EmptyError
+		}
+
+		return c.widen(left), errors.EmptyError
+	case parser.BinaryExpressionKind:
+		binary := expression.(parser.BinaryExpression)
+		return c.infer_all(c.named("Bool"), binary.LeftHandSide, binary.RightHandSide)
+	case parser.ComparisonExpressionKind:
+		comparison := expression.(parser.ComparisonExpression)
+		return c.infer_all(c.named("Bool"), comparison.LeftHandSide, comparison.RightHandSide)
+	case parser.NotExpressionKind:
+		return c.infer_all(c.named("Bool"), expression.(parser.NotExpression).Expression)
+	case parser.InstanceofExpressionKind:
+		instanceof := expression.(parser.InstanceofExpression)
+
+		if _, err := c.ResolveLiteral(instanceof.RightHandSide); err.Exists {
+			return nil, err
+		}
+
+		return c.infer_all(c.named("Bool"), instanceof.LeftHandSide)
+	case parser.CallExpressionKind:
+		return c.infer_call_expression(expression.(parser.CallExpression))
+	case parser.MemberExpressionKind:
+		member := expression.(parser.MemberExpression)
+		host, err := c.infer(member.LeftHandSide)
+		if err.Exists {
+			return nil, err
+		}
+
+		name := member.RightHandSide
+
+		if fields, ok := structural(host).(*StructType); ok {
+			if field, ok := fields.Field(name.Value); ok {
+				c.refer(name.Value, FieldReference, field.Type, name.Location(), errors.Location{})
+				return field.Type, errors.EmptyError
+			}
+		}
+
+		if method, ok := find_method(host, name.Value); ok {
+			c.refer(name.Value, MethodReference, method.Type, name.Location(), method.Location)
+		}
+
+		return Any, errors.EmptyError
+	case parser.IndexExpressionKind:
+		index := expression.(parser.IndexExpression)
+		host, err := c.infer(index.Host)
+		if err.Exists {
+			return nil, err
+		}
+
+		if _, err := c.infer(index.Index); err.Exists {
+			return nil, err
+		}
+
+		// lists and the types defined with them are indexed by their elements
+		if list, ok := c.named("List").(*NamedType); ok {
+			if instance := find_instance(host, list); instance != nil {
+				return arguments_of(instance)[0], errors.EmptyError
+			}
+		}
+
+		return Any, errors.EmptyError
+	case parser.MatchExpressionKind:
+		match := expression.(parser.MatchExpression)
+
+		if _, err := c.infer(match.Against); err.Exists {
+			return nil, err
+		}
+
+		for _, block := range match.Blocks {
+			if _, err := c.infer(block.Predicate); err.Exists {
+				return nil, err
+			}
+
+			if err := c.check_block(block.Body); err.Exists {
+				return nil, err
+			}
+		}
+
+		if err := c.check_block(match.BaseBlock); err.Exists {
+			return nil, err
+		}
+
+		return Any, errors.EmptyError
+	case parser.TypeCastExpressionKind:
+		cast := expression.(parser.TypeCastExpression)
+
+		if _, err := c.infer(cast.Value); err.Exists {
+			return nil, err
+		}
+
+		return c.ResolveLiteral(cast.Type)
+	case parser.GroupExpressionKind:
+		return c.infer(expression.(parser.GroupExpression).Expression)
+	case parser.ThisExpressionKind:
+		if c.function != nil && c.function.this != nil {
+			return c.function.this, errors.EmptyError
+		}
+
+		return Any, errors.EmptyError
+	case parser.ArithmeticUnaryExpressionKind:
+		return c.infer(expression.(parser.ArithmeticUnaryExpression).Expression)
+	case parser.OrExpressionKind:
+		or := expression.(parser.OrExpression)
+		left, err := c.infer(or.LeftHandSide)
+		if err.Exists {
+			return nil, err
+		}
+
+		return c.infer_all(left, or.RightHandSide)
+	case parser.WarnExpressionKind:
+		return c.infer_all(Any, expression.(parser.WarnExpression).Argument)
+	case parser.AnonymousFunExpressionKind:
+		fun := expression.(parser.AnonymousFunExpression)
+		return Any, c.check_function(fun.Signature, fun.Body, nil)
+	case parser.CoroutFunExpressionKind:
+		fun := expression.(parser.CoroutFunExpression).Fun
+		return Any, c.check_function(fun.Signature, fun.Body, nil)
+	case parser.GenFunExpressionKind:
+		fun := expression.(parser.GenFunExpression).Fun
+		return Any, c.check_function(fun.Signature, fun.Body, nil)
+	}
+
+	return Any, errors.EmptyError
+}
+
+// checks the given expressions and returns result as their combined type
+func (c *Typechecker) infer_all(result Type, expressions ...parser.Expression) (Type, errors.Error) {
+	for _, expression := range expressions {
+		if _, err := c.infer(expression); err.Exists {
+			return nil, err
+		}
+	}
+
+	return result, errors.EmptyError
+}
+
+func (c *Typechecker) infer_call_expression(expression parser.CallExpression) (Type, errors.Error) {
+	var callee *variable
+
+	if expression.Callee.Kind() == parser.IdentifierExpressionKind {
+		identifier := expression.Callee.(parser.IdentifierExpression)
+		callee = c.scope.resolve(identifier.Value)
+
+		if callee != nil {
+			c.refer_variable(identifier.Value, callee, identifier.Location())
+		}
+	} else if _, err := c.infer(expression.Callee); err.Exists {
+		return nil, err
+	}
+
+	if callee == nil || callee.Signature == nil {
+		return c.infer_all(Any, expression.Arguments...)
+	}
+
+	function := callee.Type.(*FunctionType)
+	name := expression.Callee.(parser.IdentifierExpression).Value
+	parameters := callee.Signature.GetParameters()
+
+	if (!function.Variadic && len(expression.Arguments) != len(parameters)) || (function.Variadic && len(expression.Arguments) < len(parameters)-1) {
+		return nil, errors.CreateTypeError(fmt.Sprintf("function '%s' expects %d arguments but %d provided", name, len(parameters), len(expression.Arguments)), expression.Location())
+	}
+
+	arguments := []Type{}
+
+	for _, argument := range expression.Arguments {
+		value, err := c.infer(argument)
+		if err.Exists {
+			return nil, err
+		}
+
+		arguments = append(arguments, value)
+	}
+
+	// the arguments of a generic function are inferred from the values it is called with
+	bindings := map[*TypeParameter]Type{}
+
+	for _, parameter := range function.TypeParameters {
+		bindings[parameter] = nil
+	}
+
+	for i, argument := range arguments {
+		unify(function.Parameters[min(i, len(parameters)-1)], argument, bindings)
+	}
+
+	if parameter := c.settle(function.TypeParameters, bindings); parameter != nil {
+		return nil, errors.CreateTypeError(fmt.Sprintf("type '%s' does not satisfy '%s' for '%s' of '%s'", bindings[parameter], substitute(parameter.Constraint, bindings), parameter, name), expression.Location())
+	}
+
+	for i, argument := range expression.Arguments {
+		index := min(i, len(parameters)-1)
+		expected := substitute(function.Parameters[index], bindings)
+
+		if !IsSubtype(arguments[i], expected) {
+			return nil, errors.CreateTypeError(fmt.Sprintf("cannot use type '%s' as type '%s' in argument '%s' of '%s'", arguments[i], expected, parameters[index].Name.Value, name), argument.Location())
+		}
+	}
+
+	if function.Return == nil {
+		return Any, errors.EmptyError
+	}
+
+	return substitute(function.Return, bindings), errors.EmptyError
+}
+
+// binds the parameters unify could not infer to their constraints and widens the literals
+// it inferred, then reports the first parameter whose binding does not satisfy its constraint
+func (c *Typechecker) settle(parameters []*TypeParameter, bindings map[*TypeParameter]Type) *TypeParameter {
+	for _, parameter := range parameters {
+		if bindings[parameter] != nil {
+			continue
+		}
+
+		if parameter.Constraint != nil {
+			bindings[parameter] = parameter.Constraint
+		} else {
+			bindings[parameter] = Any
+		}
+	}
+
+	for _, parameter := range parameters {
+		widened := c.widen(bindings[parameter])
+
+		// a literal stays a literal when only the literal satisfies the constraint
+		if parameter.Constraint == nil || IsSubtype(widened, substitute(parameter.Constraint, bindings)) {
+			bindings[parameter] = widened
+		}
+	}
+
+	for _, parameter := range parameters {
+		if parameter.Constraint != nil && !IsSubtype(bindings[parameter], substitute(parameter.Constraint, bindings)) {
+			return parameter
+		}
+	}
+
+	return nil
+}
+
+func (c *Typechecker) infer_instance_literal(expression parser.InstanceLiteralExpression) (Type, errors.Error) {
+	typ := c.named(resolve_name(expression.Type.Name))
+
+	if len(expression.Type.Generics) > 0 {
+		resolved, err := c.ResolveLiteral(expression.Type)
+		if err.Exists {
+			return nil, err
+		}
+		typ = resolved
+	}
+
+	values := []Type{}
+
+	for _, entry := range expression.Value {
+		value, err := c.infer(entry.Value)
+		if err.Exists {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	fields, is_struct := structural(typ).(*StructType)
+
+	if !is_struct {
+		return typ, errors.EmptyError
+	}
+
+	// instances of generic types get their arguments from the values of their fields
+	if named, ok := typ.(*NamedType); ok && len(named.Parameters) > 0 {
+		bindings := map[*TypeParameter]Type{}
+
+		for _, parameter := range named.Parameters {
+			bindings[parameter] = nil
+		}
+
+		for i, entry := range expression.Value {
+			if field, ok := fields.Field(entry.Key.Value); ok {
+				unify(field.Type, values[i], bindings)
+			}
+		}
+
+		if parameter := c.settle(named.Parameters, bindings); parameter != nil {
+			return nil, errors.CreateTypeError(fmt.Sprintf("type '%s' does not satisfy '%s' for '%s' of '%s'", bindings[parameter], substitute(parameter.Constraint, bindings), parameter, named), expression.Location())
+		}
+
+		arguments := []Type{}
+
+		for _, parameter := range named.Parameters {
+			arguments = append(arguments, bindings[parameter])
+		}
+
+		typ = Instantiate(named, arguments)
+		fields = structural(typ).(*StructType)
+	}
+
+	for i, entry := range expression.Value {
+		field, ok := fields.Field(entry.Key.Value)
+		if !ok {
+			return nil, errors.CreateTypeError(fmt.Sprintf("type '%s' has no field '%s'", typ, entry.Key.Value), entry.Key.Location())
+		}
+
+		if !IsSubtype(values[i], field.Type) {
+			return nil, errors.CreateTypeError(fmt.Sprintf("cannot assign type '%s' to field '%s' of type '%s'", values[i], field.Name, field.Type), entry.Value.Location())
+		}
+	}
+
+	for _, field := range fields.Fields {
+		if !slices.ContainsFunc(expression.Value, func(entry parser.KeyValueEntry) bool { return entry.Key.Value == field.Name }) {
+			return nil, errors.CreateTypeError(fmt.Sprintf("missing field '%s' of type '%s'", field.Name, typ), expression.Location())
+		}
+	}
+
+	return typ, errors.EmptyError
+}
+
+// a list literal has the type of its first element as long as the others fit in it
+func (c *Typechecker) infer_list_literal(expression parser.ListLiteralExpression) (Type, errors.Error) {
+	values := []Type{}
+
+	for _, entry := range expression.Value {
+		value, err := c.infer(entry.Value)
+		if err.Exists {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	if len(values) == 0 {
+		return c.list_of(Any), errors.EmptyError
+	}
+
+	fits := func(element Type) bool {
+		return !slices.ContainsFunc(values, func(value Type) bool { return !IsSubtype(value, element) })
+	}
+
+	for _, element := range []Type{values[0], c.widen(values[0])} {
+		if fits(element) {
+			return c.list_of(element), errors.EmptyError
+		}
+	}
+
+	return c.list_of(Any), errors.EmptyError
+}
+
+func (c *Typechecker) list_of(element Type) Type {
+	if list, ok := c.named("List").(*NamedType); ok {
+		return Instantiate(list, []Type{element})
+	}
+
+	return Any
+}
+
+// looks up a type by name without checking its generic arguments
+func (c *Typechecker) named(name string) Type {
+	if symbol := c.SymbolTable.Get(name); symbol != nil {
+		return symbol.Type
+	}
+
+	return Any
+}
+
+// literals become the type they are written with once they are stored in a variable
+func (c *Typechecker) widen(typ Type) Type {
+	switch typ := typ.(type) {
+	case *NumberLiteralType:
+		return c.named(number_literal_types[typ.Float])
+	case *MapLiteralType:
+		return Any
+	case *LiteralType:
+		return typ.Type
+	case *NamedType:
+		if typ.Origin == nil {
+			return typ
+		}
+
+		arguments := []Type{}
+
+		for _, argument := range typ.Arguments {
+			arguments = append(arguments, c.widen(argument))
+		}
+
+		return Instantiate(typ.Origin, arguments)
+	default:
+		return typ
+	}
+}
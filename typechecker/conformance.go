@@ -0,0 +1,222 @@
+package typechecker
+
+import (
+	"fmt"
+	"slices"
+
+	errors "github.com/moonbite-org/moonbite/error"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+)
+
+// collects the functions bound to the types of a package before any body is checked
+func (c *Typechecker) bind_methods(definitions []parser.Definition) {
+	for _, definition := range definitions {
+		if definition.Kind() != parser.BoundFunDefinitionStatementKind {
+			continue
+		}
+
+		signature := definition.(*parser.BoundFunDefinitionStatement).Signature
+		symbol := c.SymbolTable.Get(resolve_name(signature.For.Name))
+
+		// undefined types are reported by the compiler
+		if symbol == nil {
+			continue
+		}
+
+		named, ok := symbol.Type.(*NamedType)
+		if !ok {
+			continue
+		}
+
+		if slices.ContainsFunc(named.Methods, func(method Method) bool { return method.Name == signature.Name.Value }) {
+			c.report(errors.CreateTypeError(fmt.Sprintf("method '%s' is already defined for '%s'", signature.Name.Value, named), signature.Name.Location()))
+			continue
+		}
+
+		restore := c.with_parameters(named.Parameters)
+		typ, err := c.resolve_signature(signature)
+		restore()
+
+		if c.report(err) {
+			continue
+		}
+
+		named.Methods = append(named.Methods, Method{Name: signature.Name.Value, Type: typ, Location: signature.Name.Location()})
+	}
+}
+
+// checks that the types of a package have the methods of the traits they implement
+// and that the traits they mimic agree with each other
+func (c *Typechecker) check_conformance(definitions []parser.Definition) {
+	for _, definition := range definitions {
+		switch definition.Kind() {
+		case parser.TypeDefinitionStatementKind:
+			statement := definition.(parser.TypeDefinitionStatement)
+			symbol := c.SymbolTable.Get(statement.Name.Value)
+
+			// a type that is defined again is only checked where it is defined first
+			if symbol == nil || symbol.Location != statement.Name.Location() {
+				continue
+			}
+
+			named, ok := symbol.Type.(*NamedType)
+			if !ok {
+				continue
+			}
+
+			for i, trait := range named.Implements {
+				c.report(conforms(named, trait, statement.Implementations[i].Location()))
+			}
+		case parser.TraitDefinitionStatementKind:
+			statement := definition.(parser.TraitDefinitionStatement)
+			seen := map[string]Method{}
+
+			for _, method := range trait_methods(c.named(statement.Name.Value)) {
+				previous, ok := seen[method.Name]
+
+				if ok && !(IsSubtype(previous.Type, method.Type) && IsSubtype(method.Type, previous.Type)) {
+					c.report(errors.CreateTypeError(fmt.Sprintf("trait '%s' requires method '%s' as both '%s' and '%s'", statement.Name.Value, method.Name, previous.Type, method.Type), statement.Name.Location()))
+				}
+
+				seen[method.Name] = method
+			}
+		}
+	}
+}
+
+// reports the first method of trait that named is missing or has with a different signature
+func conforms(named *NamedType, trait Type, location errors.Location) errors.Error {
+	if _, ok := structural(trait).(*TraitType); !ok {
+		return errors.CreateTypeError(fmt.Sprintf("type '%s' is not a trait", trait), location)
+	}
+
+	for _, required := range trait_methods(trait) {
+		method, ok := find_method(named, required.Name)
+		if !ok {
+			return errors.CreateTypeError(fmt.Sprintf("type '%s' does not implement '%s', method '%s' is missing", named, trait, required.Name), location)
+		}
+
+		if !IsSubtype(method.Type, required.Type) {
+			return errors.CreateTypeError(fmt.Sprintf("method '%s' of type '%s' has type '%s' but '%s' requires '%s'", required.Name, named, method.Type, trait, required.Type), method.Location)
+		}
+	}
+
+	return errors.EmptyError
+}
+
+// the methods a trait requires, including the ones of the traits it mimics
+func trait_methods(trait Type) []Method {
+	typ, ok := structural(trait).(*TraitType)
+	if !ok {
+		return []Method{}
+	}
+
+	result := slices.Clone(typ.Methods)
+
+	for _, mimic := range typ.Mimics {
+		result = append(result, trait_methods(mimic)...)
+	}
+
+	return result
+}
+
+// finds a method of a type, types have the methods of the types they are defined with
+func find_method(typ Type, name string) (Method, bool) {
+	switch typ := typ.(type) {
+	case *NamedType:
+		if typ.Origin != nil {
+			method, ok := find_method(typ.Origin, name)
+			if ok {
+				method.Type = substitute_function(method.Type, bind(typ.Origin.Parameters, typ.Arguments))
+			}
+
+			return method, ok
+		}
+
+		for _, method := range typ.Methods {
+			if method.Name == name {
+				return method, true
+			}
+		}
+
+		if typ.Underlying != nil {
+			return find_method(typ.Underlying, name)
+		}
+	case *TraitType:
+		for _, method := range trait_methods(typ) {
+			if method.Name == name {
+				return method, true
+			}
+		}
+	case *LiteralType:
+		return find_method(typ.Type, name)
+	case *TypeParameter:
+		if typ.Constraint != nil {
+			return find_method(typ.Constraint, name)
+		}
+	case *IntersectionType:
+		for _, member := range typ.Types {
+			if method, ok := find_method(member, name); ok {
+				return method, true
+			}
+		}
+	}
+
+	return Method{}, false
+}
+
+// Members returns the fields and the methods a value of a type can be accessed with
+func Members(typ Type) ([]Field, []Method) {
+	fields := []Field{}
+
+	if structure, ok := structural(typ).(*StructType); ok {
+		fields = append(fields, structure.Fields...)
+	}
+
+	methods := []Method{}
+
+	for _, method := range method_names(typ) {
+		if !slices.ContainsFunc(methods, func(m Method) bool { return m.Name == method }) {
+			found, _ := find_method(typ, method)
+			methods = append(methods, found)
+		}
+	}
+
+	return fields, methods
+}
+
+// the names of the methods find_method can find for a type
+func method_names(typ Type) []string {
+	result := []string{}
+
+	switch typ := typ.(type) {
+	case *NamedType:
+		if typ.Origin != nil {
+			return method_names(typ.Origin)
+		}
+
+		for _, method := range typ.Methods {
+			result = append(result, method.Name)
+		}
+
+		if typ.Underlying != nil {
+			result = append(result, method_names(typ.Underlying)...)
+		}
+	case *TraitType:
+		for _, method := range trait_methods(typ) {
+			result = append(result, method.Name)
+		}
+	case *LiteralType:
+		return method_names(typ.Type)
+	case *TypeParameter:
+		if typ.Constraint != nil {
+			return method_names(typ.Constraint)
+		}
+	case *IntersectionType:
+		for _, member := range typ.Types {
+			result = append(result, method_names(member)...)
+		}
+	}
+
+	return result
+}
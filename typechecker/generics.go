@@ -0,0 +1,266 @@
+package typechecker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Instantiate creates the type a generic type stands for when it is given arguments.
+// Instances are cached on the generic type so the same arguments produce the same type.
+func Instantiate(origin *NamedType, arguments []Type) *NamedType {
+	// a generic type that is given its own parameters is the generic type itself
+	if slices.EqualFunc(origin.Parameters, arguments, func(parameter *TypeParameter, argument Type) bool {
+		return parameter == argument
+	}) {
+		return origin
+	}
+
+	key := instance_key(arguments)
+
+	if instance, ok := origin.instances[key]; ok {
+		return instance
+	}
+
+	if origin.instances == nil {
+		origin.instances = map[string]*NamedType{}
+	}
+
+	instance := &NamedType{Name: origin.Name, Origin: origin, Arguments: arguments, Implements: []Type{}}
+	// the instance is cached before it is completed so that recursive types find it
+	origin.instances[key] = instance
+	complete(instance)
+
+	return instance
+}
+
+// substitutes the arguments of an instance into the definition of its generic type
+func complete(instance *NamedType) {
+	origin := instance.Origin
+
+	// instances created while their generic type is defined are completed by Define
+	if origin.Underlying == nil {
+		return
+	}
+
+	mapping := bind(origin.Parameters, instance.Arguments)
+	instance.Underlying = substitute(origin.Underlying, mapping)
+	instance.Implements = substitute_all(origin.Implements, mapping)
+}
+
+func (t *NamedType) complete_instances() {
+	for _, instance := range t.instances {
+		complete(instance)
+	}
+}
+
+func instance_key(arguments []Type) string {
+	keys := []string{}
+
+	for _, argument := range arguments {
+		keys = append(keys, fmt.Sprintf("%p", argument))
+	}
+
+	return strings.Join(keys, ",")
+}
+
+func bind(parameters []*TypeParameter, arguments []Type) map[*TypeParameter]Type {
+	mapping := map[*TypeParameter]Type{}
+
+	for i, parameter := range parameters {
+		mapping[parameter] = arguments[i]
+	}
+
+	return mapping
+}
+
+// the arguments a named type is instantiated with, a generic type is instantiated with its parameters
+func arguments_of(typ *NamedType) []Type {
+	if typ.Origin != nil {
+		return typ.Arguments
+	}
+
+	arguments := []Type{}
+
+	for _, parameter := range typ.Parameters {
+		arguments = append(arguments, parameter)
+	}
+
+	return arguments
+}
+
+// replaces the type parameters in typ with the types they are mapped to
+func substitute(typ Type, mapping map[*TypeParameter]Type) Type {
+	switch typ := typ.(type) {
+	case *TypeParameter:
+		if argument, ok := mapping[typ]; ok {
+			return argument
+		}
+
+		return typ
+	case *NamedType:
+		if typ.Origin != nil {
+			return Instantiate(typ.Origin, substitute_all(typ.Arguments, mapping))
+		}
+
+		// a generic type that refers to itself in its definition
+		if len(typ.Parameters) > 0 {
+			return Instantiate(typ, substitute_all(arguments_of(typ), mapping))
+		}
+
+		return typ
+	case *UnionType:
+		return &UnionType{Types: substitute_all(typ.Types, mapping)}
+	case *IntersectionType:
+		return &IntersectionType{Types: substitute_all(typ.Types, mapping)}
+	case *StructType:
+		result := &StructType{Fields: []Field{}}
+
+		for _, field := range typ.Fields {
+			result.Fields = append(result.Fields, Field{Name: field.Name, Type: substitute(field.Type, mapping), Hidden: field.Hidden})
+		}
+
+		return result
+	case *FunctionType:
+		return substitute_function(typ, mapping)
+	case *TraitType:
+		result := &TraitType{Methods: []Method{}, Mimics: substitute_all(typ.Mimics, mapping)}
+
+		for _, method := range typ.Methods {
+			result.Methods = append(result.Methods, Method{Name: method.Name, Type: substitute_function(method.Type, mapping), Location: method.Location})
+		}
+
+		return result
+	case *LiteralType:
+		return &LiteralType{Type: substitute(typ.Type, mapping), Literal: typ.Literal}
+	default:
+		return typ
+	}
+}
+
+func substitute_function(typ *FunctionType, mapping map[*TypeParameter]Type) *FunctionType {
+	result := &FunctionType{
+		TypeParameters: typ.TypeParameters,
+		Parameters:     substitute_all(typ.Parameters, mapping),
+		Variadic:       typ.Variadic,
+	}
+
+	if typ.Return != nil {
+		result.Return = substitute(typ.Return, mapping)
+	}
+
+	return result
+}
+
+func substitute_all(types []Type, mapping map[*TypeParameter]Type) []Type {
+	result := []Type{}
+
+	for _, typ := range types {
+		result = append(result, substitute(typ, mapping))
+	}
+
+	return result
+}
+
+// unify matches the type of a parameter against the type of the argument it is given
+// and binds the type parameters it finds along the way. Only the parameters that are
+// keys of bindings are inferred, a parameter that is bound twice keeps the wider type.
+func unify(parameter, argument Type, bindings map[*TypeParameter]Type) {
+	switch parameter := parameter.(type) {
+	case *TypeParameter:
+		bound, ok := bindings[parameter]
+		if !ok {
+			return
+		}
+
+		if bound == nil || (!IsSubtype(argument, bound) && IsSubtype(bound, argument)) {
+			bindings[parameter] = argument
+		}
+	case *NamedType:
+		if parameter.Origin == nil {
+			return
+		}
+
+		if instance := find_instance(argument, parameter.Origin); instance != nil {
+			arguments := arguments_of(instance)
+
+			for i := range parameter.Arguments {
+				unify(parameter.Arguments[i], arguments[i], bindings)
+			}
+		}
+	case *UnionType:
+		for _, typ := range parameter.Types {
+			unify(typ, argument, bindings)
+		}
+	case *IntersectionType:
+		for _, typ := range parameter.Types {
+			unify(typ, argument, bindings)
+		}
+	case *StructType:
+		argument, ok := structural(argument).(*StructType)
+		if !ok {
+			return
+		}
+
+		for _, field := range parameter.Fields {
+			if argument_field, ok := argument.Field(field.Name); ok {
+				unify(field.Type, argument_field.Type, bindings)
+			}
+		}
+	case *FunctionType:
+		argument, ok := structural(argument).(*FunctionType)
+		if !ok || len(argument.Parameters) != len(parameter.Parameters) {
+			return
+		}
+
+		for i := range parameter.Parameters {
+			unify(parameter.Parameters[i], argument.Parameters[i], bindings)
+		}
+
+		if parameter.Return != nil && argument.Return != nil {
+			unify(parameter.Return, argument.Return, bindings)
+		}
+	}
+}
+
+// finds the instance of origin that typ is defined with, if there is one
+func find_instance(typ Type, origin *NamedType) *NamedType {
+	switch typ := typ.(type) {
+	case *NamedType:
+		if typ == origin || typ.Origin == origin {
+			return typ
+		}
+
+		for _, implementation := range typ.Implements {
+			if instance := find_instance(implementation, origin); instance != nil {
+				return instance
+			}
+		}
+
+		if trait, ok := typ.Underlying.(*TraitType); ok {
+			for _, mimic := range trait.Mimics {
+				if instance := find_instance(mimic, origin); instance != nil {
+					return instance
+				}
+			}
+		}
+
+		if typ.Underlying != nil {
+			return find_instance(typ.Underlying, origin)
+		}
+	case *LiteralType:
+		return find_instance(typ.Type, origin)
+	case *TypeParameter:
+		if typ.Constraint != nil {
+			return find_instance(typ.Constraint, origin)
+		}
+	case *IntersectionType:
+		for _, member := range typ.Types {
+			if instance := find_instance(member, origin); instance != nil {
+				return instance
+			}
+		}
+	}
+
+	return nil
+}
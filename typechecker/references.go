@@ -0,0 +1,67 @@
+package typechecker
+
+import (
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+type ReferenceKind int
+
+const (
+	VariableReference ReferenceKind = iota
+	FunctionReference
+	TypeReference
+	FieldReference
+	MethodReference
+)
+
+// Reference is a name of a checked program together with what it resolves to.
+// The checker records one for every name it defines or resolves so that tools
+// can find the type of a name and the place it is defined.
+type Reference struct {
+	Name     string
+	Kind     ReferenceKind
+	Type     Type
+	Location errors.Location
+	// the location of the name that defines it, empty for the builtin types and fields
+	Definition errors.Location
+}
+
+// IsDefinition reports whether the reference is the name of a definition itself
+func (r Reference) IsDefinition() bool {
+	return r.Location == r.Definition
+}
+
+func (c *Typechecker) refer(name string, kind ReferenceKind, typ Type, location, definition errors.Location) {
+	c.References = append(c.References, Reference{
+		Name:       name,
+		Kind:       kind,
+		Type:       typ,
+		Location:   location,
+		Definition: definition,
+	})
+}
+
+// refers to a variable, variables that are defined with a signature are functions
+func (c *Typechecker) refer_variable(name string, v *variable, location errors.Location) {
+	kind := VariableReference
+
+	if v.Signature != nil {
+		kind = FunctionReference
+	}
+
+	c.refer(name, kind, v.Type, location, v.Location)
+}
+
+// ReferenceAt finds the name at a line and column of a file that the last
+// CheckDefinitions call recorded
+func (c *Typechecker) ReferenceAt(file string, line, column int) (Reference, bool) {
+	for _, reference := range c.References {
+		location := reference.Location
+
+		if location.File == file && location.Start.Line == line && location.Start.Column <= column && column <= location.End.Column {
+			return reference, true
+		}
+	}
+
+	return Reference{}, false
+}
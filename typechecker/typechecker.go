@@ -0,0 +1,571 @@
+package typechecker
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/moonbite-org/moonbite/common"
+	errors "github.com/moonbite-org/moonbite/error"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+)
+
+var builtin_types = []string{"bool", "iterable", "string", "uint8", "uint16", "uint32", "uint64", "int8", "int16", "int32", "int64", "float32", "float64"}
+
+// the types variables get when they are declared with a number literal
+var number_literal_types = map[bool]string{
+	false: "Int",
+	true:  "Float32",
+}
+
+//go:embed prelude.mb
+var prelude []byte
+
+type TypeDefinition struct {
+	Name string
+	Type Type
+	// the location of the name of the definition, empty for the builtin types
+	Location errors.Location
+}
+
+func (d TypeDefinition) String() string {
+	return fmt.Sprintf("<type %s %s>", d.Name, d.Type)
+}
+
+type SymbolTable struct {
+	Symbols map[string]*TypeDefinition
+	Outer   *SymbolTable
+}
+
+func (t SymbolTable) String() string {
+	result := []string{}
+
+	for _, def := range t.Symbols {
+		result = append(result, def.String())
+	}
+
+	return strings.Join(result, "\n")
+}
+
+func (t SymbolTable) Get(name string) *TypeDefinition {
+	if symbol, ok := t.Symbols[name]; ok {
+		return symbol
+	}
+
+	if t.Outer != nil {
+		return t.Outer.Get(name)
+	}
+
+	return nil
+}
+
+func (t SymbolTable) Set(name string, def TypeDefinition) {
+	t.Symbols[name] = &def
+}
+
+type Typechecker struct {
+	SymbolTable SymbolTable
+	// the errors found by the last CheckDefinitions call
+	Diagnostics errors.Diagnostics
+	// the names the last CheckDefinitions call defined or resolved
+	References []Reference
+	scope      *scope
+	function   *function_context
+}
+
+func (c *Typechecker) ResolveLiteral(literal parser.TypeLiteral) (Type, errors.Error) {
+	switch literal.TypeKind() {
+	case parser.TypeIdentifierKind:
+		identifier := literal.(parser.TypeIdentifier)
+
+		// types of other packages are not checked yet
+		if identifier.Name.Kind() == parser.MemberExpressionKind {
+			return Any, errors.EmptyError
+		}
+
+		name := resolve_name(identifier.Name)
+		symbol := c.SymbolTable.Get(name)
+
+		if symbol == nil {
+			return nil, errors.CreateTypeError(fmt.Sprintf("cannot find type '%s'", name), literal.Location())
+		}
+
+		c.refer(name, TypeReference, symbol.Type, identifier.Name.Location(), symbol.Location)
+
+		generics := identifier.Generics
+		named, is_named := symbol.Type.(*NamedType)
+		parameters := []*TypeParameter{}
+
+		if is_named {
+			parameters = named.Parameters
+		}
+
+		if len(parameters) != len(generics) {
+			return nil, errors.CreateTypeError(fmt.Sprintf("type '%s' expects %d arguments but %d provided", name, len(parameters), len(generics)), literal.Location())
+		}
+
+		if len(parameters) == 0 {
+			return symbol.Type, errors.EmptyError
+		}
+
+		arguments := make([]Type, len(parameters))
+
+		for index, generic := range generics {
+			argument, err := c.ResolveLiteral(generic)
+			if err.Exists {
+				return nil, err
+			}
+
+			arguments[index] = argument
+		}
+
+		mapping := bind(parameters, arguments)
+
+		for index, parameter := range parameters {
+			if parameter.Constraint == nil {
+				continue
+			}
+
+			// constraints can refer to the other parameters of the type
+			constraint := substitute(parameter.Constraint, mapping)
+
+			if !IsSubtype(arguments[index], constraint) {
+				return nil, errors.CreateTypeError(fmt.Sprintf("type '%s' does not satisfy '%s'", arguments[index], constraint), generics[index].Location())
+			}
+		}
+
+		return Instantiate(named, arguments), errors.EmptyError
+	case parser.OperatedTypeKind:
+		operated := literal.(parser.OperatedType)
+		left, err := c.ResolveLiteral(operated.LeftHandSide)
+		if err.Exists {
+			return nil, err
+		}
+		right, err := c.ResolveLiteral(operated.RightHandSide)
+		if err.Exists {
+			return nil, err
+		}
+
+		if operated.Operator.Literal == "&" {
+			return &IntersectionType{Types: flatten_intersection(left, right)}, errors.EmptyError
+		}
+
+		return &UnionType{Types: flatten_union(left, right)}, errors.EmptyError
+	case parser.GroupTypeKind:
+		return c.ResolveLiteral(literal.(parser.GroupType).Type)
+	case parser.TypedLiteralKind:
+		typed := literal.(parser.TypedLiteral)
+		typ, err := c.ResolveLiteral(typed.Type)
+		if err.Exists {
+			return nil, err
+		}
+
+		value, err := c.infer(typed.Literal)
+		if err.Exists {
+			return nil, err
+		}
+
+		if !IsSubtype(value, typ) {
+			return nil, errors.CreateTypeError(fmt.Sprintf("literal of type '%s' cannot be used as '%s'", value, typ), typed.Literal.Location())
+		}
+
+		return &LiteralType{Type: typ, Literal: typed.Literal}, errors.EmptyError
+	case parser.StructLiteralKind:
+		result := &StructType{Fields: []Field{}}
+
+		for _, value := range literal.(parser.StructLiteral).Values {
+			if _, ok := result.Field(value.Key.Value); ok {
+				return nil, errors.CreateTypeError(fmt.Sprintf("field '%s' is already defined", value.Key.Value), value.Location)
+			}
+
+			typ, err := c.ResolveLiteral(value.Type)
+			if err.Exists {
+				return nil, err
+			}
+
+			result.Fields = append(result.Fields, Field{Name: value.Key.Value, Type: typ, Hidden: value.Hidden})
+		}
+
+		return result, errors.EmptyError
+	case parser.FunTypeKind:
+		return c.resolve_signature(literal.(parser.FunctionSignature))
+	default:
+		return nil, errors.CreateTypeError(fmt.Sprintf("cannot resolve this type %s", literal.TypeKind()), literal.Location())
+	}
+}
+
+func (c *Typechecker) resolve_signature(signature parser.FunctionSignature) (*FunctionType, errors.Error) {
+	parameters, restore, err := c.with_generics(signature.GetGenerics())
+	defer restore()
+
+	if err.Exists {
+		return nil, err
+	}
+
+	result := &FunctionType{TypeParameters: parameters, Parameters: []Type{}}
+
+	for _, parameter := range signature.GetParameters() {
+		typ, err := c.ResolveLiteral(parameter.Type)
+		if err.Exists {
+			return nil, err
+		}
+
+		result.Parameters = append(result.Parameters, typ)
+		result.Variadic = parameter.Variadic
+	}
+
+	if signature.GetReturnType() != nil {
+		typ, err := c.ResolveLiteral(*signature.GetReturnType())
+		if err.Exists {
+			return nil, err
+		}
+
+		result.Return = typ
+	}
+
+	return result, errors.EmptyError
+}
+
+func flatten_union(types ...Type) []Type {
+	result := []Type{}
+
+	for _, typ := range types {
+		if union, ok := typ.(*UnionType); ok {
+			result = append(result, union.Types...)
+		} else {
+			result = append(result, typ)
+		}
+	}
+
+	return result
+}
+
+func flatten_intersection(types ...Type) []Type {
+	result := []Type{}
+
+	for _, typ := range types {
+		if intersection, ok := typ.(*IntersectionType); ok {
+			result = append(result, intersection.Types...)
+		} else {
+			result = append(result, typ)
+		}
+	}
+
+	return result
+}
+
+func (c *Typechecker) Define(statement parser.TypeDefinitionStatement) errors.Error {
+	if c.SymbolTable.Get(statement.Name.Value) != nil {
+		return errors.CreateTypeError(fmt.Sprintf("type '%s' is already defined", statement.Name.Value), statement.Name.Location())
+	}
+
+	// the type is defined before it is resolved so that its fields can refer to it
+	named := &NamedType{Name: statement.Name.Value, Implements: []Type{}, Parameters: type_parameters(statement.Generics)}
+	c.SymbolTable.Set(statement.Name.Value, TypeDefinition{
+		Name:     statement.Name.Value,
+		Type:     named,
+		Location: statement.Name.Location(),
+	})
+	c.refer(statement.Name.Value, TypeReference, named, statement.Name.Location(), statement.Name.Location())
+
+	restore := c.with_parameters(named.Parameters)
+	defer restore()
+
+	if err := c.constrain(named.Parameters, statement.Generics); err.Exists {
+		delete(c.SymbolTable.Outer.Symbols, statement.Name.Value)
+		return err
+	}
+
+	underlying, err := c.ResolveLiteral(statement.Definition)
+	if err.Exists {
+		delete(c.SymbolTable.Outer.Symbols, statement.Name.Value)
+		return err
+	}
+
+	if refers_to(underlying, named) {
+		delete(c.SymbolTable.Outer.Symbols, statement.Name.Value)
+		return errors.CreateTypeError(fmt.Sprintf("type '%s' cannot be defined in terms of itself", statement.Name.Value), statement.Definition.Location())
+	}
+
+	named.Underlying = underlying
+
+	for _, implementation := range statement.Implementations {
+		trait, err := c.ResolveLiteral(implementation)
+		if err.Exists {
+			return err
+		}
+
+		named.Implements = append(named.Implements, trait)
+	}
+
+	named.complete_instances()
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) DefineTrait(statement parser.TraitDefinitionStatement) errors.Error {
+	if c.SymbolTable.Get(statement.Name.Value) != nil {
+		return errors.CreateTypeError(fmt.Sprintf("type '%s' is already defined", statement.Name.Value), statement.Name.Location())
+	}
+
+	trait := &TraitType{Methods: []Method{}, Mimics: []Type{}}
+	named := &NamedType{Name: statement.Name.Value, Underlying: trait, Implements: []Type{}, Parameters: type_parameters(statement.Generics)}
+	c.SymbolTable.Set(statement.Name.Value, TypeDefinition{
+		Name:     statement.Name.Value,
+		Type:     named,
+		Location: statement.Name.Location(),
+	})
+	c.refer(statement.Name.Value, TypeReference, named, statement.Name.Location(), statement.Name.Location())
+
+	restore := c.with_parameters(named.Parameters)
+	defer restore()
+
+	if err := c.constrain(named.Parameters, statement.Generics); err.Exists {
+		return err
+	}
+
+	for _, signature := range statement.Definition {
+		typ, err := c.resolve_signature(signature)
+		if err.Exists {
+			return err
+		}
+
+		trait.Methods = append(trait.Methods, Method{Name: signature.Name.Value, Type: typ, Location: signature.Name.Location()})
+	}
+
+	for _, mimic := range statement.Mimics {
+		typ, err := c.ResolveLiteral(mimic)
+		if err.Exists {
+			return err
+		}
+
+		if find_instance(typ, named) != nil {
+			return errors.CreateTypeError(fmt.Sprintf("trait '%s' cannot mimic itself", statement.Name.Value), mimic.Location())
+		}
+
+		trait.Mimics = append(trait.Mimics, typ)
+	}
+
+	named.complete_instances()
+
+	return errors.EmptyError
+}
+
+func (c *Typechecker) Check(a, b parser.TypeLiteral) (bool, errors.Error) {
+	left, err := c.ResolveLiteral(a)
+	if err.Exists {
+		return false, err
+	}
+	right, err := c.ResolveLiteral(b)
+	if err.Exists {
+		return false, err
+	}
+
+	return IsSubtype(right, left), errors.EmptyError
+}
+
+// Default creates the value a variable of the given type holds when it is declared without one
+func (c *Typechecker) Default(literal parser.TypeLiteral) common.Object {
+	typ, err := c.ResolveLiteral(literal)
+	if err.Exists {
+		return common.NullObject{}
+	}
+
+	return default_value(typ)
+}
+
+// Primitive returns the default value of a type that is a number or a bool, programs
+// check casts to these types when they run
+func (c *Typechecker) Primitive(literal parser.TypeLiteral) (common.Object, bool) {
+	typ, err := c.ResolveLiteral(literal)
+	if err.Exists {
+		return nil, false
+	}
+
+	named, ok := typ.(*NamedType)
+
+	for ok && named.Underlying != nil {
+		named, ok = named.Underlying.(*NamedType)
+	}
+
+	if !ok {
+		return nil, false
+	}
+
+	switch named.Name {
+	case "bool", "uint8", "uint16", "uint32", "uint64", "int8", "int16", "int32", "int64", "float32", "float64":
+		return default_value(named), true
+	default:
+		return nil, false
+	}
+}
+
+func default_value(typ Type) common.Object {
+	switch typ := typ.(type) {
+	case *NamedType:
+		if typ.Underlying != nil {
+			return default_value(typ.Underlying)
+		}
+
+		switch typ.Name {
+		case "bool":
+			return common.BoolObject{Value: false}
+		case "uint8":
+			return common.Uint8Object{Value: 0}
+		case "uint16":
+			return common.Uint16Object{Value: 0}
+		case "uint32":
+			return common.Uint32Object{Value: 0}
+		case "uint64":
+			return common.Uint64Object{Value: 0}
+		case "int8":
+			return common.Int8Object{Value: 0}
+		case "int16":
+			return common.Int16Object{Value: 0}
+		case "int32":
+			return common.Int32Object{Value: 0}
+		case "int64":
+			return common.Int64Object{Value: 0}
+		case "float32":
+			return common.Float32Object{Value: 0}
+		case "float64":
+			return common.Float64Object{Value: 0}
+		case "string":
+			return common.ListObject{Value: []common.Object{}, Text: true}
+		case "iterable":
+			return common.ListObject{Value: []common.Object{}}
+		default:
+			return common.NullObject{}
+		}
+	case *UnionType:
+		return default_value(typ.Types[0])
+	case *IntersectionType:
+		return default_value(typ.Types[0])
+	case *LiteralType:
+		return common.ObjectFromLiteral(typ.Literal)
+	case *StructType:
+		result := common.MapObject{}
+
+		for _, field := range typ.Fields {
+			result.Value = append(result.Value, struct {
+				Key   common.Object
+				Value common.Object
+			}{common.StringObject{Value: field.Name}, default_value(field.Type)})
+		}
+
+		return result
+	default:
+		return common.NullObject{}
+	}
+}
+
+// creates the parameters of a generic definition in the order they are declared
+func type_parameters(generics map[string]parser.ConstrainedType) []*TypeParameter {
+	result := make([]*TypeParameter, len(generics))
+
+	for _, generic := range generics {
+		result[generic.Index] = &TypeParameter{Name: generic.Name.Value}
+	}
+
+	return result
+}
+
+// resolves the constraints of the parameters once all of them are visible
+func (c *Typechecker) constrain(parameters []*TypeParameter, generics map[string]parser.ConstrainedType) errors.Error {
+	for _, generic := range generics {
+		if generic.Constraint == nil {
+			continue
+		}
+
+		constraint, err := c.ResolveLiteral(*generic.Constraint)
+		if err.Exists {
+			return err
+		}
+
+		parameters[generic.Index].Constraint = constraint
+	}
+
+	return errors.EmptyError
+}
+
+// makes the parameters visible as types until the returned function is called
+func (c *Typechecker) with_parameters(parameters []*TypeParameter) func() {
+	previous := c.SymbolTable
+	c.SymbolTable = SymbolTable{
+		Symbols: map[string]*TypeDefinition{},
+		Outer:   &previous,
+	}
+
+	for _, parameter := range parameters {
+		c.SymbolTable.Set(parameter.Name, TypeDefinition{
+			Name: parameter.Name,
+			Type: parameter,
+		})
+	}
+
+	return func() {
+		c.SymbolTable = previous
+	}
+}
+
+// creates the parameters of a generic function and makes them visible until the returned function is called
+func (c *Typechecker) with_generics(generics map[string]parser.ConstrainedType) ([]*TypeParameter, func(), errors.Error) {
+	parameters := type_parameters(generics)
+	restore := c.with_parameters(parameters)
+
+	return parameters, restore, c.constrain(parameters, generics)
+}
+
+func New() *Typechecker {
+	checker := &Typechecker{
+		SymbolTable: SymbolTable{
+			Symbols: map[string]*TypeDefinition{},
+		},
+		scope: new_scope(nil),
+	}
+
+	checker.SymbolTable.Set("any", TypeDefinition{Name: "any", Type: Any})
+
+	for _, name := range builtin_types {
+		checker.SymbolTable.Set(name, TypeDefinition{
+			Name: name,
+			Type: &NamedType{Name: name, Implements: []Type{}},
+		})
+	}
+
+	ast, err := parser.Parse(prelude, "prelude.mb")
+	if err.Exists {
+		panic(err.String())
+	}
+
+	checker.define_types(ast.Definitions)
+
+	if checker.Diagnostics.Exists() {
+		panic(checker.Diagnostics.String())
+	}
+
+	// the methods of the prelude are bound in lib/types.mb, which is not checked
+	for _, symbol := range checker.SymbolTable.Symbols {
+		if named, ok := symbol.Type.(*NamedType); ok {
+			for _, trait := range named.Implements {
+				named.Methods = append(named.Methods, trait_methods(trait)...)
+			}
+		}
+	}
+
+	return checker
+}
+
+func resolve_name(name parser.Expression) string {
+	switch name.Kind() {
+	case parser.IdentifierExpressionKind:
+		return name.(parser.IdentifierExpression).Value
+	case parser.MemberExpressionKind:
+		left := resolve_name(name.(parser.MemberExpression).LeftHandSide)
+		right := name.(parser.MemberExpression).RightHandSide.Value
+
+		return fmt.Sprintf("%s.%s", left, right)
+	default:
+		return "cannot resolve"
+	}
+}
@@ -0,0 +1,600 @@
+package typechecker_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/common"
+	errors "github.com/moonbite-org/moonbite/error"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+	"github.com/moonbite-org/moonbite/typechecker"
+)
+
+func check(t *testing.T, source string) errors.Error {
+	ast, err := parser.Parse([]byte("package main\n\n"+source), "main.mb")
+	if err.Exists {
+		t.Fatalf("expected no syntax error but got: %s", err)
+	}
+
+	return typechecker.New().CheckDefinitions(ast.Definitions)
+}
+
+func assert_no_error(t *testing.T, err errors.Error) {
+	if err.Exists {
+		t.Errorf("expected no error but got: %s", err)
+	}
+}
+
+func assert_type_error(t *testing.T, err errors.Error, line int) {
+	if !err.Exists {
+		t.Errorf("expected error but no error is present")
+		return
+	}
+
+	if err.Kind != errors.TypeError {
+		t.Errorf("expected a type error but got: %s", err)
+	}
+
+	if err.Location.Start.Line != line {
+		t.Errorf("expected error to be at line %d but got: %s", line, err)
+	}
+}
+
+func TestValidProgram(t *testing.T) {
+	assert_no_error(t, check(t, `type Celsius Int
+
+var total = 0
+
+fun add(a Int, b Int) Int {
+  return a + b
+}
+
+fun describe(value Celsius) String {
+  var String name = "cold"
+  if (value > 20) {
+    name = "warm"
+  }
+  return name
+}
+
+fun main() {
+  for (var i = 0; i < 5; i++) {
+    total = add(total, i)
+  }
+
+  var Celsius c
+  describe(c)
+}`))
+}
+
+func TestDeclarations(t *testing.T) {
+	assert_type_error(t, check(t, `var Bool flag = 5`), 3)
+	assert_type_error(t, check(t, `var String name = true`), 3)
+	assert_type_error(t, check(t, `var Missing value`), 3)
+	assert_no_error(t, check(t, `var Float64 ratio = 5`))
+}
+
+func TestNumberLiterals(t *testing.T) {
+	assert_no_error(t, check(t, `var Float32 ratio = 3.5`))
+	assert_no_error(t, check(t, `var Uint8 small = 255`))
+	assert_no_error(t, check(t, `var Int8 low = -128`))
+	assert_type_error(t, check(t, `var Int whole = 3.5`), 3)
+	assert_type_error(t, check(t, `var Uint8 small = 300`), 3)
+	assert_type_error(t, check(t, `var Uint8 small = -1`), 3)
+	assert_type_error(t, check(t, `var Int8 low = -129`), 3)
+}
+
+func TestAssignments(t *testing.T) {
+	assert_type_error(t, check(t, `fun main() {
+  var count = 0
+  count = "many"
+}`), 5)
+}
+
+func TestCallArguments(t *testing.T) {
+	assert_type_error(t, check(t, `fun greet(name String) {}
+
+fun main() {
+  greet(true)
+}`), 6)
+
+	assert_type_error(t, check(t, `fun greet(name String) {}
+
+fun main() {
+  greet("a", "b")
+}`), 6)
+}
+
+func TestReturnTypes(t *testing.T) {
+	assert_type_error(t, check(t, `fun answer() Int {
+  return "42"
+}`), 4)
+
+	assert_type_error(t, check(t, `fun answer() Int {
+  return
+}`), 4)
+
+	assert_type_error(t, check(t, `fun nothing() {
+  return 1
+}`), 4)
+}
+
+func TestSubtypes(t *testing.T) {
+	// a named type can be used where the type it is defined with is expected but not the other way around
+	assert_no_error(t, check(t, `type Celsius Int
+
+fun main() {
+  var Celsius c
+  var Int i = c
+}`))
+
+	assert_type_error(t, check(t, `type Celsius Int
+
+fun main() {
+  var Int i
+  var Celsius c = i
+}`), 7)
+}
+
+func TestDefault(t *testing.T) {
+	checker := typechecker.New()
+	ast, err := parser.Parse([]byte(`package main
+
+type Point {
+  x Int;
+  y Float64;
+}
+
+var Bool flag
+var Int count
+var String name
+var Point point
+`), "main.mb")
+	if err.Exists {
+		t.Fatalf("expected no syntax error but got: %s", err)
+	}
+
+	assert_no_error(t, checker.CheckDefinitions(ast.Definitions))
+
+	expected := []common.ObjectKind{common.BoolObjectKind, common.Int32ObjectKind, common.ListObjectKind, common.MapObjectKind}
+
+	for i, definition := range ast.Definitions[1:] {
+		declaration := definition.(parser.DeclarationStatement)
+		value := checker.Default(*declaration.Type)
+
+		if value.Kind() != expected[i] {
+			t.Errorf("expected default of '%s' to be %s but got %s", declaration.Name.Value, expected[i], value.Kind())
+		}
+	}
+
+	point := checker.Default(*ast.Definitions[4].(parser.DeclarationStatement).Type).(common.MapObject)
+	if point.Value[1].Value.Kind() != common.Float64ObjectKind {
+		t.Errorf("expected field 'y' to default to %s but got %s", common.Float64ObjectKind, point.Value[1].Value.Kind())
+	}
+}
+
+func TestUnions(t *testing.T) {
+	assert_no_error(t, check(t, `type Id Int | String
+
+fun find(id Id) {}
+
+fun main() {
+  var Int i
+  find(i)
+  find("admin")
+  var Number n = i
+}`))
+
+	assert_type_error(t, check(t, `type Id Int | String
+
+fun main() {
+  var Id id
+  var Int i = id
+}`), 7)
+
+	assert_type_error(t, check(t, `type Id Int | String
+
+fun find(id Id) {}
+
+fun main() {
+  find(true)
+}`), 8)
+}
+
+func TestIntersections(t *testing.T) {
+	assert_no_error(t, check(t, `trait Named {
+  fun name() String
+}
+
+type Person implements [Named, Printable] { name String; }
+
+fun for Person name() String {
+  return this.name
+}
+
+fun for Person string() string {
+  return this.name
+}
+
+fun show(value Named & Printable) {}
+
+fun main() {
+  var Person p
+  show(p)
+}`))
+
+	assert_type_error(t, check(t, `trait Named {
+  fun name() String
+}
+
+type Person implements [Named] { name String; }
+
+fun for Person name() String {
+  return this.name
+}
+
+fun show(value Named & Printable) {}
+
+fun main() {
+  var Person p
+  show(p)
+}`), 17)
+}
+
+func TestStructs(t *testing.T) {
+	assert_no_error(t, check(t, `type Point { x Int; y Int; }
+type Pixel { x Int; y Int; color String; }
+
+fun length(p { x Int; y Int; }) Int {
+  return p.x + p.y
+}
+
+fun main() {
+  var Pixel pixel = Pixel{ x: 1, y: 2, color: "red" }
+  length(pixel)
+  length(Point{ x: 1, y: 2 })
+}`))
+
+	assert_type_error(t, check(t, `type Point { x Int; y Int; }
+
+fun main() {
+  var Point p = Point{ x: 1, z: 2 }
+}`), 6)
+
+	assert_type_error(t, check(t, `type Point { x Int; y Int; }
+
+fun main() {
+  var Point p
+  var String s = p.x
+}`), 7)
+}
+
+func TestStructLiterals(t *testing.T) {
+	assert_no_error(t, check(t, `type Point { x Int; y Int; }
+
+fun main() {
+  var Point p = {x: 1, y: 2}
+  var Point q = Point{ x: 1, y: 2 }
+  p = {x: 3, y: 4, z: 5}
+}`))
+
+	assert_type_error(t, check(t, `type Point { x Int; y Int; }
+
+fun main() {
+  var Point p = {x: 1, y: "no"}
+}`), 6)
+
+	assert_type_error(t, check(t, `type Point { x Int; y Int; }
+
+fun main() {
+  var Point p = {x: 1}
+}`), 6)
+
+	assert_type_error(t, check(t, `type Point { x Int; y Int; }
+
+fun main() {
+  var Point p = Point{ x: 1 }
+}`), 6)
+
+	assert_type_error(t, check(t, `type Point { x Int; y Int; }
+
+fun origin() Point {
+  return {x: 0}
+}`), 6)
+}
+
+func TestFunctions(t *testing.T) {
+	assert_no_error(t, check(t, `fun twice(value Int) Int {
+  return value * 2
+}
+
+fun apply(f fun(value Int) Int) Int {
+  return f(1)
+}
+
+fun main() {
+  apply(twice)
+}`))
+
+	assert_type_error(t, check(t, `fun shout(value String) String {
+  return value
+}
+
+fun apply(f fun(value Int) Int) Int {
+  return f(1)
+}
+
+fun main() {
+  apply(shout)
+}`), 12)
+}
+
+func TestLiteralTypes(t *testing.T) {
+	assert_no_error(t, check(t, `type Role String("admin") | String("user")
+
+fun main() {
+  var Role role = "admin"
+  var String name = role
+}`))
+
+	assert_type_error(t, check(t, `type Role String("admin") | String("user")
+
+fun main() {
+  var Role role = "guest"
+}`), 6)
+}
+
+func TestDeepHierarchies(t *testing.T) {
+	source := "type T0 Int\n"
+	for i := 1; i < 64; i++ {
+		source += fmt.Sprintf("type T%d T%d\n", i, i-1)
+	}
+	source += "fun main() {\n  var T63 deep\n  var Int i = deep\n  var T32 middle = deep\n}"
+
+	assert_no_error(t, check(t, source))
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	assert_no_error(t, check(t, `type Node { value Int; next Node; }`))
+	assert_type_error(t, check(t, `type Loop Int | Loop`), 3)
+}
+
+func TestGenericInstantiation(t *testing.T) {
+	assert_no_error(t, check(t, `fun main() {
+  var IteratorResult<Int> result = IteratorResult{ value: 1, is_done: false }
+  var Int value = result.value
+  var List<Int> numbers = [1, 2, 3]
+  var Int number = numbers[0]
+  var List<Rune> runes = "abc"
+}`))
+
+	assert_type_error(t, check(t, `fun main() {
+  var IteratorResult<Int> result
+  var String value = result.value
+}`), 5)
+
+	assert_type_error(t, check(t, `fun main() {
+  var List<Int> numbers = ["one", "two"]
+}`), 4)
+
+	assert_type_error(t, check(t, `type Counter implements [Saturable<Int>] Int
+
+fun for Counter default() Int {
+  return 0
+}
+
+fun reset(value Saturable<String>) {}
+
+fun main() {
+  var Counter counter
+  reset(counter)
+}`), 13)
+}
+
+func TestGenericConstraints(t *testing.T) {
+	assert_no_error(t, check(t, `type Box<T Number> { value T; }
+
+var Box<Int> box`))
+
+	assert_type_error(t, check(t, `type Box<T Number> { value T; }
+
+var Box<String> box`), 5)
+
+	assert_type_error(t, check(t, `type Box<T Number> { value T; }
+
+fun main() {
+  var box = Box{ value: "one" }
+}`), 6)
+
+	assert_type_error(t, check(t, `var List<Int, String> pairs`), 3)
+}
+
+func TestGenericInference(t *testing.T) {
+	assert_no_error(t, check(t, `fun first<T>(items List<T>) T {
+  return items[0]
+}
+
+fun wrap<T>(value T) IteratorResult<T> {
+  return IteratorResult{ value: value, is_done: false }
+}
+
+fun main() {
+  var numbers = [1, 2]
+  var Int number = first(numbers)
+  var Rune letter = first("abc")
+  var String name = wrap("admin").value
+}`))
+
+	assert_type_error(t, check(t, `fun first<T>(items List<T>) T {
+  return items[0]
+}
+
+fun main() {
+  var numbers = [1, 2]
+  var String name = first(numbers)
+}`), 9)
+
+	assert_type_error(t, check(t, `fun larger<T Number>(a T, b T) T {
+  return a
+}
+
+fun main() {
+  larger("a", "b")
+}`), 8)
+
+	assert_type_error(t, check(t, `fun pick<T>(a T, b T) T {
+  return a
+}
+
+fun main() {
+  var Bool flag
+  pick(1, flag)
+}`), 9)
+
+	// a type parameter can only be used as what its constraint allows
+	assert_type_error(t, check(t, `fun name<T>(value T) String {
+  return value
+}`), 4)
+}
+
+func TestConformance(t *testing.T) {
+	assert_no_error(t, check(t, `trait Writable {
+  fun write(p List<Byte>) Int
+}
+
+trait Readable {
+  fun read(p List<Byte>) Int
+}
+
+trait Streamable mimics [Writable, Readable] {}
+
+type File implements [Streamable] { name String; }
+
+fun for File write(p List<Byte>) Int {
+  return 0
+}
+
+fun for File read(p List<Byte>) Int {
+  return 0
+}
+
+type Celsius implements [Printable] Int`))
+
+	// a method that a mimicked trait requires is missing
+	assert_type_error(t, check(t, `trait Writable {
+  fun write(p List<Byte>) Int
+}
+
+trait Streamable mimics [Writable] {}
+
+type File implements [Streamable] { name String; }`), 9)
+
+	assert_type_error(t, check(t, `type Temperature implements [Printable] { degrees Int; }
+
+fun for Temperature string() Int {
+  return this.degrees
+}`), 5)
+
+	// methods of generic types are checked with their arguments
+	assert_no_error(t, check(t, `type Stack<T> implements [Iterable<T>] { items List<T>; }
+
+fun for Stack next() IteratorResult<T> {
+  return IteratorResult{ value: this.items[0], is_done: false }
+}`))
+
+	assert_type_error(t, check(t, `type Stack<T> implements [Iterable<T>] { items List<T>; }
+
+fun for Stack next() IteratorResult<Int> {
+  return IteratorResult{ value: 0, is_done: false }
+}`), 5)
+
+	assert_type_error(t, check(t, `type Point { x Int; }
+
+fun for Point length() Int {
+  return this.x
+}
+
+fun for Point length() Int {
+  return 0
+}`), 9)
+
+	assert_type_error(t, check(t, `type Celsius implements [Int] Int`), 3)
+
+	assert_type_error(t, check(t, `trait Sized {
+  fun size() Int
+}
+
+trait Measured {
+  fun size() String
+}
+
+trait Box mimics [Sized, Measured] {}`), 11)
+
+	assert_type_error(t, check(t, `trait Loop mimics [Loop] {}`), 3)
+
+	// a type that is defined again is not checked against the traits of the first one
+	assert_type_error(t, check(t, `type String string`), 3)
+}
+
+func TestDiagnostics(t *testing.T) {
+	ast, err := parser.Parse([]byte(`package main
+
+var Bool flag = 5
+
+fun main() {
+  var String name = true
+  var Int count = "many"
+}
+
+fun answer() Int {
+  return "42"
+}`), "main.mb")
+	if err.Exists {
+		t.Fatalf("expected no syntax error but got: %s", err)
+	}
+
+	checker := typechecker.New()
+	assert_type_error(t, checker.CheckDefinitions(ast.Definitions), 3)
+
+	lines := []int{3, 6, 7, 11}
+	if len(checker.Diagnostics) != len(lines) {
+		t.Fatalf("expected %d errors but got:\n%s", len(lines), checker.Diagnostics)
+	}
+
+	for i, line := range lines {
+		assert_type_error(t, checker.Diagnostics[i], line)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	ast, err := parser.Parse([]byte(`package main
+
+type Point { x Int; }
+
+fun main() {
+  var Point p
+  var value = p.x
+}`), "main.mb")
+	if err.Exists {
+		t.Fatalf("expected no syntax error but got: %s", err)
+	}
+
+	checker := typechecker.New()
+	assert_no_error(t, checker.CheckDefinitions(ast.Definitions))
+
+	// the type of the variable 'p' refers to the definition of 'Point'
+	reference, ok := checker.ReferenceAt("main.mb", 6, 8)
+	if !ok || reference.Kind != typechecker.TypeReference || reference.Definition.Start.Line != 3 {
+		t.Errorf("expected a reference to 'Point' but got: %+v", reference)
+	}
+
+	reference, ok = checker.ReferenceAt("main.mb", 7, 15)
+	if !ok || reference.Name != "p" || reference.Definition.Start.Line != 6 || reference.IsDefinition() {
+		t.Errorf("expected a reference to 'p' but got: %+v", reference)
+	}
+
+	reference, ok = checker.ReferenceAt("main.mb", 7, 7)
+	if !ok || !reference.IsDefinition() || reference.Type.String() != "Int" {
+		t.Errorf("expected the definition of 'value' but got: %+v", reference)
+	}
+}
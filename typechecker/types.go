@@ -0,0 +1,458 @@
+package typechecker
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	errors "github.com/moonbite-org/moonbite/error"
+	parser "github.com/moonbite-org/moonbite/parser/cmd"
+)
+
+// Type is the resolved form of a parser.TypeLiteral
+type Type interface {
+	String() string
+}
+
+type AnyType struct{}
+
+func (t *AnyType) String() string {
+	return "any"
+}
+
+// Any is assignable to and from every type, values of unknown types have it
+var Any = &AnyType{}
+
+// number literals are not bound to a type until they are stored somewhere
+type NumberLiteralType struct {
+	Float bool
+	Value float64
+}
+
+func (t *NumberLiteralType) String() string {
+	if t.Float {
+		return "float literal"
+	}
+
+	return "int literal"
+}
+
+// map literals are not bound to a type until they are stored somewhere, they fit in
+// any type except the structs whose fields they do not have
+type MapLiteralType struct {
+	Fields []Field
+}
+
+func (t *MapLiteralType) String() string {
+	return fmt.Sprintf("map literal %s", &StructType{Fields: t.Fields})
+}
+
+// NamedType is a type that is created with a type definition, two named types
+// are only related when one is defined in terms of the other
+type NamedType struct {
+	Name string
+	// builtin types have no underlying type
+	Underlying Type
+	Implements []Type
+	// generic types declare parameters, their instances refer back to them
+	// and hold the arguments they are created with
+	Parameters []*TypeParameter
+	Origin     *NamedType
+	Arguments  []Type
+	// the functions bound to the type with 'fun for'
+	Methods   []Method
+	instances map[string]*NamedType
+}
+
+func (t *NamedType) String() string {
+	if len(t.Arguments) > 0 {
+		return fmt.Sprintf("%s<%s>", t.Name, join_types(t.Arguments, ", "))
+	}
+
+	return t.Name
+}
+
+// TypeParameter stands for a generic argument inside the definition that declares it
+type TypeParameter struct {
+	Name string
+	// unconstrained parameters accept every argument
+	Constraint Type
+}
+
+func (t *TypeParameter) String() string {
+	return t.Name
+}
+
+type UnionType struct {
+	Types []Type
+}
+
+func (t *UnionType) String() string {
+	return join_types(t.Types, " | ")
+}
+
+type IntersectionType struct {
+	Types []Type
+}
+
+func (t *IntersectionType) String() string {
+	return join_types(t.Types, " & ")
+}
+
+type Field struct {
+	Name   string
+	Type   Type
+	Hidden bool
+}
+
+type StructType struct {
+	Fields []Field
+}
+
+func (t *StructType) String() string {
+	fields := []string{}
+
+	for _, field := range t.Fields {
+		fields = append(fields, fmt.Sprintf("%s %s", field.Name, field.Type))
+	}
+
+	return fmt.Sprintf("{ %s }", strings.Join(fields, "; "))
+}
+
+func (t *StructType) Field(name string) (Field, bool) {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return Field{}, false
+}
+
+type FunctionType struct {
+	// generic functions infer these from their arguments at every call
+	TypeParameters []*TypeParameter
+	Parameters     []Type
+	Variadic       bool
+	// functions that do not return a value have no return type
+	Return Type
+}
+
+func (t *FunctionType) String() string {
+	parameters := []string{}
+
+	for i, parameter := range t.Parameters {
+		if t.Variadic && i == len(t.Parameters)-1 {
+			parameters = append(parameters, "..."+parameter.String())
+		} else {
+			parameters = append(parameters, parameter.String())
+		}
+	}
+
+	result := fmt.Sprintf("fun(%s)", strings.Join(parameters, ", "))
+
+	if t.Return != nil {
+		result += " " + t.Return.String()
+	}
+
+	return result
+}
+
+type Method struct {
+	Name     string
+	Type     *FunctionType
+	Location errors.Location
+}
+
+type TraitType struct {
+	Methods []Method
+	Mimics  []Type
+}
+
+func (t *TraitType) String() string {
+	methods := []string{}
+
+	for _, method := range t.Methods {
+		methods = append(methods, method.Name+strings.TrimPrefix(method.Type.String(), "fun"))
+	}
+
+	return fmt.Sprintf("trait { %s }", strings.Join(methods, "; "))
+}
+
+// LiteralType only holds the single value it is created with, such as String("admin")
+type LiteralType struct {
+	Type    Type
+	Literal parser.LiteralExpression
+}
+
+func (t *LiteralType) String() string {
+	return fmt.Sprintf("%s(%s)", t.Type, literal_value(t.Literal))
+}
+
+func literal_value(literal parser.LiteralExpression) string {
+	switch literal := literal.(type) {
+	case parser.StringLiteralExpression:
+		return fmt.Sprintf("%q", literal.Value)
+	case parser.RuneLiteralExpression:
+		return fmt.Sprintf("'%c'", literal.Value)
+	case parser.BoolLiteralExpression:
+		return fmt.Sprintf("%t", literal.Value)
+	case parser.NumberLiteralExpression:
+		return fmt.Sprintf("%v", literal.Value.Value)
+	default:
+		return string(literal.LiteralKind())
+	}
+}
+
+func join_types(types []Type, separator string) string {
+	result := []string{}
+
+	for _, typ := range types {
+		result = append(result, typ.String())
+	}
+
+	return strings.Join(result, separator)
+}
+
+// IsSubtype reports whether a value of type value can be used where target is expected
+func IsSubtype(value, target Type) bool {
+	// values of unknown types are only checked at runtime
+	if value == Any || target == Any {
+		return true
+	}
+
+	if value == target {
+		return true
+	}
+
+	switch value := value.(type) {
+	case *NumberLiteralType:
+		// an int literal fits wherever a float literal does
+		if target, ok := target.(*NumberLiteralType); ok {
+			return !value.Float || target.Float
+		}
+
+		return fits_number(value, target)
+	case *MapLiteralType:
+		switch structure := structural(target).(type) {
+		case *StructType:
+			return IsSubtype(&StructType{Fields: value.Fields}, structure)
+		case *UnionType, *IntersectionType:
+			// the members are checked one by one below
+		default:
+			return true
+		}
+	case *UnionType:
+		for _, typ := range value.Types {
+			if !IsSubtype(typ, target) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	switch target := target.(type) {
+	case *IntersectionType:
+		for _, typ := range target.Types {
+			if !IsSubtype(value, typ) {
+				return false
+			}
+		}
+
+		return true
+	case *UnionType:
+		for _, typ := range target.Types {
+			if IsSubtype(value, typ) {
+				return true
+			}
+		}
+	}
+
+	if value, ok := value.(*IntersectionType); ok {
+		for _, typ := range value.Types {
+			if IsSubtype(typ, target) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// a type parameter can only be used as what its constraint allows
+	if value, ok := value.(*TypeParameter); ok {
+		return value.Constraint != nil && IsSubtype(value.Constraint, target)
+	}
+
+	switch target := target.(type) {
+	case *NamedType:
+		// named unions and intersections only group their members
+		switch target.Underlying.(type) {
+		case *UnionType, *IntersectionType:
+			if IsSubtype(value, target.Underlying) {
+				return true
+			}
+		}
+
+		return is_nominal_subtype(value, target)
+	case *StructType:
+		value, ok := structural(value).(*StructType)
+		if !ok {
+			return false
+		}
+
+		for _, field := range target.Fields {
+			value_field, ok := value.Field(field.Name)
+
+			if !ok || !IsSubtype(value_field.Type, field.Type) {
+				return false
+			}
+		}
+
+		return true
+	case *FunctionType:
+		value, ok := structural(value).(*FunctionType)
+		if !ok || len(value.Parameters) != len(target.Parameters) || value.Variadic != target.Variadic {
+			return false
+		}
+
+		// parameters are contravariant, return types are covariant
+		for i := range target.Parameters {
+			if !IsSubtype(target.Parameters[i], value.Parameters[i]) {
+				return false
+			}
+		}
+
+		if target.Return == nil {
+			return true
+		}
+
+		return value.Return != nil && IsSubtype(value.Return, target.Return)
+	case *LiteralType:
+		value, ok := value.(*LiteralType)
+
+		return ok && literal_value(value.Literal) == literal_value(target.Literal) && IsSubtype(value.Type, target.Type)
+	}
+
+	return false
+}
+
+// walks the types value is defined with until it finds target
+func is_nominal_subtype(value Type, target *NamedType) bool {
+	switch value := value.(type) {
+	case *NamedType:
+		if value == target {
+			return true
+		}
+
+		// instances of the same generic type are related through their arguments
+		if value.Origin != nil && value.Origin == target.Origin {
+			return slices.EqualFunc(value.Arguments, target.Arguments, IsSubtype)
+		}
+
+		for _, implementation := range value.Implements {
+			if IsSubtype(implementation, target) {
+				return true
+			}
+		}
+
+		if trait, ok := value.Underlying.(*TraitType); ok {
+			return slices.ContainsFunc(trait.Mimics, func(mimic Type) bool {
+				return IsSubtype(mimic, target)
+			})
+		}
+
+		if value.Underlying == nil {
+			return false
+		}
+
+		return IsSubtype(value.Underlying, target)
+	case *LiteralType:
+		return IsSubtype(value.Type, target)
+	default:
+		return false
+	}
+}
+
+// the struct or function type a named type is defined with
+func structural(typ Type) Type {
+	for {
+		switch t := typ.(type) {
+		case *NamedType:
+			if t.Underlying == nil {
+				return t
+			}
+			typ = t.Underlying
+		case *LiteralType:
+			typ = t.Type
+		case *TypeParameter:
+			if t.Constraint == nil {
+				return t
+			}
+			typ = t.Constraint
+		default:
+			return typ
+		}
+	}
+}
+
+// the values the integer builtins can hold
+var integer_ranges = map[string][2]float64{
+	"uint8":  {0, math.MaxUint8},
+	"uint16": {0, math.MaxUint16},
+	"uint32": {0, math.MaxUint32},
+	"uint64": {0, math.MaxUint64},
+	"int8":   {math.MinInt8, math.MaxInt8},
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"int32":  {math.MinInt32, math.MaxInt32},
+	"int64":  {math.MinInt64, math.MaxInt64},
+}
+
+// reports whether a number literal can be stored in a numeric type, fractions are
+// only stored in floats and integers only when they are in the range of the type
+func fits_number(literal *NumberLiteralType, typ Type) bool {
+	switch typ := typ.(type) {
+	case *AnyType:
+		return true
+	case *NamedType:
+		if typ.Underlying != nil {
+			return fits_number(literal, typ.Underlying)
+		}
+
+		if typ.Name == "float32" || typ.Name == "float64" {
+			return true
+		}
+
+		bounds, ok := integer_ranges[typ.Name]
+		return ok && !literal.Float && literal.Value >= bounds[0] && literal.Value <= bounds[1]
+	case *LiteralType:
+		return fits_number(literal, typ.Type)
+	case *UnionType:
+		return slices.ContainsFunc(typ.Types, func(t Type) bool { return fits_number(literal, t) })
+	case *IntersectionType:
+		return slices.ContainsFunc(typ.Types, func(t Type) bool { return fits_number(literal, t) })
+	default:
+		return false
+	}
+}
+
+// reports whether a type refers to itself without a struct or a function in between
+func refers_to(typ Type, named *NamedType) bool {
+	switch typ := typ.(type) {
+	case *NamedType:
+		if typ == named {
+			return true
+		}
+
+		return typ.Underlying != nil && refers_to(typ.Underlying, named)
+	case *UnionType:
+		return slices.ContainsFunc(typ.Types, func(t Type) bool { return refers_to(t, named) })
+	case *IntersectionType:
+		return slices.ContainsFunc(typ.Types, func(t Type) bool { return refers_to(t, named) })
+	case *LiteralType:
+		return refers_to(typ.Type, named)
+	default:
+		return false
+	}
+}
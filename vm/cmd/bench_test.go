@@ -0,0 +1,155 @@
+package cmd_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
+	compiler "github.com/moonbite-org/moonbite/compiler/cmd"
+	vm "github.com/moonbite-org/moonbite/vm/cmd"
+)
+
+// compiles a root package, plain keeps the sequences that are otherwise fused
+func compile_source(tb testing.TB, source string, plain bool) *compiler.Module {
+	dir := tb.TempDir()
+
+	if err := os.WriteFile(path.Join(dir, "moon.yml"), []byte("module: test\n"), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := os.WriteFile(path.Join(dir, "main.mb"), []byte(source), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	c := compiler.New(dir, abi.NativeABI)
+	c.NoSuperinstructions = plain
+
+	if err := c.Compile(); err.Exists {
+		tb.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	return c.Modules["root"]
+}
+
+var workloads = []struct {
+	name   string
+	source string
+}{
+	{"Loop", `package main
+
+fun main() {
+  var total = 0
+  for (var i = 0; i < 20000; i++) {
+    total += 3
+  }
+  exit(total)
+}
+`},
+	{"NestedLoops", `package main
+
+fun main() {
+  var total = 0
+  for (var i = 0; i < 150; i++) {
+    for (var j = 0; j <= i; j++) {
+      if (j == i) {
+        total++
+      } else if (j != 0) {
+        total += 2
+      }
+    }
+  }
+  exit(total)
+}
+`},
+	{"Index", `package main
+
+fun main() {
+  var list = [1, 2, 3, 4]
+  var total = 0
+  for (var i = 0; i < 10000; i++) {
+    total = total + list[0] + list[3]
+  }
+  exit(total)
+}
+`},
+	{"Fib", `package main
+
+fun fib(n Int) Int {
+  if (n < 2) {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}
+
+fun main() {
+  exit(fib(18))
+}
+`},
+}
+
+// every workload is run with and without superinstructions to compare them
+func BenchmarkWorkloads(b *testing.B) {
+	for _, workload := range workloads {
+		for _, plain := range []bool{false, true} {
+			name := workload.name + "/superinstructions"
+			if plain {
+				name = workload.name + "/plain"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				root := compile_source(b, workload.source, plain).Compiler
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					machine := vm.New(root.Instructions, root.ConstantPool, abi.NativeABI)
+
+					if err := machine.Run(); err.Exists {
+						b.Fatalf("expected no runtime error but got: %s", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func count_ops(pool common.ConstantPool, instructions common.InstructionSet) map[common.Op]int {
+	result := map[common.Op]int{}
+
+	for _, instruction := range instructions {
+		result[instruction.Op]++
+	}
+
+	for _, constant := range pool.Values {
+		if fun, ok := constant.(common.FunctionObject); ok {
+			for _, instruction := range fun.Value {
+				result[instruction.Op]++
+			}
+		}
+	}
+
+	return result
+}
+
+// the workloads give the same results with and without superinstructions
+func TestWorkloads(t *testing.T) {
+	for _, workload := range workloads {
+		codes := []int{}
+
+		for _, plain := range []bool{false, true} {
+			root := compile_source(t, workload.source, plain).Compiler
+			machine := vm.New(root.Instructions, root.ConstantPool, abi.NativeABI)
+
+			if err := machine.Run(); err.Exists {
+				t.Fatalf("expected no runtime error in %s but got: %s", workload.name, err)
+			}
+
+			codes = append(codes, machine.ExitCode())
+		}
+
+		if codes[0] != codes[1] {
+			t.Errorf("expected %s to exit with %d but got %d with superinstructions", workload.name, codes[1], codes[0])
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+const coroutine_kind common.ObjectKind = "object:corout"
+const channel_kind common.ObjectKind = "object:channel"
+
+// corout_function is a corout function, calling it spawns a coroutine of its body
+type corout_function struct {
+	fun *function
+}
+
+func (c *corout_function) Kind() common.ObjectKind {
+	return common.FunObjectKind
+}
+
+func (c *corout_function) GetValue() interface{} {
+	return c
+}
+
+// corout functions are created while the program runs so they are never serialized
+func (c *corout_function) Serialize() []byte {
+	return nil
+}
+
+/*
+coroutine is a task that the scheduler runs, only one of them runs at a time and it runs
+until it pauses, waits or ends, then the next ready one runs in the order they got ready.
+The frames of a coroutine are above the floor of the frames and its values are above the
+bottom of the stack, they are kept in the coroutine while it does not run.
+The program itself runs as a coroutine that is created once it is suspended the first time.
+*/
+type coroutine struct {
+	frames []*frame
+	stack  []common.Object
+	done   bool
+	result common.Object
+	// the coroutines that wait for this one to end
+	joiners []*coroutine
+	// the error the coroutine fails with once it runs again
+	failure error
+}
+
+func (c *coroutine) Kind() common.ObjectKind {
+	return coroutine_kind
+}
+
+func (c *coroutine) GetValue() interface{} {
+	return c
+}
+
+func (c *coroutine) Serialize() []byte {
+	return nil
+}
+
+// wakes up a coroutine that waits, the value is the result of what it waits for
+func (vm *VM) wake(c *coroutine, value common.Object) {
+	c.stack = append(c.stack, value)
+	vm.ready = append(vm.ready, c)
+}
+
+func (vm *VM) running() *coroutine {
+	if vm.coroutine == nil {
+		vm.coroutine = &coroutine{}
+	}
+
+	return vm.coroutine
+}
+
+func (vm *VM) spawn(callee *corout_function, base int) error {
+	result := &coroutine{}
+
+	f := vm.enter(callee.fun, base)
+	f.base = 0
+	f.coroutine = result
+	result.frames = []*frame{f}
+
+	if err := vm.allocate(result); err != nil {
+		return err
+	}
+
+	vm.ready = append(vm.ready, result)
+
+	return vm.push(result)
+}
+
+// suspends the running coroutine and runs the next ready one, the running coroutine
+// is expected to be put in the ready queue or to wait for something before
+func (vm *VM) suspend() error {
+	if vm.deferring > 0 {
+		return fmt.Errorf("coroutines cannot be suspended in deferred expressions")
+	}
+
+	if len(vm.ready) == 0 {
+		return fmt.Errorf("deadlock, every coroutine is waiting")
+	}
+
+	current := vm.running()
+	current.frames = append([]*frame{}, vm.frames[vm.floor:]...)
+	current.stack = append([]common.Object{}, vm.stack[vm.bottom:vm.sp]...)
+
+	for _, f := range current.frames {
+		f.base -= vm.bottom
+	}
+
+	for i := vm.bottom; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = vm.bottom
+	vm.frames = vm.frames[:vm.floor]
+
+	return vm.switch_to()
+}
+
+// runs the next ready coroutine where it was suspended
+func (vm *VM) switch_to() error {
+	next := vm.ready[0]
+	vm.ready = vm.ready[1:]
+
+	for _, value := range next.stack {
+		if err := vm.push(value); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range next.frames {
+		f.base += vm.bottom
+	}
+
+	vm.frames = append(vm.frames, next.frames...)
+	vm.coroutine = next
+	next.frames = nil
+	next.stack = nil
+
+	// the error is located at the call the coroutine waits in
+	if next.failure != nil {
+		f := vm.current_frame()
+		return locate(next.failure, f, f.ip-1)
+	}
+
+	return nil
+}
+
+// ends the running coroutine, the frame of the coroutine is already left
+func (vm *VM) finish(c *coroutine, value common.Object) error {
+	c.done = true
+	c.result = value
+
+	for _, joiner := range c.joiners {
+		vm.wake(joiner, value)
+	}
+	c.joiners = nil
+
+	if len(vm.ready) == 0 {
+		return fmt.Errorf("deadlock, every coroutine is waiting")
+	}
+
+	return vm.switch_to()
+}
+
+// lets the ready coroutines run before the running one goes on
+func (vm *VM) pause() error {
+	if err := vm.push(common.NullObject{}); err != nil {
+		return err
+	}
+
+	if len(vm.ready) == 0 {
+		return nil
+	}
+
+	vm.ready = append(vm.ready, vm.running())
+
+	return vm.suspend()
+}
+
+func coroutine_member(c *coroutine, key common.Object) (common.Object, error) {
+	if objects_equal(key, common.StringObject{Value: "join"}) {
+		// waits for the coroutine to end and gives its result
+		return &method{name: "join", call: func(vm *VM, arguments []common.Object) error {
+			if c.done {
+				return vm.push(c.result)
+			}
+
+			if c == vm.coroutine {
+				return fmt.Errorf("a coroutine cannot join itself")
+			}
+
+			c.joiners = append(c.joiners, vm.running())
+
+			return vm.suspend()
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("coroutines have no member %s", common.DisplayObject(key))
+}
+
+type receiver struct {
+	coroutine *coroutine
+	// receivers that call next get an IteratorResult instead of the value
+	next bool
+}
+
+/*
+channel passes values between coroutines in the order they are sent. Sending waits while
+there are more values than the capacity of the channel, so sending to a channel with no
+capacity waits until the value is received. Receiving waits until a value is sent or the
+channel is closed.
+*/
+type channel struct {
+	capacity  int
+	values    []common.Object
+	closed    bool
+	senders   []*coroutine
+	receivers []receiver
+}
+
+func (c *channel) Kind() common.ObjectKind {
+	return channel_kind
+}
+
+func (c *channel) GetValue() interface{} {
+	return c
+}
+
+func (c *channel) Serialize() []byte {
+	return nil
+}
+
+// the result a receiver gets for the value, receivers of closed channels get null
+func (vm *VM) received(value common.Object, next bool, done bool) (common.Object, error) {
+	if next {
+		return vm.iterator_result(value, done)
+	}
+
+	return value, nil
+}
+
+func (vm *VM) send(c *channel, value common.Object) error {
+	if c.closed {
+		return fmt.Errorf("cannot send to a closed channel")
+	}
+
+	if len(c.receivers) > 0 {
+		r := c.receivers[0]
+		c.receivers = c.receivers[1:]
+
+		result, err := vm.received(value, r.next, false)
+		if err != nil {
+			return err
+		}
+		vm.wake(r.coroutine, result)
+
+		return vm.push(common.NullObject{})
+	}
+
+	if err := vm.grow(0, 16); err != nil {
+		return err
+	}
+
+	c.values = append(c.values, value)
+
+	if len(c.values) <= c.capacity {
+		return vm.push(common.NullObject{})
+	}
+
+	// the sender gets null once its value is received
+	c.senders = append(c.senders, vm.running())
+	if err := vm.push(common.NullObject{}); err != nil {
+		return err
+	}
+
+	return vm.suspend()
+}
+
+func (vm *VM) receive(c *channel, next bool) error {
+	if len(c.values) > 0 {
+		value := c.values[0]
+		c.values = c.values[1:]
+
+		if len(c.senders) > 0 {
+			sender := c.senders[0]
+			c.senders = c.senders[1:]
+			vm.ready = append(vm.ready, sender)
+		}
+
+		result, err := vm.received(value, next, false)
+		if err != nil {
+			return err
+		}
+
+		return vm.push(result)
+	}
+
+	if c.closed {
+		result, err := vm.received(common.NullObject{}, next, true)
+		if err != nil {
+			return err
+		}
+
+		return vm.push(result)
+	}
+
+	c.receivers = append(c.receivers, receiver{coroutine: vm.running(), next: next})
+
+	return vm.suspend()
+}
+
+// closing a channel wakes up the coroutines that wait to receive from it, and the ones
+// that wait to send to it fail since their values are never received
+func (vm *VM) close_channel(c *channel) error {
+	if c.closed {
+		return fmt.Errorf("cannot close a closed channel")
+	}
+
+	c.closed = true
+
+	// the values of the senders that wait are the last ones
+	c.values = c.values[:len(c.values)-len(c.senders)]
+
+	for _, sender := range c.senders {
+		sender.failure = fmt.Errorf("cannot send to a closed channel")
+		vm.ready = append(vm.ready, sender)
+	}
+	c.senders = nil
+
+	for _, r := range c.receivers {
+		result, err := vm.received(common.NullObject{}, r.next, true)
+		if err != nil {
+			return err
+		}
+		vm.wake(r.coroutine, result)
+	}
+	c.receivers = nil
+
+	return vm.push(common.NullObject{})
+}
+
+func channel_member(c *channel, key common.Object) (common.Object, error) {
+	name := common.DisplayObject(key)
+
+	switch name {
+	case "send":
+		return &method{name: name, call: func(vm *VM, arguments []common.Object) error {
+			if len(arguments) != 1 {
+				return fmt.Errorf("send expects 1 argument but got %d", len(arguments))
+			}
+
+			return vm.send(c, arguments[0])
+		}}, nil
+	case "receive", "next":
+		return &method{name: name, call: func(vm *VM, arguments []common.Object) error {
+			return vm.receive(c, name == "next")
+		}}, nil
+	case "close":
+		return &method{name: name, call: func(vm *VM, arguments []common.Object) error {
+			return vm.close_channel(c)
+		}}, nil
+	default:
+		return nil, fmt.Errorf("channels have no member %s", name)
+	}
+}
+
+// creates a channel with the capacity given as the argument, channels have no capacity by default
+func (vm *VM) make_channel(arguments []common.Object) error {
+	result := &channel{}
+
+	if len(arguments) > 0 {
+		if !is_numeric(arguments[0]) || to_int(arguments[0]) < 0 {
+			return fmt.Errorf("the capacity of a channel cannot be negative")
+		}
+
+		result.capacity = int(to_int(arguments[0]))
+	}
+
+	if err := vm.allocate(result); err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moonbite-org/moonbite/common"
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// Action tells a paused program how to go on
+type Action int
+
+const (
+	// runs until the next breakpoint
+	Continue Action = iota
+	// pauses at the next line, entering calls
+	StepIn
+	// pauses at the next line of the same call or of a caller
+	StepOver
+	// pauses once the call returns
+	StepOut
+	// ends the program with a cancelled error
+	Stop
+)
+
+type Breakpoint struct {
+	File string
+	Line int
+}
+
+// Pause describes where and why a program is paused
+type Pause struct {
+	// entry, breakpoint or step
+	Reason   string
+	Location errors.Location
+	Stack    []errors.StackFrame
+}
+
+type Variable struct {
+	Name  string
+	Value common.Object
+}
+
+// Debugger pauses a program at breakpoints and steps through it line by line. The program
+// pauses before its first line and whenever it pauses the handler is called, the program
+// goes on once the handler returns.
+type Debugger struct {
+	vm          *VM
+	symbols     []common.ModuleSymbol
+	handler     func(d *Debugger, pause Pause) Action
+	breakpoints map[Breakpoint]bool
+	// the instructions of every program the breakpoints are at
+	resolved map[*program]map[int]bool
+	action   Action
+	started  bool
+	// where the program is paused or was paused last
+	depth    int
+	location errors.Location
+}
+
+// NewDebugger attaches a debugger to a vm, the symbols of the module name its globals
+func NewDebugger(vm *VM, symbols []common.ModuleSymbol, handler func(d *Debugger, pause Pause) Action) *Debugger {
+	result := &Debugger{
+		vm:          vm,
+		symbols:     symbols,
+		handler:     handler,
+		breakpoints: map[Breakpoint]bool{},
+		resolved:    map[*program]map[int]bool{},
+		action:      StepIn,
+	}
+
+	vm.debugger = result
+
+	return result
+}
+
+// SetBreakpoint pauses the program whenever it reaches the line, it reports whether
+// there is any code at the line
+func (d *Debugger) SetBreakpoint(file string, line int) bool {
+	d.breakpoints[Breakpoint{File: file, Line: line}] = true
+	d.resolved = map[*program]map[int]bool{}
+
+	for _, p := range d.programs() {
+		if len(common.CreateLineTable(p.instructions).Offsets(file, line)) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Debugger) ClearBreakpoint(file string, line int) {
+	delete(d.breakpoints, Breakpoint{File: file, Line: line})
+	d.resolved = map[*program]map[int]bool{}
+}
+
+// Breakpoints lists the breakpoints ordered by their files and lines
+func (d *Debugger) Breakpoints() []Breakpoint {
+	result := []Breakpoint{}
+
+	for breakpoint := range d.breakpoints {
+		result = append(result, breakpoint)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+
+		return result[i].Line < result[j].Line
+	})
+
+	return result
+}
+
+// Locals lists the variables visible in a frame of the stack, 0 is the innermost one
+func (d *Debugger) Locals(frame int) []Variable {
+	result := []Variable{}
+	index := len(d.vm.frames) - 1 - frame
+
+	if index < 0 || index >= len(d.vm.frames) {
+		return result
+	}
+
+	f := d.vm.frames[index]
+	location := d.location
+
+	if frame > 0 && f.ip > 0 && f.ip <= len(f.program.instructions) {
+		location = f.program.instructions[f.ip-1].Location
+	}
+
+	// blocks reuse the slots of the ones that are left, the local declared last wins
+	visible := map[int]common.Local{}
+
+	for _, local := range f.program.locals {
+		if strings.HasPrefix(local.Name, "#") || !declared_before(local, location) {
+			continue
+		}
+
+		visible[local.Index] = local
+	}
+
+	indices := []int{}
+	for index := range visible {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	for _, index := range indices {
+		result = append(result, Variable{Name: visible[index].Name, Value: f.get_local(index)})
+	}
+
+	return result
+}
+
+// Globals lists the globals of the module in the order they are defined
+func (d *Debugger) Globals() []Variable {
+	result := []Variable{}
+
+	for _, symbol := range d.symbols {
+		if symbol.Scope == common.GlobalModuleSymbol {
+			result = append(result, Variable{Name: symbol.Name, Value: d.vm.Global(symbol.Index)})
+		}
+	}
+
+	return result
+}
+
+// Lookup resolves a name in a frame of the stack, locals hide the globals
+func (d *Debugger) Lookup(name string, frame int) (common.Object, bool) {
+	for _, variable := range d.Locals(frame) {
+		if variable.Name == name {
+			return variable.Value, true
+		}
+	}
+
+	for _, variable := range d.Globals() {
+		if variable.Name == name {
+			return variable.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// called before every instruction, pauses the program if it should
+func (d *Debugger) before(f *frame, ip int) error {
+	location := f.program.instructions[ip].Location
+
+	// only instructions that are compiled from source are paused at
+	if location.Start.Line == 0 {
+		return nil
+	}
+
+	depth := len(d.vm.frames)
+	new_line := location.File != d.location.File || location.Start.Line != d.location.Start.Line
+	reason := ""
+
+	switch {
+	case !d.started:
+		reason = "entry"
+	case d.at_breakpoint(f.program, ip):
+		reason = "breakpoint"
+	case d.action == StepIn && (new_line || depth != d.depth):
+		reason = "step"
+	case d.action == StepOver && (depth < d.depth || (depth == d.depth && new_line)):
+		reason = "step"
+	case d.action == StepOut && depth < d.depth:
+		reason = "step"
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	d.started = true
+	d.depth = depth
+	d.location = location
+
+	d.action = d.handler(d, Pause{Reason: reason, Location: location, Stack: d.vm.stack_frames(0, location)})
+
+	if d.action == Stop {
+		return limit_fault(errors.CancelledError, "the program is stopped by the debugger")
+	}
+
+	return nil
+}
+
+func (d *Debugger) at_breakpoint(p *program, ip int) bool {
+	if len(d.breakpoints) == 0 {
+		return false
+	}
+
+	indices, ok := d.resolved[p]
+
+	if !ok {
+		indices = map[int]bool{}
+		lines := common.CreateLineTable(p.instructions)
+
+		for breakpoint := range d.breakpoints {
+			for _, offset := range lines.Offsets(breakpoint.File, breakpoint.Line) {
+				indices[p.indices[offset]] = true
+			}
+		}
+
+		d.resolved[p] = indices
+	}
+
+	return indices[ip]
+}
+
+// the code of the module and of its functions
+func (d *Debugger) programs() []*program {
+	result := []*program{d.vm.frames[0].program}
+
+	for _, constant := range d.vm.constants {
+		if fun, ok := constant.(*function); ok {
+			result = append(result, fun.program)
+		}
+	}
+
+	return result
+}
+
+func declared_before(local common.Local, location errors.Location) bool {
+	if local.Line == 0 {
+		return true
+	}
+
+	if local.Line != location.Start.Line {
+		return local.Line < location.Start.Line
+	}
+
+	return local.Column <= location.Start.Column
+}
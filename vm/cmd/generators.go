@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+const generator_kind common.ObjectKind = "object:generator"
+
+// generator_function is a gen function, calling it creates a generator of its body
+// instead of running it
+type generator_function struct {
+	fun *function
+}
+
+func (g *generator_function) Kind() common.ObjectKind {
+	return common.FunObjectKind
+}
+
+func (g *generator_function) GetValue() interface{} {
+	return g
+}
+
+// gen functions are created while the program runs so they are never serialized
+func (g *generator_function) Serialize() []byte {
+	return nil
+}
+
+// generator keeps the frame of a gen function between the calls of its next method,
+// the frame is suspended at every yield along with the values it has on the stack
+type generator struct {
+	frame   *frame
+	stack   []common.Object
+	running bool
+	done    bool
+}
+
+func (g *generator) Kind() common.ObjectKind {
+	return generator_kind
+}
+
+func (g *generator) GetValue() interface{} {
+	return g
+}
+
+func (g *generator) Serialize() []byte {
+	return nil
+}
+
+func generator_member(g *generator, key common.Object) (common.Object, error) {
+	if objects_equal(key, common.StringObject{Value: "next"}) {
+		return &method{name: "next", call: func(vm *VM, arguments []common.Object) error {
+			return vm.resume(g)
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("generators have no member %s", common.DisplayObject(key))
+}
+
+// the result of next, an IteratorResult of the value
+func (vm *VM) iterator_result(value common.Object, done bool) (common.Object, error) {
+	result := common.InstanceObject{Value: []struct {
+		Key   common.Object
+		Value common.Object
+	}{
+		{Key: common.StringObject{Value: "value"}, Value: value},
+		{Key: common.StringObject{Value: "is_done"}, Value: common.BoolObject{Value: done}},
+	}}
+
+	if err := vm.allocate(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// runs the generator until it yields or returns, both push the result of next for the caller
+func (vm *VM) resume(g *generator) error {
+	if g.running {
+		return fmt.Errorf("cannot resume a generator that is running")
+	}
+
+	if g.done {
+		result, err := vm.iterator_result(common.NullObject{}, true)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	}
+
+	f := g.frame
+	f.base = vm.sp
+
+	for _, value := range g.stack {
+		if err := vm.push(value); err != nil {
+			return err
+		}
+	}
+
+	g.stack = nil
+	g.running = true
+
+	return vm.push_frame(f)
+}
+
+// suspends the generator of the frame and gives the value to the caller of next
+func (vm *VM) yield(f *frame, value common.Object) error {
+	g := f.generator
+
+	if g == nil {
+		return fmt.Errorf("yield is only allowed in generators")
+	}
+
+	g.stack = append([]common.Object{}, vm.stack[f.base:vm.sp]...)
+
+	for i := f.base; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = f.base
+	vm.pop_frame()
+	g.running = false
+
+	result, err := vm.iterator_result(value, false)
+	if err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
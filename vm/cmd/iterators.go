@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+const iterator_kind common.ObjectKind = "object:iterator"
+
+// iterator goes over the entries of a list, a string or a map, the keys of lists and
+// strings are the indices of their values
+type iterator struct {
+	keys   []common.Object
+	values []common.Object
+	index  int
+}
+
+func (i *iterator) Kind() common.ObjectKind {
+	return iterator_kind
+}
+
+func (i *iterator) GetValue() interface{} {
+	return i
+}
+
+// iterators are created while the program runs so they are never serialized
+func (i *iterator) Serialize() []byte {
+	return nil
+}
+
+// turns lists, strings and maps into iterators for for-of loops, the other values are
+// expected to have a next method already
+func (vm *VM) iterate(arguments []common.Object) error {
+	if len(arguments) != 1 {
+		return fmt.Errorf("expected 1 value to iterate but got %d", len(arguments))
+	}
+
+	var result common.Object
+
+	switch value := normalize(arguments[0]).(type) {
+	case common.ListObject:
+		result = &iterator{values: value.Value}
+	case common.MapObject:
+		entries := &iterator{}
+
+		for _, entry := range value.Value {
+			entries.keys = append(entries.keys, entry.Key)
+			entries.values = append(entries.values, entry.Value)
+		}
+
+		result = entries
+	default:
+		result = arguments[0]
+	}
+
+	return vm.push(result)
+}
+
+func iterator_member(i *iterator, key common.Object) (common.Object, error) {
+	if !objects_equal(key, common.StringObject{Value: "next"}) {
+		return nil, fmt.Errorf("iterators have no member %s", common.DisplayObject(key))
+	}
+
+	return &method{name: "next", call: func(vm *VM, arguments []common.Object) error {
+		if i.index >= len(i.values) {
+			result, err := vm.iterator_result(common.NullObject{}, true)
+			if err != nil {
+				return err
+			}
+
+			return vm.push(result)
+		}
+
+		var key common.Object = common.Int32Object{Value: int32(i.index)}
+		if i.keys != nil {
+			key = i.keys[i.index]
+		}
+
+		// the results of iterators have the key of the value as well
+		result := common.InstanceObject{Value: []struct {
+			Key   common.Object
+			Value common.Object
+		}{
+			{Key: common.StringObject{Value: "value"}, Value: i.values[i.index]},
+			{Key: common.StringObject{Value: "is_done"}, Value: common.BoolObject{Value: false}},
+			{Key: common.StringObject{Value: "key"}, Value: key},
+		}}
+		i.index++
+
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+
+		return vm.push(result)
+	}}, nil
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+// the number of instructions between two checks of the context
+const cancel_interval = 1024
+
+// Limits guard hosts against programs that run away. They apply to every call of
+// Run and Call on its own, zero values mean there is no limit.
+type Limits struct {
+	// the number of instructions that can be executed
+	Instructions int
+	// the depth of calls, MaxFrames is used if it is zero
+	Frames int
+	// the number of lists, maps and strings that can be allocated
+	Objects int
+	// the estimated number of bytes that can be allocated
+	Memory int
+}
+
+func (vm *VM) SetLimits(limits Limits) {
+	vm.limits = limits
+}
+
+// a failure of a program along with the kind of error it is and where it happened
+type fault struct {
+	kind     errors.ErrorKind
+	reason   string
+	location errors.Location
+}
+
+func (f *fault) Error() string {
+	return f.reason
+}
+
+func limit_fault(kind errors.ErrorKind, format string, values ...interface{}) *fault {
+	return &fault{kind: kind, reason: fmt.Sprintf(format, values...)}
+}
+
+// locates an error at an instruction unless it is already located deeper in the call stack
+func locate(err error, f *frame, ip int) error {
+	result, ok := err.(*fault)
+
+	if !ok {
+		result = &fault{kind: errors.RuntimeError, reason: err.Error()}
+	}
+
+	if result.location.Start.Line == 0 && ip < len(f.program.instructions) {
+		result.location = f.program.instructions[ip].Location
+	}
+
+	return result
+}
+
+func to_error(err error) errors.Error {
+	if result, ok := err.(*fault); ok {
+		return errors.CreateRuntimeErrorAt(result.kind, result.reason, result.location)
+	}
+
+	return errors.CreateRuntimeError(err.Error())
+}
+
+// creates the error of a fault along with the calls above depth, which are still on the
+// frames when the fault reaches the host
+func (vm *VM) trace(err error, depth int) errors.Error {
+	result := to_error(err)
+	result.Stack = vm.stack_frames(depth, result.Location)
+
+	return result
+}
+
+// the calls above depth starting from the innermost one, which is at location
+func (vm *VM) stack_frames(depth int, location errors.Location) []errors.StackFrame {
+	result := []errors.StackFrame{}
+
+	for i := len(vm.frames) - 1; i >= depth; i-- {
+		f := vm.frames[i]
+		name := f.program.name
+
+		// functions of modules that are read from bytecode have no names
+		if name == "" {
+			name = "<unknown>"
+		}
+
+		if f.parent != nil {
+			name += " (deferred)"
+		}
+
+		frame := errors.StackFrame{Function: name}
+
+		// the others are at the call they made
+		if i == len(vm.frames)-1 {
+			frame.Location = location
+		} else if f.ip > 0 && f.ip <= len(f.program.instructions) {
+			frame.Location = f.program.instructions[f.ip-1].Location
+		}
+
+		result = append(result, frame)
+	}
+
+	return result
+}
+
+// starts counting the limits of a run or a call from the beginning
+func (vm *VM) begin(ctx context.Context) {
+	vm.context = ctx
+	vm.executed = 0
+	vm.objects = 0
+	vm.memory = 0
+}
+
+// checks the limits before an instruction is executed
+func (vm *VM) check() error {
+	vm.executed++
+
+	if vm.limits.Instructions > 0 && vm.executed > vm.limits.Instructions {
+		return limit_fault(errors.InstructionLimitError, "the limit of %d instructions is exceeded", vm.limits.Instructions)
+	}
+
+	if vm.executed%cancel_interval == 0 {
+		return vm.cancelled()
+	}
+
+	return nil
+}
+
+func (vm *VM) cancelled() error {
+	if vm.context.Err() != nil {
+		return limit_fault(errors.CancelledError, "the program is cancelled: %s", vm.context.Err())
+	}
+
+	return nil
+}
+
+func (vm *VM) max_frames() int {
+	if vm.limits.Frames > 0 {
+		return vm.limits.Frames
+	}
+
+	return MaxFrames
+}
+
+// counts an object that is allocated, values that are not allocated are ignored
+func (vm *VM) allocate(object common.Object) error {
+	size, ok := size_of(object)
+	if !ok {
+		return nil
+	}
+
+	return vm.grow(1, size)
+}
+
+func (vm *VM) grow(objects int, size int) error {
+	vm.objects += objects
+	vm.memory += size
+
+	if vm.limits.Objects > 0 && vm.objects > vm.limits.Objects {
+		return limit_fault(errors.MemoryLimitError, "the limit of %d allocated objects is exceeded", vm.limits.Objects)
+	}
+
+	if vm.limits.Memory > 0 && vm.memory > vm.limits.Memory {
+		return limit_fault(errors.MemoryLimitError, "the limit of %d allocated bytes is exceeded", vm.limits.Memory)
+	}
+
+	return nil
+}
+
+// the estimated size of an object without the values it holds
+func size_of(object common.Object) (int, bool) {
+	switch object := object.(type) {
+	case common.StringObject:
+		return len(object.Value), true
+	case common.ListObject:
+		return 16 * len(object.Value), true
+	case common.MapObject:
+		return 32 * len(object.Value), true
+	case common.InstanceObject:
+		return 32 * len(object.Value), true
+	case *function:
+		// only closures are allocated, other functions are constants
+		return 16 * len(object.free), len(object.free) > 0
+	default:
+		return 0, false
+	}
+}
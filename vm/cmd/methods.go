@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+// binds a function to a type, the instances of the type have it as a method
+func (vm *VM) bind_method(type_name, name common.Object, fun common.Object) error {
+	if _, ok := fun.(*function); !ok {
+		return fmt.Errorf("only functions can be methods")
+	}
+
+	typ := common.DisplayObject(type_name)
+
+	if vm.methods[typ] == nil {
+		vm.methods[typ] = map[string]common.Object{}
+	}
+
+	vm.methods[typ][common.DisplayObject(name)] = fun
+
+	return nil
+}
+
+// indexes a value, instances have the methods of their type after their fields
+func (vm *VM) index(host, key common.Object) (common.Object, error) {
+	instance, ok := host.(common.InstanceObject)
+	if !ok || instance.Type == "" {
+		return index(host, key)
+	}
+
+	for _, entry := range instance.Value {
+		if objects_equal(entry.Key, key) {
+			return entry.Value, nil
+		}
+	}
+
+	name, ok := key.(common.StringObject)
+	if !ok {
+		return common.NullObject{}, nil
+	}
+
+	fun, ok := vm.methods[instance.Type][name.Value]
+	if !ok {
+		return common.NullObject{}, nil
+	}
+
+	// the instance is the first argument of the method, it is this in its body
+	return &method{name: name.Value, call: func(vm *VM, arguments []common.Object) error {
+		if err := vm.push(instance); err != nil {
+			return err
+		}
+
+		for _, argument := range arguments {
+			if err := vm.push(argument); err != nil {
+				return err
+			}
+		}
+
+		if err := vm.push(fun); err != nil {
+			return err
+		}
+
+		return vm.call(len(arguments) + 1)
+	}}, nil
+}
@@ -0,0 +1,425 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+func is_numeric(object common.Object) bool {
+	switch object.(type) {
+	case common.Uint8Object, common.Uint16Object, common.Uint32Object, common.Uint64Object,
+		common.Int8Object, common.Int16Object, common.Int32Object, common.Int64Object,
+		common.Float32Object, common.Float64Object, common.ByteObject:
+		return true
+	default:
+		return false
+	}
+}
+
+func is_float(object common.Object) bool {
+	switch object.(type) {
+	case common.Float32Object, common.Float64Object:
+		return true
+	default:
+		return false
+	}
+}
+
+func is_unsigned(object common.Object) bool {
+	switch object.(type) {
+	case common.Uint8Object, common.Uint16Object, common.Uint32Object, common.Uint64Object, common.ByteObject:
+		return true
+	default:
+		return false
+	}
+}
+
+func to_int(object common.Object) int64 {
+	switch object := object.(type) {
+	case common.Uint8Object:
+		return int64(object.Value)
+	case common.Uint16Object:
+		return int64(object.Value)
+	case common.Uint32Object:
+		return int64(object.Value)
+	case common.Uint64Object:
+		return int64(object.Value)
+	case common.Int8Object:
+		return int64(object.Value)
+	case common.Int16Object:
+		return int64(object.Value)
+	case common.Int32Object:
+		return int64(object.Value)
+	case common.Int64Object:
+		return object.Value
+	case common.Float32Object:
+		return int64(object.Value)
+	case common.Float64Object:
+		return int64(object.Value)
+	case common.ByteObject:
+		return int64(object.Value)
+	default:
+		return 0
+	}
+}
+
+func to_float(object common.Object) float64 {
+	switch object := object.(type) {
+	case common.Float32Object:
+		return float64(object.Value)
+	case common.Float64Object:
+		return object.Value
+	default:
+		return float64(to_int(object))
+	}
+}
+
+// creates a number of the given kind, int value is used for integer kinds
+func create_number(kind common.ObjectKind, int_value int64, float_value float64) common.Object {
+	switch kind {
+	case common.Uint8ObjectKind:
+		return common.Uint8Object{Value: uint8(int_value)}
+	case common.Uint16ObjectKind:
+		return common.Uint16Object{Value: uint16(int_value)}
+	case common.Uint32ObjectKind:
+		return common.Uint32Object{Value: uint32(int_value)}
+	case common.Uint64ObjectKind:
+		return common.Uint64Object{Value: uint64(int_value)}
+	case common.Int8ObjectKind:
+		return common.Int8Object{Value: int8(int_value)}
+	case common.Int16ObjectKind:
+		return common.Int16Object{Value: int16(int_value)}
+	case common.Int64ObjectKind:
+		return common.Int64Object{Value: int_value}
+	case common.Float32ObjectKind:
+		return common.Float32Object{Value: float32(float_value)}
+	case common.Float64ObjectKind:
+		return common.Float64Object{Value: float_value}
+	case common.ByteObjectKind:
+		return common.ByteObject{Value: byte(int_value)}
+	default:
+		return common.Int32Object{Value: int32(int_value)}
+	}
+}
+
+// casts a value to the type of target, numbers are converted to each other
+func cast(value common.Object, target common.Object) (common.Object, error) {
+	switch {
+	case is_numeric(target) && is_numeric(value):
+		return create_number(target.Kind(), to_int(value), to_float(value)), nil
+	case target.Kind() == value.Kind():
+		return value, nil
+	default:
+		return nil, fmt.Errorf("cannot cast a value of kind %s to %s", value.Kind(), target.Kind())
+	}
+}
+
+// strings may either be string constants or lists of runes, they are
+// compared and concatenated as lists of runes
+func normalize(object common.Object) common.Object {
+	if str, ok := object.(common.StringObject); ok {
+		result := common.ListObject{Value: []common.Object{}, Text: true}
+
+		for _, r := range str.Value {
+			result.Value = append(result.Value, common.Int32Object{Value: r})
+		}
+
+		return result
+	}
+
+	return object
+}
+
+func is_truthy(object common.Object) bool {
+	switch object := object.(type) {
+	case common.BoolObject:
+		return object.Value
+	case common.NullObject:
+		return false
+	default:
+		if is_numeric(object) {
+			return to_float(object) != 0
+		}
+
+		return true
+	}
+}
+
+func objects_equal(left, right common.Object) bool {
+	left = normalize(left)
+	right = normalize(right)
+
+	if is_numeric(left) && is_numeric(right) {
+		if is_float(left) || is_float(right) {
+			return to_float(left) == to_float(right)
+		}
+
+		return to_int(left) == to_int(right)
+	}
+
+	if left.Kind() != right.Kind() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case common.ListObject:
+		right := right.(common.ListObject)
+
+		if len(left.Value) != len(right.Value) {
+			return false
+		}
+
+		for i := range left.Value {
+			if !objects_equal(left.Value[i], right.Value[i]) {
+				return false
+			}
+		}
+
+		return true
+	case common.MapObject:
+		return entries_equal(left.Value, right.(common.MapObject).Value)
+	case common.InstanceObject:
+		return entries_equal(left.Value, right.(common.InstanceObject).Value)
+	case common.NullObject:
+		return true
+	case *function:
+		return left == right.(*function)
+	case common.BuiltinFunObject:
+		return left.Name == right.(common.BuiltinFunObject).Name
+	default:
+		return left.GetValue() == right.GetValue()
+	}
+}
+
+func entries_equal(left, right []struct {
+	Key   common.Object
+	Value common.Object
+}) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	for i := range left {
+		if !objects_equal(left[i].Key, right[i].Key) || !objects_equal(left[i].Value, right[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func arithmetic(op common.Op, left, right common.Object) (common.Object, error) {
+	if op == common.OpAdd {
+		left_list, left_ok := normalize(left).(common.ListObject)
+		right_list, right_ok := normalize(right).(common.ListObject)
+
+		if left_ok && right_ok {
+			result := common.ListObject{Value: []common.Object{}, Text: left_list.Text && right_list.Text}
+			result.Value = append(result.Value, left_list.Value...)
+			result.Value = append(result.Value, right_list.Value...)
+			return result, nil
+		}
+	}
+
+	if !is_numeric(left) || !is_numeric(right) {
+		return nil, fmt.Errorf("unsupported operand kinds for %s: %s and %s", op, left.Kind(), right.Kind())
+	}
+
+	// the result has the kind of the left hand side
+	kind := left.Kind()
+
+	if is_float(left) || is_float(right) {
+		a, b := to_float(left), to_float(right)
+
+		if !is_float(left) {
+			kind = right.Kind()
+		}
+
+		switch op {
+		case common.OpAdd:
+			return create_number(kind, 0, a+b), nil
+		case common.OpSub:
+			return create_number(kind, 0, a-b), nil
+		case common.OpMul:
+			return create_number(kind, 0, a*b), nil
+		case common.OpDiv:
+			if b == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return create_number(kind, 0, a/b), nil
+		default:
+			return nil, fmt.Errorf("unsupported operand kinds for %s: %s and %s", op, left.Kind(), right.Kind())
+		}
+	}
+
+	a, b := to_int(left), to_int(right)
+
+	switch op {
+	case common.OpAdd:
+		return create_number(kind, a+b, 0), nil
+	case common.OpSub:
+		return create_number(kind, a-b, 0), nil
+	case common.OpMul:
+		return create_number(kind, a*b, 0), nil
+	case common.OpDiv, common.OpMod:
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		if is_unsigned(left) {
+			if op == common.OpDiv {
+				return create_number(kind, int64(uint64(a)/uint64(b)), 0), nil
+			}
+			return create_number(kind, int64(uint64(a)%uint64(b)), 0), nil
+		}
+
+		if op == common.OpDiv {
+			return create_number(kind, a/b, 0), nil
+		}
+		return create_number(kind, a%b, 0), nil
+	default:
+		return nil, fmt.Errorf("unknown arithmetic operation %s", op)
+	}
+}
+
+func compare(op common.Op, left, right common.Object) (bool, error) {
+	switch op {
+	case common.OpEqual:
+		return objects_equal(left, right), nil
+	case common.OpNotEqual:
+		return !objects_equal(left, right), nil
+	}
+
+	if !is_numeric(left) || !is_numeric(right) {
+		return false, fmt.Errorf("unsupported operand kinds for %s: %s and %s", op, left.Kind(), right.Kind())
+	}
+
+	if is_float(left) || is_float(right) {
+		if op == common.OpGreaterThan {
+			return to_float(left) > to_float(right), nil
+		}
+		return to_float(left) >= to_float(right), nil
+	}
+
+	if op == common.OpGreaterThan {
+		return to_int(left) > to_int(right), nil
+	}
+	return to_int(left) >= to_int(right), nil
+}
+
+func index(host, key common.Object) (common.Object, error) {
+	switch host := normalize(host).(type) {
+	case common.ListObject:
+		if !is_numeric(key) {
+			return nil, fmt.Errorf("cannot index a list with %s", key.Kind())
+		}
+
+		i := to_int(key)
+
+		if i < 0 || i >= int64(len(host.Value)) {
+			return nil, fmt.Errorf("index %d out of range with length %d", i, len(host.Value))
+		}
+
+		return host.Value[i], nil
+	case common.MapObject:
+		return find_entry(host.Value, key), nil
+	case common.InstanceObject:
+		return find_entry(host.Value, key), nil
+	case *generator:
+		return generator_member(host, key)
+	case *coroutine:
+		return coroutine_member(host, key)
+	case *channel:
+		return channel_member(host, key)
+	case *iterator:
+		return iterator_member(host, key)
+	default:
+		return nil, fmt.Errorf("cannot index a value of kind %s", host.Kind())
+	}
+}
+
+func find_entry(entries []struct {
+	Key   common.Object
+	Value common.Object
+}, key common.Object) common.Object {
+	for _, entry := range entries {
+		if objects_equal(entry.Key, key) {
+			return entry.Value
+		}
+	}
+
+	return common.NullObject{}
+}
+
+// sets the value at the end of the path, returns the updated host
+func set_item(host common.Object, path []common.Object, value common.Object) (common.Object, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	key := path[0]
+
+	switch host := normalize(host).(type) {
+	case common.ListObject:
+		if !is_numeric(key) {
+			return nil, fmt.Errorf("cannot index a list with %s", key.Kind())
+		}
+
+		i := to_int(key)
+
+		if i == int64(len(host.Value)) && len(path) == 1 {
+			host.Value = append(host.Value, value)
+			return host, nil
+		}
+
+		if i < 0 || i >= int64(len(host.Value)) {
+			return nil, fmt.Errorf("index %d out of range with length %d", i, len(host.Value))
+		}
+
+		updated, err := set_item(host.Value[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+
+		host.Value[i] = updated
+		return host, nil
+	case common.MapObject:
+		entries, err := set_entry(host.Value, path, value)
+		return common.MapObject{Value: entries}, err
+	case common.InstanceObject:
+		entries, err := set_entry(host.Value, path, value)
+		return common.InstanceObject{Value: entries, Type: host.Type}, err
+	default:
+		return nil, fmt.Errorf("cannot set an item on a value of kind %s", host.Kind())
+	}
+}
+
+func set_entry(entries []struct {
+	Key   common.Object
+	Value common.Object
+}, path []common.Object, value common.Object) ([]struct {
+	Key   common.Object
+	Value common.Object
+}, error) {
+	for i, entry := range entries {
+		if objects_equal(entry.Key, path[0]) {
+			updated, err := set_item(entry.Value, path[1:], value)
+			if err != nil {
+				return entries, err
+			}
+
+			entries[i].Value = updated
+			return entries, nil
+		}
+	}
+
+	if len(path) != 1 {
+		return entries, fmt.Errorf("cannot set an item on a missing key")
+	}
+
+	return append(entries, struct {
+		Key   common.Object
+		Value common.Object
+	}{Key: path[0], Value: value}), nil
+}
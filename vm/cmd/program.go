@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+// jumps are encoded as byte distances, programs keep the byte offset of every
+// instruction so that they can be mapped back to instruction indices
+type program struct {
+	// the name of the function in stack traces and the names of its locals
+	name         string
+	locals       []common.Local
+	instructions common.InstructionSet
+	offsets      []int
+	indices      map[int]int
+	size         int
+}
+
+func new_program(name string, instructions common.InstructionSet) *program {
+	result := &program{
+		name:         name,
+		instructions: instructions,
+		offsets:      make([]int, len(instructions)),
+		indices:      map[int]int{},
+	}
+
+	for i, instruction := range instructions {
+		result.offsets[i] = result.size
+		result.indices[result.size] = i
+		result.size += instruction.GetSize()
+	}
+
+	result.indices[result.size] = len(instructions)
+
+	return result
+}
+
+// forward jumps are relative to the end of the jump instruction,
+// backward jumps are relative to its start
+func (p *program) jump_target(ip int, distance int, backward bool) (int, error) {
+	var offset int
+
+	if backward {
+		offset = p.offsets[ip] - distance
+	} else {
+		offset = p.offsets[ip] + p.instructions[ip].GetSize() + distance
+	}
+
+	index, ok := p.indices[offset]
+
+	if !ok {
+		return 0, fmt.Errorf("invalid jump target %d at instruction %d", offset, ip)
+	}
+
+	return index, nil
+}
+
+type function struct {
+	common.FunctionObject
+	program *program
+	// the variables a closure captures, functions that capture nothing have none
+	free []*cell
+}
+
+func new_function(object common.FunctionObject) *function {
+	result := &function{
+		FunctionObject: object,
+		program:        new_program(object.Name, object.Value),
+	}
+	result.program.locals = object.Locals
+
+	return result
+}
+
+// closures of the same function share its program and differ in the variables they capture
+func (f *function) close(free []*cell) *function {
+	return &function{
+		FunctionObject: f.FunctionObject,
+		program:        f.program,
+		free:           free,
+	}
+}
+
+// method is a member of a value of the vm, such as the next method of a generator, calling
+// it may suspend the running frames so the vm calls it itself instead of through a builtin
+type method struct {
+	name string
+	call func(vm *VM, arguments []common.Object) error
+}
+
+func (m *method) Kind() common.ObjectKind {
+	return common.FunObjectKind
+}
+
+func (m *method) GetValue() interface{} {
+	return m
+}
+
+// methods are created while the program runs so they are never serialized
+func (m *method) Serialize() []byte {
+	return nil
+}
+
+const cell_kind common.ObjectKind = "object:cell"
+
+// cell holds a local of a frame that closures capture, the local lives in the cell from
+// the first time it is captured and every declaration of the local creates a new cell, so
+// closures made in a loop have the variables of the iteration that made them
+type cell struct {
+	value common.Object
+}
+
+func (c *cell) Kind() common.ObjectKind {
+	return cell_kind
+}
+
+func (c *cell) GetValue() interface{} {
+	return c.get().GetValue()
+}
+
+// cells are created while the program runs so they are never serialized
+func (c *cell) Serialize() []byte {
+	return nil
+}
+
+func (c *cell) get() common.Object {
+	if c.value == nil {
+		return common.NullObject{}
+	}
+
+	return c.value
+}
+
+func (c *cell) set(value common.Object) {
+	c.value = value
+}
+
+type deferred struct {
+	start int
+	end   int
+}
+
+type frame struct {
+	program *program
+	ip      int
+	base    int
+	locals  []common.Object
+	free    []*cell
+	defers  []deferred
+	// deferred blocks run on a frame of their own which shares
+	// the locals of its parent and ends at the end of the block
+	parent *frame
+	until  int
+	// the generator the frame runs the body of, yields suspend the frame
+	generator *generator
+	// the coroutine the frame runs the body of, the coroutine ends when the frame returns
+	coroutine *coroutine
+}
+
+func (f *frame) owner() *frame {
+	if f.parent != nil {
+		return f.parent
+	}
+
+	return f
+}
+
+func (f *frame) get_local(index int) common.Object {
+	owner := f.owner()
+
+	if index >= len(owner.locals) || owner.locals[index] == nil {
+		return common.NullObject{}
+	}
+
+	if captured, ok := owner.locals[index].(*cell); ok {
+		return captured.get()
+	}
+
+	return owner.locals[index]
+}
+
+// assigns to a local, locals that closures captured are assigned in their cells
+func (f *frame) set_local(index int, value common.Object) {
+	owner := f.owner()
+
+	for index >= len(owner.locals) {
+		owner.locals = append(owner.locals, common.NullObject{})
+	}
+
+	if captured, ok := owner.locals[index].(*cell); ok {
+		captured.set(value)
+		return
+	}
+
+	owner.locals[index] = value
+}
+
+// declares a local, the closures that captured the local before keep their cell
+func (f *frame) declare_local(index int, value common.Object) {
+	owner := f.owner()
+
+	for index >= len(owner.locals) {
+		owner.locals = append(owner.locals, common.NullObject{})
+	}
+
+	owner.locals[index] = value
+}
+
+// the cell of a local that a closure captures, the local is moved into a cell the first time
+func (f *frame) capture(index int) *cell {
+	owner := f.owner()
+
+	if index < len(owner.locals) {
+		if captured, ok := owner.locals[index].(*cell); ok {
+			return captured
+		}
+	}
+
+	result := &cell{value: f.get_local(index)}
+	f.declare_local(index, result)
+
+	return result
+}
+
+func (f *frame) get_free(index int) (*cell, error) {
+	owner := f.owner()
+
+	if index >= len(owner.free) {
+		return nil, fmt.Errorf("unknown free variable %d", index)
+	}
+
+	return owner.free[index], nil
+}
+
+func (f *frame) is_done() bool {
+	if f.until >= 0 {
+		return f.ip >= f.until
+	}
+
+	return f.ip >= len(f.program.instructions)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/moonbite-org/moonbite/common"
+)
+
+const repl_help = `commands:
+  break [file:]line   pause whenever the line is reached (b)
+  delete [file:]line  remove a breakpoint (d)
+  breakpoints         list the breakpoints
+  continue            run until the next breakpoint (c)
+  step                pause at the next line, entering calls (s)
+  next                pause at the next line of this call (n)
+  out                 pause once this call returns (o)
+  print name          print a local or a global of the selected frame (p)
+  locals              print the locals of the selected frame (l)
+  globals             print the globals (g)
+  backtrace           print the calls and select the innermost one (bt)
+  frame n             select the call at position n of the backtrace (f)
+  quit                stop the program (q)
+`
+
+// REPL creates a handler for a debugger that reads commands line by line from in and
+// writes to out, the program is stopped once the input ends
+func REPL(in io.Reader, out io.Writer) func(d *Debugger, pause Pause) Action {
+	scanner := bufio.NewScanner(in)
+
+	return func(d *Debugger, pause Pause) Action {
+		selected := 0
+
+		fmt.Fprintf(out, "paused %s (%s)\n", pause.Stack[0], pause.Reason)
+
+		for {
+			fmt.Fprint(out, "(debug) ")
+
+			if !scanner.Scan() {
+				fmt.Fprintln(out)
+				return Stop
+			}
+
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+
+			command, argument := fields[0], ""
+			if len(fields) > 1 {
+				argument = fields[1]
+			}
+
+			switch command {
+			case "continue", "c":
+				return Continue
+			case "step", "s":
+				return StepIn
+			case "next", "n":
+				return StepOver
+			case "out", "o":
+				return StepOut
+			case "quit", "q":
+				return Stop
+			case "break", "b", "delete", "d":
+				file, line, err := parse_line(argument, pause.Location.File)
+				if err != nil {
+					fmt.Fprintln(out, err)
+					continue
+				}
+
+				if command == "delete" || command == "d" {
+					d.ClearBreakpoint(file, line)
+				} else if !d.SetBreakpoint(file, line) {
+					fmt.Fprintf(out, "there is no code at %s:%d, the breakpoint is kept\n", file, line)
+				}
+			case "breakpoints":
+				for _, breakpoint := range d.Breakpoints() {
+					fmt.Fprintf(out, "%s:%d\n", breakpoint.File, breakpoint.Line)
+				}
+			case "print", "p":
+				value, ok := d.Lookup(argument, selected)
+				if !ok {
+					fmt.Fprintf(out, "'%s' is not defined\n", argument)
+					continue
+				}
+
+				fmt.Fprintf(out, "%s = %s\n", argument, common.FormatObject(value))
+			case "locals", "l":
+				print_variables(out, d.Locals(selected))
+			case "globals", "g":
+				print_variables(out, d.Globals())
+			case "backtrace", "bt":
+				selected = 0
+
+				for i, frame := range pause.Stack {
+					fmt.Fprintf(out, "#%d %s\n", i, frame)
+				}
+			case "frame", "f":
+				index, err := strconv.Atoi(argument)
+				if err != nil || index < 0 || index >= len(pause.Stack) {
+					fmt.Fprintf(out, "expected a frame between 0 and %d\n", len(pause.Stack)-1)
+					continue
+				}
+
+				selected = index
+				fmt.Fprintf(out, "#%d %s\n", index, pause.Stack[index])
+			case "help", "h":
+				fmt.Fprint(out, repl_help)
+			default:
+				fmt.Fprintf(out, "unknown command '%s', type help to list the commands\n", command)
+			}
+		}
+	}
+}
+
+// parses a line of a file, the file of the paused location is used if there is none
+func parse_line(argument string, file string) (string, int, error) {
+	if separator := strings.LastIndex(argument, ":"); separator >= 0 {
+		file = argument[:separator]
+		argument = argument[separator+1:]
+	}
+
+	line, err := strconv.Atoi(argument)
+	if err != nil || line <= 0 {
+		return "", 0, fmt.Errorf("expected a line such as main.mb:12 but got '%s'", argument)
+	}
+
+	return file, line, nil
+}
+
+func print_variables(out io.Writer, variables []Variable) {
+	for _, variable := range variables {
+		fmt.Fprintf(out, "%s = %s\n", variable.Name, common.FormatObject(variable.Value))
+	}
+}
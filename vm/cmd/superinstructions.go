@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"github.com/moonbite-org/moonbite/common"
+)
+
+// the comparisons the compare and jump instructions are fused from, they jump unless
+// the comparison holds
+var fused_comparisons = map[common.Op]common.Op{
+	common.OpJumpIfNotGreaterThan:        common.OpGreaterThan,
+	common.OpJumpIfNotGreaterThanOrEqual: common.OpGreaterThanOrEqual,
+	common.OpJumpIfNotEqual:              common.OpEqual,
+	common.OpJumpIfEqual:                 common.OpNotEqual,
+}
+
+// adds a constant to a local, ints are added in place and everything else goes through
+// the same arithmetic as an addition
+func (vm *VM) increment_local(f *frame, local int, value common.Object) error {
+	current := f.get_local(local)
+
+	if left, ok := current.(common.Int32Object); ok {
+		if right, ok := value.(common.Int32Object); ok {
+			f.set_local(local, common.Int32Object{Value: left.Value + right.Value})
+			return nil
+		}
+	}
+
+	result, err := arithmetic(common.OpAdd, current, value)
+	if err != nil {
+		return err
+	}
+
+	if result.Kind() == common.ListObjectKind {
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+	}
+
+	f.set_local(local, result)
+
+	return nil
+}
+
+// indexes the value on top of the stack with a constant key, lists are indexed with
+// ints directly
+func (vm *VM) index_constant(key common.Object) error {
+	host := vm.pop()
+
+	if list, ok := host.(common.ListObject); ok {
+		if i, ok := key.(common.Int32Object); ok && i.Value >= 0 && int(i.Value) < len(list.Value) {
+			return vm.push(list.Value[i.Value])
+		}
+	}
+
+	result, err := vm.index(host, key)
+	if err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+// compares the two values on top of the stack and jumps unless the comparison holds,
+// ints are compared directly
+func (vm *VM) compare_jump(f *frame, ip int, instruction common.Instruction) error {
+	right := vm.pop()
+	left := vm.pop()
+	comparison := fused_comparisons[instruction.Op]
+
+	var holds bool
+	a, left_ok := left.(common.Int32Object)
+	b, right_ok := right.(common.Int32Object)
+
+	if left_ok && right_ok {
+		switch comparison {
+		case common.OpGreaterThan:
+			holds = a.Value > b.Value
+		case common.OpGreaterThanOrEqual:
+			holds = a.Value >= b.Value
+		case common.OpEqual:
+			holds = a.Value == b.Value
+		case common.OpNotEqual:
+			holds = a.Value != b.Value
+		}
+	} else {
+		result, err := compare(comparison, left, right)
+		if err != nil {
+			return err
+		}
+
+		holds = result
+	}
+
+	if holds {
+		return nil
+	}
+
+	target, err := f.program.jump_target(ip, int(instruction.Operands[0]), instruction.Operands[1] == 1)
+	if err != nil {
+		return err
+	}
+
+	f.ip = target
+
+	return nil
+}
@@ -1 +1,771 @@
 package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
+	errors "github.com/moonbite-org/moonbite/error"
+)
+
+const StackSize = 2048
+const MaxFrames = 1024
+
+type VM struct {
+	constants   []common.Object
+	globals     []common.Object
+	builtins    []common.Object
+	stack       []common.Object
+	sp          int
+	frames      []*frame
+	last_popped common.Object
+	exit_code   int
+	halted      bool
+	limits      Limits
+	context     context.Context
+	debugger    *Debugger
+	// what is used of the limits in the current run or call
+	executed int
+	objects  int
+	memory   int
+	// the running coroutine, the coroutines that are ready to run and the frames and the
+	// values of the stack below the ones of the coroutines
+	coroutine *coroutine
+	ready     []*coroutine
+	floor     int
+	bottom    int
+	// the number of deferred blocks that run, coroutines cannot be suspended in them
+	deferring int
+	// the methods bound to every type by their names
+	methods map[string]map[string]common.Object
+}
+
+func New(instructions common.InstructionSet, pool common.ConstantPool, interface_ abi.ABI) *VM {
+	vm := &VM{
+		constants: []common.Object{},
+		globals:   []common.Object{},
+		stack:     make([]common.Object, StackSize),
+		frames:    []*frame{},
+		context:   context.Background(),
+		methods:   map[string]map[string]common.Object{},
+	}
+
+	for _, constant := range pool.Values {
+		if constant == nil {
+			break
+		}
+
+		if fun, ok := constant.(common.FunctionObject); ok {
+			vm.constants = append(vm.constants, new_function(fun))
+		} else {
+			vm.constants = append(vm.constants, constant)
+		}
+	}
+
+	core := map[string]common.Object{
+		"exit": common.BuiltinFunObject{
+			Name: "exit",
+			Value: func(params ...common.Object) common.Object {
+				code := 0
+
+				if len(params) > 0 {
+					code = int(to_int(params[0]))
+				}
+
+				vm.exit(code)
+				return common.NullObject{}
+			},
+		},
+		"#null": common.NullObject{},
+		"pause": &method{name: "pause", call: func(vm *VM, arguments []common.Object) error {
+			return vm.pause()
+		}},
+		"channel": &method{name: "channel", call: func(vm *VM, arguments []common.Object) error {
+			return vm.make_channel(arguments)
+		}},
+		"#iterate": &method{name: "#iterate", call: func(vm *VM, arguments []common.Object) error {
+			return vm.iterate(arguments)
+		}},
+	}
+
+	for _, name := range common.Builtins {
+		vm.builtins = append(vm.builtins, core[name])
+	}
+
+	for _, symbol := range interface_.Symbols() {
+		vm.builtins = append(vm.builtins, symbol.Object)
+	}
+
+	vm.frames = append(vm.frames, &frame{
+		program: new_program("<package>", instructions),
+		locals:  []common.Object{},
+		until:   -1,
+	})
+
+	return vm
+}
+
+// runs the program until it ends or exits
+func (vm *VM) Run() errors.Error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it ends, exits or the context is done
+func (vm *VM) RunContext(ctx context.Context) errors.Error {
+	vm.begin(ctx)
+
+	if err := vm.execute(0); err != nil {
+		return vm.trace(err, 0)
+	}
+
+	return errors.EmptyError
+}
+
+// Call calls a function of the program with the given arguments and returns its result.
+// It is meant to be used once Run has returned, when the globals of the program are set.
+func (vm *VM) Call(callee common.Object, arguments ...common.Object) (common.Object, errors.Error) {
+	return vm.CallContext(context.Background(), callee, arguments...)
+}
+
+// CallContext is Call that stops once the context is done
+func (vm *VM) CallContext(ctx context.Context, callee common.Object, arguments ...common.Object) (common.Object, errors.Error) {
+	vm.begin(ctx)
+
+	if vm.halted {
+		return nil, errors.CreateRuntimeError(fmt.Sprintf("the program has exited with code %d", vm.exit_code))
+	}
+
+	depth := len(vm.frames)
+	sp := vm.sp
+
+	// the coroutines the call spawns run above the frames and the values of the program
+	floor, bottom := vm.floor, vm.bottom
+	vm.floor, vm.bottom = depth, sp
+	defer func() {
+		vm.floor, vm.bottom = floor, bottom
+	}()
+
+	result, err := vm.call_function(depth, callee, arguments)
+
+	var trace errors.Error
+	if err != nil {
+		trace = vm.trace(err, depth)
+	}
+
+	// calls that fail or exit leave their frames and values behind
+	vm.frames = vm.frames[:depth]
+
+	for i := sp; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = sp
+
+	if err != nil {
+		return nil, trace
+	}
+
+	return result, errors.EmptyError
+}
+
+func (vm *VM) call_function(depth int, callee common.Object, arguments []common.Object) (common.Object, error) {
+	for _, argument := range arguments {
+		if err := vm.push(argument); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := vm.push(callee); err != nil {
+		return nil, err
+	}
+
+	if err := vm.call(len(arguments)); err != nil {
+		return nil, err
+	}
+
+	if err := vm.execute(depth); err != nil {
+		return nil, err
+	}
+
+	if vm.halted {
+		return common.NullObject{}, nil
+	}
+
+	return vm.pop(), nil
+}
+
+func (vm *VM) ExitCode() int {
+	return vm.exit_code
+}
+
+// the last value popped off the stack, mostly useful for inspecting results
+func (vm *VM) LastPopped() common.Object {
+	return vm.last_popped
+}
+
+func (vm *VM) Global(index int) common.Object {
+	if index >= len(vm.globals) || vm.globals[index] == nil {
+		return common.NullObject{}
+	}
+
+	return vm.globals[index]
+}
+
+func (vm *VM) exit(code int) {
+	vm.exit_code = code
+	vm.halted = true
+}
+
+func (vm *VM) current_frame() *frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) push_frame(f *frame) error {
+	if len(vm.frames) >= vm.max_frames() {
+		return limit_fault(errors.FrameLimitError, "maximum call depth of %d exceeded", vm.max_frames())
+	}
+
+	vm.frames = append(vm.frames, f)
+	return nil
+}
+
+func (vm *VM) pop_frame() *frame {
+	f := vm.current_frame()
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	return f
+}
+
+func (vm *VM) push(object common.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = object
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() common.Object {
+	if vm.sp <= vm.current_frame().base {
+		return common.NullObject{}
+	}
+
+	vm.sp--
+	object := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	vm.last_popped = object
+
+	return object
+}
+
+func (vm *VM) set_global(index int, value common.Object) {
+	for index >= len(vm.globals) {
+		vm.globals = append(vm.globals, nil)
+	}
+
+	vm.globals[index] = value
+}
+
+// executes instructions until the frame count drops to depth
+func (vm *VM) execute(depth int) error {
+	for len(vm.frames) > depth && !vm.halted {
+		f := vm.current_frame()
+
+		if f.is_done() {
+			if f.parent != nil {
+				vm.pop_frame()
+				continue
+			}
+
+			if len(vm.frames) == 1 && f.coroutine == nil {
+				return nil
+			}
+
+			if err := vm.return_from(common.NullObject{}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		ip := f.ip
+		instruction := f.program.instructions[ip]
+
+		if err := vm.check(); err != nil {
+			return locate(err, f, ip)
+		}
+
+		if vm.debugger != nil {
+			if err := vm.debugger.before(f, ip); err != nil {
+				return locate(err, f, ip)
+			}
+		}
+
+		f.ip++
+
+		if err := vm.step(f, ip, instruction); err != nil {
+			return locate(err, f, ip)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) step(f *frame, ip int, instruction common.Instruction) error {
+	operands := instruction.Operands
+
+	switch instruction.Op {
+	case common.OpNoop:
+	case common.OpCast:
+		result, err := cast(vm.pop(), vm.constants[operands[0]])
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	case common.OpConstant:
+		return vm.push(vm.constants[operands[0]])
+	case common.OpSet, common.OpAssign:
+		vm.set_global(int(operands[0]), vm.pop())
+	case common.OpGet:
+		return vm.push(vm.Global(int(operands[0])))
+	case common.OpSetLocal:
+		f.declare_local(int(operands[0]), vm.pop())
+	case common.OpAssignLocal:
+		f.set_local(int(operands[0]), vm.pop())
+	case common.OpGetLocal:
+		return vm.push(f.get_local(int(operands[0])))
+	case common.OpGetBuiltin:
+		if int(operands[0]) >= len(vm.builtins) {
+			return fmt.Errorf("unknown builtin %d", operands[0])
+		}
+		return vm.push(vm.builtins[operands[0]])
+	case common.OpSetItem:
+		return vm.set_item(f, int(operands[0]), int(operands[1]), int(operands[2]))
+	case common.OpCall:
+		return vm.call(int(operands[0]))
+	case common.OpPop:
+		vm.pop()
+	case common.OpReturn:
+		return vm.return_from(vm.pop())
+	case common.OpReturnEmpty:
+		return vm.return_from(common.NullObject{})
+	case common.OpBreak, common.OpBreakEmpty, common.OpContinue:
+		return fmt.Errorf("%s is not allowed outside of loops", instruction.Op)
+	case common.OpDefer:
+		target, err := f.program.jump_target(ip, int(operands[0]), false)
+		if err != nil {
+			return err
+		}
+
+		owner := f.owner()
+		owner.defers = append(owner.defers, deferred{start: ip + 1, end: target})
+		f.ip = target
+	case common.OpYield:
+		return vm.yield(f, vm.pop())
+	case common.OpIndex:
+		key := vm.pop()
+		host := vm.pop()
+		result, err := vm.index(host, key)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	case common.OpTrue:
+		return vm.push(common.BoolObject{Value: true})
+	case common.OpFalse:
+		return vm.push(common.BoolObject{Value: false})
+	case common.OpJump:
+		target, err := f.program.jump_target(ip, int(operands[0]), operands[1] == 1)
+		if err != nil {
+			return err
+		}
+		f.ip = target
+	case common.OpJumpIfFalse:
+		if !is_truthy(vm.pop()) {
+			target, err := f.program.jump_target(ip, int(operands[0]), operands[1] == 1)
+			if err != nil {
+				return err
+			}
+			f.ip = target
+		}
+	case common.OpAdd, common.OpSub, common.OpMul, common.OpDiv, common.OpMod:
+		right := vm.pop()
+		left := vm.pop()
+		result, err := arithmetic(instruction.Op, left, right)
+		if err != nil {
+			return err
+		}
+		if result.Kind() == common.ListObjectKind {
+			if err := vm.allocate(result); err != nil {
+				return err
+			}
+		}
+		return vm.push(result)
+	case common.OpAnd:
+		right := vm.pop()
+		left := vm.pop()
+		return vm.push(common.BoolObject{Value: is_truthy(left) && is_truthy(right)})
+	case common.OpOr:
+		right := vm.pop()
+		left := vm.pop()
+		return vm.push(common.BoolObject{Value: is_truthy(left) || is_truthy(right)})
+	case common.OpArray, common.OpString:
+		count := int(operands[0])
+		result := common.ListObject{Value: make([]common.Object, count), Text: instruction.Op == common.OpString}
+
+		for i := count - 1; i >= 0; i-- {
+			result.Value[i] = vm.pop()
+		}
+
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+
+		return vm.push(result)
+	case common.OpMap:
+		result := common.MapObject{Value: vm.entries(int(operands[0]))}
+
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+
+		return vm.push(result)
+	case common.OpInstance:
+		result := common.InstanceObject{Value: vm.entries(int(operands[0]))}
+
+		if name, ok := vm.constants[operands[1]].(common.StringObject); ok {
+			result.Type = name.Value
+		}
+
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+
+		return vm.push(result)
+	case common.OpNegate:
+		return vm.push(common.BoolObject{Value: !is_truthy(vm.pop())})
+	case common.OpEqual, common.OpNotEqual, common.OpGreaterThan, common.OpGreaterThanOrEqual:
+		right := vm.pop()
+		left := vm.pop()
+		result, err := compare(instruction.Op, left, right)
+		if err != nil {
+			return err
+		}
+		return vm.push(common.BoolObject{Value: result})
+	case common.OpInstanceof:
+		right := vm.pop()
+		left := vm.pop()
+		return vm.push(common.BoolObject{Value: left.Kind() == right.Kind()})
+	case common.OpExit:
+		vm.exit(int(operands[0]))
+	case common.OpGiveup:
+		warning := vm.pop()
+
+		if warning.Kind() == common.NullObjectKind {
+			return fmt.Errorf("gave up")
+		}
+
+		return fmt.Errorf("gave up: %s", common.DisplayObject(warning))
+	case common.OpIncrementLocal:
+		return vm.increment_local(f, int(operands[0]), vm.constants[operands[1]])
+	case common.OpIndexConstant:
+		return vm.index_constant(vm.constants[operands[0]])
+	case common.OpJumpIfNotGreaterThan, common.OpJumpIfNotGreaterThanOrEqual, common.OpJumpIfNotEqual, common.OpJumpIfEqual:
+		return vm.compare_jump(f, ip, instruction)
+	case common.OpGetFree:
+		free, err := f.get_free(int(operands[0]))
+		if err != nil {
+			return err
+		}
+		return vm.push(free.get())
+	case common.OpSetFree:
+		free, err := f.get_free(int(operands[0]))
+		if err != nil {
+			return err
+		}
+		free.set(vm.pop())
+	case common.OpCapture:
+		if operands[1] == 1 {
+			free, err := f.get_free(int(operands[0]))
+			if err != nil {
+				return err
+			}
+			return vm.push(free)
+		}
+		return vm.push(f.capture(int(operands[0])))
+	case common.OpClosure:
+		return vm.closure(int(operands[0]), int(operands[1]))
+	case common.OpCorout:
+		fun, ok := vm.pop().(*function)
+		if !ok {
+			return fmt.Errorf("only functions can be corout functions")
+		}
+		return vm.push(&corout_function{fun: fun})
+	case common.OpMethod:
+		return vm.bind_method(vm.constants[operands[0]], vm.constants[operands[1]], vm.pop())
+	case common.OpGenerator:
+		fun, ok := vm.pop().(*function)
+		if !ok {
+			return fmt.Errorf("only functions can be gen functions")
+		}
+		return vm.push(&generator_function{fun: fun})
+	default:
+		return fmt.Errorf("unknown instruction %s", instruction)
+	}
+
+	return nil
+}
+
+func (vm *VM) call(argument_count int) error {
+	callee := vm.pop()
+	base := vm.sp - argument_count
+
+	switch callee := callee.(type) {
+	case *function:
+		return vm.push_frame(vm.enter(callee, base))
+	case *generator_function:
+		// the generator starts running its body on the first call of next
+		result := &generator{frame: vm.enter(callee.fun, base)}
+		result.frame.generator = result
+		return vm.push(result)
+	case *corout_function:
+		return vm.spawn(callee, base)
+	case *method:
+		return callee.call(vm, vm.take(base))
+	case common.BuiltinFunObject:
+		var result common.Object
+
+		if callee.Blocking != nil {
+			result = callee.Blocking(vm.context, vm.take(base)...)
+		} else {
+			result = callee.Value(vm.take(base)...)
+		}
+
+		// builtins may take long enough for the run to be cancelled meanwhile
+		if err := vm.cancelled(); err != nil {
+			return err
+		}
+
+		warning := common.Object(common.NullObject{})
+
+		if result == nil {
+			result = common.NullObject{}
+		}
+
+		switch object := result.(type) {
+		case common.WarningObject:
+			warning = object.Value
+			result = common.NullObject{}
+		case common.ErrorObject:
+			return fmt.Errorf("%s", object.Reason)
+		}
+
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+
+		// builtins raise warnings the same way functions do
+		if len(vm.frames) > 1 {
+			vm.current_frame().owner().set_local(0, warning)
+		}
+
+		return vm.push(result)
+	default:
+		return fmt.Errorf("cannot call a value of kind %s", callee.Kind())
+	}
+}
+
+// takes the keys and the values of the entries of a map or an instance off the stack
+func (vm *VM) entries(count int) []struct {
+	Key   common.Object
+	Value common.Object
+} {
+	result := make([]struct {
+		Key   common.Object
+		Value common.Object
+	}, count)
+
+	for i := count - 1; i >= 0; i-- {
+		result[i].Value = vm.pop()
+		result[i].Key = vm.pop()
+	}
+
+	return result
+}
+
+// takes the arguments of a call off the stack
+func (vm *VM) take(base int) []common.Object {
+	arguments := make([]common.Object, vm.sp-base)
+	copy(arguments, vm.stack[base:vm.sp])
+
+	for i := base; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = base
+
+	return arguments
+}
+
+// creates the frame of a call to the function, the arguments on the stack become its locals
+func (vm *VM) enter(callee *function, base int) *frame {
+	locals := []common.Object{common.NullObject{}}
+	locals = append(locals, vm.take(base)...)
+
+	return &frame{
+		program: callee.program,
+		base:    base,
+		locals:  locals,
+		free:    callee.free,
+		until:   -1,
+	}
+}
+
+func (vm *VM) return_from(value common.Object) error {
+	f := vm.current_frame()
+
+	if f.parent != nil {
+		return fmt.Errorf("cannot return from a deferred expression")
+	}
+
+	if len(vm.frames) == 1 && f.coroutine == nil {
+		return fmt.Errorf("return is only allowed in functions")
+	}
+
+	defers := f.defers
+	f.defers = nil
+
+	for i := len(defers) - 1; i >= 0; i-- {
+		err := vm.push_frame(&frame{
+			program: f.program,
+			ip:      defers[i].start,
+			base:    vm.sp,
+			parent:  f,
+			until:   defers[i].end,
+		})
+		if err != nil {
+			return err
+		}
+
+		vm.deferring++
+		err = vm.execute(len(vm.frames) - 1)
+		vm.deferring--
+
+		if err != nil {
+			return err
+		}
+
+		if vm.halted {
+			return nil
+		}
+	}
+
+	for i := f.base; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = f.base
+	vm.pop_frame()
+
+	if f.coroutine != nil {
+		return vm.finish(f.coroutine, value)
+	}
+
+	// returning ends a generator, the caller of next gets the last result
+	if f.generator != nil {
+		f.generator.running = false
+		f.generator.done = true
+
+		result, err := vm.iterator_result(value, true)
+		if err != nil {
+			return err
+		}
+		value = result
+	}
+
+	// warnings raised in the callee are visible to the caller through its own warning slot
+	caller := vm.current_frame().owner()
+	if len(vm.frames) > 1 {
+		caller.set_local(0, f.get_local(0))
+	}
+
+	return vm.push(value)
+}
+
+// creates a closure of a function constant from the cells on top of the stack
+func (vm *VM) closure(constant int, count int) error {
+	fun, ok := vm.constants[constant].(*function)
+	if !ok {
+		return fmt.Errorf("cannot create a closure of a value of kind %s", vm.constants[constant].Kind())
+	}
+
+	free := make([]*cell, count)
+
+	for i := count - 1; i >= 0; i-- {
+		captured, ok := vm.pop().(*cell)
+		if !ok {
+			return fmt.Errorf("expected a captured variable for the closure")
+		}
+
+		free[i] = captured
+	}
+
+	result := fun.close(free)
+
+	if err := vm.allocate(result); err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+// the scope of the symbol is 0 for globals, 1 for locals and 2 for free variables
+func (vm *VM) set_item(f *frame, symbol int, size int, scope int) error {
+	path := make([]common.Object, size)
+
+	for i := size - 1; i >= 0; i-- {
+		path[i] = vm.pop()
+	}
+
+	value := vm.pop()
+
+	var root common.Object
+	var free *cell
+
+	switch scope {
+	case 1:
+		root = f.get_local(symbol)
+	case 2:
+		var err error
+		if free, err = f.get_free(symbol); err != nil {
+			return err
+		}
+		root = free.get()
+	default:
+		root = vm.Global(symbol)
+	}
+
+	before, _ := size_of(normalize(root))
+
+	updated, err := set_item(root, path, value)
+	if err != nil {
+		return err
+	}
+
+	// appending to a value grows it
+	if after, ok := size_of(updated); ok && after > before {
+		if err := vm.grow(0, after-before); err != nil {
+			return err
+		}
+	}
+
+	switch scope {
+	case 1:
+		f.set_local(symbol, updated)
+	case 2:
+		free.set(updated)
+	default:
+		vm.set_global(symbol, updated)
+	}
+
+	return nil
+}
@@ -0,0 +1,1149 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
+	compiler "github.com/moonbite-org/moonbite/compiler/cmd"
+	errors "github.com/moonbite-org/moonbite/error"
+	vm "github.com/moonbite-org/moonbite/vm/cmd"
+)
+
+func assert_int(t *testing.T, given, expected int) {
+	if given != expected {
+		t.Errorf("expected int to be %d but got %d", expected, given)
+	}
+}
+
+// runs the main function of a program and returns what it prints
+func run_output(t *testing.T, source string) string {
+	stdout := &strings.Builder{}
+	native := abi.CreateNativeABI(abi.System{Stdin: strings.NewReader(""), Stdout: stdout, Stderr: stdout})
+
+	c, err := compile_with(t, source, native)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	root := c.Modules["root"].Compiler
+	machine := vm.New(root.Instructions, root.ConstantPool, native)
+
+	if err := machine.Run(); err.Exists {
+		t.Fatalf("expected no runtime error but got: %s", err)
+	}
+
+	return stdout.String()
+}
+
+// a program with the given definitions before its main function
+func program(definitions, body string) string {
+	return "package main\n\n" + definitions + "\n\nfun main() {" + body + "\n}\n"
+}
+
+// the definitions of a program, the body of its main function and what it prints
+type program_test struct {
+	definitions string
+	body        string
+	expected    string
+}
+
+func run_programs(t *testing.T, tests []program_test) {
+	t.Helper()
+
+	for _, test := range tests {
+		output := run_output(t, program(test.definitions, test.body))
+
+		if output != test.expected+"\n" {
+			t.Errorf("expected the program with main {%s\n} to print %q but got %q", test.body, test.expected, output)
+		}
+	}
+}
+
+func TestInstructions(t *testing.T) {
+	pool := common.ConstantPool{}
+	two := pool.Add(common.Int32Object{Value: 2})
+	three := pool.Add(common.Int32Object{Value: 3})
+
+	instructions := common.InstructionSet{
+		common.NewInstruction(common.OpConstant, two),
+		common.NewInstruction(common.OpConstant, three),
+		common.NewInstruction(common.OpMul),
+		common.NewInstruction(common.OpConstant, two),
+		common.NewInstruction(common.OpSub),
+		common.NewInstruction(common.OpPop),
+	}
+
+	machine := vm.New(instructions, pool, abi.ABI{})
+	if err := machine.Run(); err.Exists {
+		t.Fatalf("expected no runtime error but got: %s", err)
+	}
+
+	assert_int(t, int(machine.LastPopped().(common.Int32Object).Value), 4)
+}
+
+func TestDivisionByZero(t *testing.T) {
+	pool := common.ConstantPool{}
+	zero := pool.Add(common.Int32Object{Value: 0})
+
+	instructions := common.InstructionSet{
+		common.NewInstruction(common.OpConstant, zero),
+		common.NewInstruction(common.OpConstant, zero),
+		common.NewInstruction(common.OpDiv),
+	}
+
+	machine := vm.New(instructions, pool, abi.ABI{})
+	if err := machine.Run(); !err.Exists {
+		t.Errorf("expected error but no error is present")
+	}
+}
+
+func TestCollections(t *testing.T) {
+	pool := common.ConstantPool{}
+	key := pool.Add(common.StringObject{Value: "a"})
+	value := pool.Add(common.Int32Object{Value: 7})
+
+	instructions := common.InstructionSet{
+		common.NewInstruction(common.OpConstant, key),
+		common.NewInstruction(common.OpConstant, value),
+		common.NewInstruction(common.OpMap, 1),
+		common.NewInstruction(common.OpConstant, key),
+		common.NewInstruction(common.OpIndex),
+		common.NewInstruction(common.OpPop),
+	}
+
+	machine := vm.New(instructions, pool, abi.ABI{})
+	if err := machine.Run(); err.Exists {
+		t.Fatalf("expected no runtime error but got: %s", err)
+	}
+
+	assert_int(t, int(machine.LastPopped().(common.Int32Object).Value), 7)
+}
+
+func TestLoops(t *testing.T) {
+	run_programs(t, []program_test{
+		{"", `
+  var total = 0
+  for (var i = 0; i < 5; i++) {
+    if (i == 3) {
+      continue
+    }
+    total += i
+  }
+  io.println(total)`, "7"},
+		{"", `
+  var j = 0
+  for (j < 100) {
+    j++
+    if (j > 4) {
+      break
+    }
+  }
+  io.println(j)`, "5"},
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	classify := `fun classify(n Int) Int {
+  if (n < 0) {
+    return 1
+  } else if (n == 0) {
+    return 2
+  } else if (n < 10) {
+    return 3
+  } else {
+    return 4
+  }
+}`
+
+	run_programs(t, []program_test{
+		{classify, "\n  io.println(classify(0 - 5))", "1"},
+		{classify, "\n  io.println(classify(0))", "2"},
+		{classify, "\n  io.println(classify(5))", "3"},
+		{classify, "\n  io.println(classify(50))", "4"},
+	})
+}
+
+func TestFloats(t *testing.T) {
+	run_programs(t, []program_test{
+		{"", "\n  io.println(1.5, 0.25, 2.0)", "1.5 0.25 2"},
+		{"", "\n  var x = 1.5\n  io.println(x * 2 + 0.25, x / 2, x - 2)", "3.25 0.75 -0.5"},
+		{"", "\n  var x = 1.5\n  io.println(x < 2, x == 1.5, x > 1.5)", "true true false"},
+		{"", "\n  var Float32 y = 2.5\n  io.println(y * y)", "6.25"},
+	})
+}
+
+func TestPrintStrings(t *testing.T) {
+	run_programs(t, []program_test{
+		{"", "\n  var a = [72, 105]\n  io.println(\"Hi\", a)", "Hi [72, 105]"},
+		{"", "\n  var List<Int32> a = []\n  var b = [\"Hi\"]\n  io.println(\"\", \"H\" + \"i\", a, b)", ` Hi [] ["Hi"]`},
+		{"", "\n  var x = \"H\"\n  x = x + \"i\"\n  io.println(x, x[0])", "Hi 72"},
+	})
+}
+
+func TestConstantPool(t *testing.T) {
+	// more constants than the pool used to hold
+	body := []string{"var total = 0"}
+	for i := 1; i <= 1100; i++ {
+		body = append(body, fmt.Sprintf("total = total + %d", i))
+	}
+
+	output := run_output(t, program("", "\n  "+strings.Join(body, "\n  ")+"\n  io.println(total)"))
+
+	if output != "605550\n" {
+		t.Errorf("expected the sum of 1100 constants to be 605550 but got %q", output)
+	}
+
+	// operands that do not fit are reported where they are compiled from
+	body = []string{}
+	for i := 0; i < 300; i++ {
+		body = append(body, fmt.Sprintf("var v%d = 0", i))
+	}
+
+	_, err := compile_with(t, "package main\n\nfun main() {\n  "+strings.Join(body, "\n  ")+"\n}\n", abi.NativeABI)
+
+	if !err.Exists || !strings.Contains(err.Reason, "does not fit") {
+		t.Fatalf("expected a compile error but got: %s", err)
+	}
+
+	// the first local holds the warning so v255 is the one at index 256
+	if err.Location.Start.Line != 259 {
+		t.Errorf("expected the error to be at line 259 but got: %s", err)
+	}
+}
+
+func TestCallsAndGlobals(t *testing.T) {
+	run_programs(t, []program_test{
+		{`var counter = 0
+
+fun fib(n Int) Int {
+  counter++
+  if (n < 2) {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}`, `
+  var list = [1, 2, 3]
+  list[1] = fib(10)
+  io.println(list, counter)`, "[1, 55, 3] 177"},
+	})
+}
+
+func TestDefer(t *testing.T) {
+	// the deferred call runs after the value to return is evaluated
+	run_programs(t, []program_test{
+		{`var result = 0
+
+fun finish() {
+  result = result * 10
+}
+
+fun work() Int {
+  defer finish()
+  result = 4
+  return result
+}`, `
+  var returned = work()
+  io.println(returned, result)`, "4 40"},
+	})
+}
+
+func TestNativeABI(t *testing.T) {
+	dir := t.TempDir()
+	stdout := &strings.Builder{}
+	native := abi.CreateNativeABI(abi.System{
+		Args:   []string{"first"},
+		Stdin:  strings.NewReader("line\n"),
+		Stdout: stdout,
+		Stderr: stdout,
+	})
+
+	source := strings.ReplaceAll(`package main
+
+fun load(path String) String {
+  return io.read_file(path) or "missing"
+}
+
+fun main() {
+  var numbers = [1, 2]
+  io.write_file("DIR/out.txt", "saved")
+  io.println("hello", 42, numbers, "a" + "b")
+  io.println(load("DIR/out.txt"), load("DIR/none.txt"))
+  io.println(io.read_line(), io.read_line() or "eof")
+  io.println(env.args())
+  syscall.write(1, "done")
+  exit(syscall.write(3, "") or 7)
+}
+`, "DIR", dir)
+
+	if err := os.WriteFile(path.Join(dir, "moon.yml"), []byte("module: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path.Join(dir, "main.mb"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := compiler.New(dir, native)
+	if err := c.Compile(); err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	root := c.Modules["root"].Compiler
+	machine := vm.New(root.Instructions, root.ConstantPool, native)
+
+	if err := machine.Run(); err.Exists {
+		t.Fatalf("expected no runtime error but got: %s", err)
+	}
+
+	expected := "hello 42 [1, 2] ab\nsaved missing\nline eof\n[\"first\"]\ndone"
+
+	if stdout.String() != expected {
+		t.Errorf("expected output to be %q but got %q", expected, stdout.String())
+	}
+
+	assert_int(t, machine.ExitCode(), 7)
+}
+
+func TestUnknownBuiltinMember(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "moon.yml"), []byte("module: test\n"), 0644)
+	os.WriteFile(path.Join(dir, "main.mb"), []byte("package main\n\nfun main() {\n  io.shout(1)\n}\n"), 0644)
+
+	c := compiler.New(dir, abi.NativeABI)
+	if err := c.Compile(); !err.Exists || err.Reason != "builtin 'io.shout' is not defined" {
+		t.Errorf("expected io.shout to not be defined but got: %s", err)
+	}
+}
+
+func compile_with(t *testing.T, source string, interface_ abi.ABI) (compiler.Compiler, errors.Error) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(path.Join(dir, "moon.yml"), []byte("module: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path.Join(dir, "main.mb"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := compiler.New(dir, interface_)
+	return c, c.Compile()
+}
+
+func TestSandbox(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	stdout := &strings.Builder{}
+
+	os.WriteFile(path.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	os.Symlink(outside, path.Join(root, "link"))
+
+	sandbox, sandbox_err := abi.CreateSandboxABI(abi.System{
+		Stdout: stdout,
+		Stdin:  strings.NewReader(""),
+		Root:   root,
+		Env:    map[string]string{"NAME": "moon"},
+	}, abi.StdioCapability, abi.ReadCapability, abi.EnvCapability)
+	if sandbox_err != nil {
+		t.Fatalf("expected no sandbox error but got: %s", sandbox_err)
+	}
+
+	// denied builtins do not compile
+	for _, call := range []string{"io.write_file(\"a\", \"b\")", "time.now()", "net.fetch(\"http://localhost\")"} {
+		_, err := compile_with(t, "package main\n\nfun main() {\n  "+call+"\n}\n", sandbox)
+
+		if !err.Exists || !strings.Contains(err.Reason, "is denied") {
+			t.Errorf("expected %s to be denied but got: %s", call, err)
+		}
+	}
+
+	c, err := compile_with(t, `package main
+
+fun main() {
+  io.println(env.get("NAME"), env.get("HOME") or "unset")
+  io.println(io.read_file("../../link/secret.txt") or ^)
+  io.println(io.exists("/"), io.read_file("/missing.txt") or "missing")
+  var files = io
+  files.write_file("out.txt", "data")
+}
+`, sandbox)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	module := c.Modules["root"].Compiler
+	machine := vm.New(module.Instructions, module.ConstantPool, sandbox)
+
+	// looking a denied builtin up dynamically fails when it is called
+	if err := machine.Run(); !err.Exists || !strings.Contains(err.Reason, "builtin 'io.write_file' is denied") {
+		t.Errorf("expected calling io.write_file to fail but got: %s", err)
+	}
+
+	expected := "moon unset\n../../link/secret.txt is outside of the sandbox\ntrue missing\n"
+
+	if stdout.String() != expected {
+		t.Errorf("expected output to be %q but got %q", expected, stdout.String())
+	}
+
+	if _, err := os.Stat(path.Join(root, "out.txt")); err == nil {
+		t.Errorf("expected out.txt not to be written")
+	}
+}
+
+func TestSandboxEnv(t *testing.T) {
+	for _, capability := range []abi.Capability{abi.ReadCapability, abi.WriteCapability} {
+		if _, err := abi.CreateSandboxABI(abi.System{}, capability); err == nil {
+			t.Errorf("expected granting %s without a root to fail", capability)
+		}
+	}
+
+	stdout := &strings.Builder{}
+
+	sandbox, sandbox_err := abi.CreateSandboxABI(abi.System{
+		Stdout: stdout,
+		Stdin:  strings.NewReader(""),
+	}, abi.StdioCapability, abi.EnvCapability)
+	if sandbox_err != nil {
+		t.Fatalf("expected no sandbox error but got: %s", sandbox_err)
+	}
+
+	c, err := compile_with(t, `package main
+
+fun main() {
+  env.set("MOON_SANDBOX", "set")
+  io.println(env.get("MOON_SANDBOX"), env.get("PATH") or "unset")
+}
+`, sandbox)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	module := c.Modules["root"].Compiler
+	machine := vm.New(module.Instructions, module.ConstantPool, sandbox)
+
+	if err := machine.Run(); err.Exists {
+		t.Fatalf("expected no runtime error but got: %s", err)
+	}
+
+	if stdout.String() != "set unset\n" {
+		t.Errorf("expected output to be %q but got %q", "set unset\n", stdout.String())
+	}
+
+	// the variables of the host process are left alone
+	if _, ok := os.LookupEnv("MOON_SANDBOX"); ok {
+		t.Errorf("expected the sandbox not to set MOON_SANDBOX on the host")
+	}
+}
+
+func TestSandboxWithoutStreams(t *testing.T) {
+	sandbox, sandbox_err := abi.CreateSandboxABI(abi.System{}, abi.StdioCapability)
+	if sandbox_err != nil {
+		t.Fatalf("expected no sandbox error but got: %s", sandbox_err)
+	}
+
+	c, err := compile_with(t, `package main
+
+fun main() {
+  io.print("out")
+  io.println(io.read_line() or "eof")
+  syscall.write(2, "err")
+}
+`, sandbox)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	module := c.Modules["root"].Compiler
+	machine := vm.New(module.Instructions, module.ConstantPool, sandbox)
+
+	// missing streams are empty instead of crashing the host
+	if err := machine.Run(); err.Exists {
+		t.Errorf("expected no runtime error but got: %s", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		source string
+		limits vm.Limits
+		kind   errors.ErrorKind
+		line   int
+		cancel bool
+	}{
+		{"fun main() {\n  var i = 0\n  for (true) {\n    i++\n  }\n}", vm.Limits{Instructions: 1000}, errors.InstructionLimitError, 0, false},
+		{"fun deep(n Int) Int {\n  return deep(n + 1)\n}\n\nfun main() {\n  deep(0)\n}", vm.Limits{Frames: 50}, errors.FrameLimitError, 2, false},
+		{"fun main() {\n  var list = []\n  var i = 0\n  for (true) {\n    list[i] = i\n    i++\n  }\n}", vm.Limits{Memory: 1024}, errors.MemoryLimitError, 5, false},
+		{"fun main() {\n  for (true) {\n    var list = [1, 2]\n  }\n}", vm.Limits{Objects: 100}, errors.MemoryLimitError, 3, false},
+		{"fun main() {\n  for (true) {\n  }\n}", vm.Limits{}, errors.CancelledError, 0, true},
+		{"fun main() {\n  var zero = 0\n  exit(1 / zero)\n}", vm.Limits{}, errors.RuntimeError, 3, false},
+	}
+
+	for _, test := range tests {
+		c, err := compile_with(t, "package main\n\n"+test.source, abi.NativeABI)
+		if err.Exists {
+			t.Fatalf("expected no compile error but got: %s", err)
+		}
+
+		root := c.Modules["root"].Compiler
+		machine := vm.New(root.Instructions, root.ConstantPool, abi.NativeABI)
+		machine.SetLimits(test.limits)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.cancel {
+			cancel()
+		}
+
+		err = machine.RunContext(ctx)
+		cancel()
+
+		if !err.Exists || err.Kind != test.kind {
+			t.Errorf("expected a %s but got: %s", errors.ErrorKindMap[test.kind], err)
+			continue
+		}
+
+		// lines are counted after the package clause
+		if test.line > 0 && err.Location.Start.Line != test.line+2 {
+			t.Errorf("expected the error to be at line %d but got: %s", test.line+2, err)
+		}
+
+		if err.Location.File != "main.mb" {
+			t.Errorf("expected the error to be located in main.mb but got: %s", err)
+		}
+	}
+}
+
+func TestCancelBlockingBuiltins(t *testing.T) {
+	native := abi.CreateNativeABI(abi.System{
+		Fetch: func(ctx context.Context, url string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	})
+
+	for _, call := range []string{"time.sleep(3000)", "net.fetch(\"http://localhost\")"} {
+		c, err := compile_with(t, "package main\n\nfun main() {\n  "+call+"\n  exit(1)\n}\n", native)
+		if err.Exists {
+			t.Fatalf("expected no compile error but got: %s", err)
+		}
+
+		root := c.Modules["root"].Compiler
+		machine := vm.New(root.Instructions, root.ConstantPool, native)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		err = machine.RunContext(ctx)
+		cancel()
+
+		if !err.Exists || err.Kind != errors.CancelledError {
+			t.Errorf("expected %s to be cancelled but got: %s", call, err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected %s to stop at the deadline but it took %s", call, elapsed)
+		}
+	}
+}
+
+func run_failing(t *testing.T, source string) errors.Error {
+	c, err := compile_with(t, source, abi.NativeABI)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	root := c.Modules["root"].Compiler
+	machine := vm.New(root.Instructions, root.ConstantPool, abi.NativeABI)
+
+	err = machine.Run()
+	if !err.Exists {
+		t.Fatalf("expected a runtime error")
+	}
+
+	return err
+}
+
+func TestStackTrace(t *testing.T) {
+	err := run_failing(t, `package main
+
+fun divide(a Int, b Int) Int {
+  return a / b
+}
+
+fun average(list List<Int>, length Int) Int {
+  return divide(list[0], length)
+}
+
+fun main() {
+  var list = [4]
+  var length = 0
+  average(list, length)
+}
+`)
+
+	functions := []string{}
+	for _, frame := range err.Stack {
+		functions = append(functions, frame.Function)
+	}
+
+	if strings.Join(functions, " ") != "divide average main <package>" {
+		t.Fatalf("unexpected stack %v", functions)
+	}
+
+	if err.Stack[0].Location.Start.Line != 4 || err.Stack[1].Location.Start.Line != 8 || err.Stack[2].Location.Start.Line != 14 {
+		t.Errorf("unexpected lines in the stack:\n%s", err)
+	}
+
+	if !strings.Contains(err.String(), "division by zero at 4:10 in main.mb\n    at divide (main.mb:4:10)\n    at average (main.mb:8:16)") {
+		t.Errorf("unexpected trace:\n%s", err)
+	}
+
+	err = run_failing(t, "package main\n\nfun open() {\n  warn(\"no such file\")\n}\n\nfun main() {\n  open() or give up\n}\n")
+
+	if err.Reason != "gave up: no such file" || len(err.Stack) != 2 || err.Stack[0].Function != "main" {
+		t.Errorf("unexpected error for giving up:\n%s", err)
+	}
+
+	err = run_failing(t, "package main\n\nfun main() {\n  var count = 7\n  var wide = count.(Int64)\n  var text = \"text\"\n  var number = text.(Int)\n  exit(wide + number)\n}\n")
+
+	if !strings.Contains(err.Reason, "cannot cast a value of kind object:list to object:int32") || err.Location.Start.Line != 7 {
+		t.Errorf("unexpected error for a bad cast:\n%s", err)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	c, err := compile_with(t, "package main\n\nfun divide(a Int, b Int) Int {\n  return a / b\n}\n\nfun main() {\n  var zero = 0\n  divide(1, zero)\n}\n", abi.NativeABI)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	// the locations of compiled modules are read from their source maps
+	module, d_err := common.Deserialize(c.Modules["root"].Compiler.GetBytes())
+	if d_err != nil {
+		t.Fatal(d_err)
+	}
+
+	machine := vm.New(module.Instructions, module.ConstantPool, abi.NativeABI)
+	err = machine.Run()
+
+	if !strings.Contains(err.String(), "division by zero at 4:10 in main.mb\n    at divide (main.mb:4:10)\n    at main (main.mb:9:9)") {
+		t.Errorf("unexpected trace:\n%s", err)
+	}
+}
+
+const debugged = `package main
+
+fun divide(a Int, b Int) Int {
+  var result = a / b
+  return result
+}
+
+fun main() {
+  var total = 0
+  for (var i = 1; i < 4; i++) {
+    total = total + divide(12, i)
+  }
+  var done = true
+  exit(total)
+}
+`
+
+func TestDebugger(t *testing.T) {
+	c, err := compile_with(t, debugged, abi.NativeABI)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	module := c.Modules["root"].Compiler.GetModule()
+	machine := vm.New(module.Instructions, module.ConstantPool, abi.NativeABI)
+
+	pauses := []string{}
+	actions := []vm.Action{vm.Continue, vm.StepOver, vm.StepOver, vm.StepIn, vm.StepIn, vm.StepIn, vm.StepOut, vm.Continue}
+
+	debugger := vm.NewDebugger(machine, module.Symbols, func(d *vm.Debugger, pause vm.Pause) vm.Action {
+		variables := []string{}
+		for _, variable := range d.Locals(0) {
+			variables = append(variables, variable.Name+"="+common.FormatObject(variable.Value))
+		}
+
+		pauses = append(pauses, fmt.Sprintf("%s %s:%d [%s]", pause.Reason, pause.Stack[0].Function, pause.Location.Start.Line, strings.Join(variables, " ")))
+
+		if len(pauses) == 2 {
+			if total, ok := d.Lookup("total", 1); !ok || common.FormatObject(total) != "0" {
+				t.Errorf("expected total to be 0 in the caller but got %v", total)
+			}
+
+			d.ClearBreakpoint("main.mb", 4)
+		}
+
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	})
+
+	if !debugger.SetBreakpoint("main.mb", 4) {
+		t.Errorf("expected code at line 4")
+	}
+
+	if debugger.SetBreakpoint("main.mb", 7) {
+		t.Errorf("expected no code at line 7")
+	}
+	debugger.ClearBreakpoint("main.mb", 7)
+
+	if err := machine.Run(); err.Exists {
+		t.Fatalf("expected no runtime error but got: %s", err)
+	}
+
+	expected := []string{
+		"entry <package>:3 []",
+		"breakpoint divide:4 [a=12 b=1 result=null]",
+		"step divide:5 [a=12 b=1 result=12]",
+		"step main:11 [total=0 i=1]",
+		"step main:10 [total=12 i=1]",
+		"step main:11 [total=12 i=2]",
+		"step divide:4 [a=12 b=2 result=null]",
+		"step main:11 [total=12 i=2]",
+	}
+
+	if strings.Join(pauses, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the pauses to be:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(pauses, "\n"))
+	}
+
+	assert_int(t, machine.ExitCode(), 22)
+}
+
+func TestREPL(t *testing.T) {
+	c, err := compile_with(t, debugged, abi.NativeABI)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	module := c.Modules["root"].Compiler.GetModule()
+	machine := vm.New(module.Instructions, module.ConstantPool, abi.NativeABI)
+	output := &strings.Builder{}
+
+	vm.NewDebugger(machine, module.Symbols, vm.REPL(strings.NewReader("b 14\nb main.mb:x\nc\np done\np total\nbt\nf 1\np missing\nq\n"), output))
+
+	if err := machine.Run(); err.Kind != errors.CancelledError {
+		t.Errorf("expected quitting to stop the program but got: %s", err)
+	}
+
+	for _, expected := range []string{
+		"paused at <package> (main.mb:3:1) (entry)",
+		"expected a line such as main.mb:12 but got 'x'",
+		"paused at main (main.mb:14:8) (breakpoint)",
+		"done = true\n",
+		"total = 22\n",
+		"#0 at main (main.mb:14:8)\n#1 at <package>\n",
+		"'missing' is not defined",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the output to contain %q but got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestOptimizations(t *testing.T) {
+	source := `package main
+
+fun folded() Int {
+  return (2 + 3) * 4 - 10 / 3
+}
+
+fun pruned(n Int) Int {
+  if (1 > 2) {
+    return 600
+  } else if (n > 0) {
+    return n
+  } else if (true && !false) {
+    return 7
+  } else {
+    return 800
+  }
+}
+
+fun early(n Int) Int {
+  return n * 2
+  exit(900)
+}
+
+fun loop(n Int) Int {
+  var total = 0
+  for (var i = 0; i < n; i++) {
+    if (i == 3) {
+      return total
+      total = 1000
+    }
+    total = total + i
+  }
+  return total
+}
+
+fun main() {
+  io.println(folded(), pruned(0), pruned(5), early(1), loop(10))
+}
+`
+
+	if output := run_output(t, source); output != "17 7 5 2 3\n" {
+		t.Errorf("expected the optimized functions to print %q but got %q", "17 7 5 2 3\n", output)
+	}
+
+	c, err := compile_with(t, source, abi.NativeABI)
+	if err.Exists {
+		t.Fatalf("expected no compile error but got: %s", err)
+	}
+
+	pool := c.Modules["root"].Compiler.ConstantPool
+	functions := map[string]common.InstructionSet{}
+
+	for _, constant := range pool.Values {
+		if fun, ok := constant.(common.FunctionObject); ok {
+			functions[fun.Name] = fun.Value
+		}
+
+		// the branches that are never taken are not compiled
+		if number, ok := constant.(common.Int32Object); ok && (number.Value == 600 || number.Value == 800) {
+			t.Errorf("expected %d to not be in the constant pool", number.Value)
+		}
+	}
+
+	for _, instruction := range functions["folded"] {
+		switch instruction.Op {
+		case common.OpAdd, common.OpSub, common.OpMul, common.OpDiv:
+			t.Errorf("expected the arithmetic of folded to be folded but got %s", instruction.Op)
+		}
+	}
+
+	if last := functions["early"][len(functions["early"])-1]; last.Op != common.OpReturn {
+		t.Errorf("expected early to end with its return but got %s", last.Op)
+	}
+
+	for _, instruction := range functions["loop"] {
+		if instruction.Op == common.OpSetLocal && instruction.Location.Start.Line == 29 {
+			t.Errorf("expected the assignment after the return in loop to be removed")
+		}
+	}
+
+	// expressions that fail are left to the vm
+	err = run_failing(t, "package main\n\nfun main() {\n  exit(1 / 0)\n}\n")
+	if err.Reason != "division by zero" {
+		t.Errorf("unexpected error for a division by zero:\n%s", err)
+	}
+}
+
+func TestSuperinstructions(t *testing.T) {
+	source := `package main
+
+fun tally(n Int) Int {
+  var hits = 0
+  for (var i = 0; i < n; i++) {
+    if (i == 2) {
+      hits += 10
+    } else if (i != 3) {
+      hits += 1
+    }
+    if (i >= 4) {
+      hits += 100
+    }
+    if (i <= 0) {
+      hits += 1000
+    }
+  }
+  return hits
+}
+
+fun main() {
+  var seven = 7
+  var wide = seven.(Int64)
+  wide++
+  var back = wide.(Int)
+  var list = [5, 6, 7]
+  var text = "abc"
+  var letter = text[1] - 'a'
+  io.println(tally(6), list[2], letter, back)
+}
+`
+
+	for _, plain := range []bool{false, true} {
+		root := compile_source(t, source, plain).Compiler
+		ops := count_ops(root.ConstantPool, root.Instructions)
+
+		fused := ops[common.OpIncrementLocal] > 0 && ops[common.OpIndexConstant] > 0 && ops[common.OpJumpIfNotGreaterThan] > 0 &&
+			ops[common.OpJumpIfNotGreaterThanOrEqual] > 0 && ops[common.OpJumpIfNotEqual] > 0 && ops[common.OpJumpIfEqual] > 0
+
+		if fused == plain {
+			t.Errorf("expected superinstructions only when they are not disabled, got %v", ops)
+		}
+
+		stdout := &strings.Builder{}
+		machine := vm.New(root.Instructions, root.ConstantPool, abi.CreateNativeABI(abi.System{Stdout: stdout}))
+		if err := machine.Run(); err.Exists {
+			t.Fatalf("expected no runtime error but got: %s", err)
+		}
+
+		if stdout.String() != "1214 7 1 8\n" {
+			t.Errorf("expected %q but got %q", "1214 7 1 8\n", stdout.String())
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	// every iteration declares its own variable, so the closures made in the loop see the
+	// value of the iteration that made them, and other locals reusing the slot do not
+	// change it
+	run_programs(t, []program_test{
+		{`fun counter(start Int) fun() Int {
+  var count = start
+  return fun() Int {
+    count++
+    return count
+  }
+}`, `
+  var next = counter(10)
+  io.println(next(), next(), next())`, "11 12 13"},
+		{"", `
+  var total = 1
+  var list = [0, 0]
+  var add = fun(amount Int) {
+    var inner = fun() {
+      total = total + amount
+      list[1] = total
+    }
+    inner()
+  }
+  add(2)
+  add(3)
+  io.println(total, list)`, "6 [0, 6]"},
+		{"", `
+  var first = fun() Int {
+    return 0
+  }
+  var last = first
+  for (var i = 0; i < 3; i++) {
+    var value = i + 1
+    if (i == 0) {
+      first = fun() Int {
+        return value
+      }
+    }
+    last = fun() Int {
+      return value
+    }
+  }
+  var other = 5
+  io.println(first(), last(), other)`, "1 3 5"},
+	})
+}
+
+func TestGenerators(t *testing.T) {
+	// the generator keeps its locals between the calls of next, the value it returns
+	// is the last result and every call after it is done
+	run_programs(t, []program_test{
+		{"", `
+  const range = gen fun(from Int, to Int) Int {
+    for (var i = from; i < to; i++) {
+      yield i
+    }
+    return 9
+  }
+  var g = range(3, 5)
+  var a = g.next()
+  var b = g.next()
+  var c = g.next()
+  var d = g.next()
+  io.println(a.value, b.value, c.value)
+  io.println(a.is_done, b.is_done, c.is_done, d.is_done)`, "3 4 9\nfalse false true true"},
+		{"", `
+  const range = gen fun(from Int, to Int) Int {
+    for (var i = from; i < to; i++) {
+      yield i
+    }
+  }
+  for (i, value of range(1, 10)) {
+    if (value == 3) {
+      continue
+    }
+    if (value == 6) {
+      break
+    }
+    var total = 0
+    for (, other of range(0, value)) {
+      total += other
+    }
+    io.println(i, value, total)
+  }`, "0 1 0\n1 2 1\n3 4 6\n4 5 10"},
+		{"", `
+  var step = 2
+  var evens = gen fun() Int {
+    var value = 0
+    for (true) {
+      yield value
+      value += step
+    }
+  }
+  var g = evens()
+  var first = g.next().value
+  step = 5
+  io.println(first, g.next().value, g.next().value)`, "0 5 10"},
+	})
+}
+
+func TestCoroutines(t *testing.T) {
+	// the coroutines take turns in the order they get ready, the player receives the
+	// ball until the channel is closed and the program joins it for the number of hits
+	run_programs(t, []program_test{
+		{"", `
+  var log = []
+  const worker = corout fun(name Int, count Int) Int {
+    for (var i = 0; i < count; i++) {
+      log = log + [name * 10 + i]
+      pause()
+    }
+    return name * 100
+  }
+  var a = worker(1, 3)
+  var b = worker(2, 2)
+  io.println(a.join(), b.join(), log)`, "100 200 [10, 20, 11, 21, 12]"},
+		{"", `
+  var ping = channel()
+  var pong = channel(1)
+  const player = corout fun() Int {
+    var hits = 0
+    for (, ball of ping) {
+      hits++
+      pong.send(ball + 1)
+    }
+    return hits
+  }
+  var p = player()
+  var ball = 0
+  for (var i = 0; i < 5; i++) {
+    ping.send(ball)
+    ball = pong.receive()
+  }
+  ping.close()
+  io.println(ball, p.join())`, "5 5"},
+	})
+
+	err := run_failing(t, "package main\n\nfun main() {\n  var values = channel()\n  values.receive()\n}\n")
+
+	if !strings.Contains(err.Reason, "deadlock") || err.Location.Start.Line != 5 {
+		t.Errorf("unexpected error for a deadlock:\n%s", err)
+	}
+
+	// closing a channel fails the send that waits on it instead of leaving it waiting
+	err = run_failing(t, `package main
+
+fun main() {
+  var values = channel()
+  const sender = corout fun() {
+    values.send(1)
+  }
+  var s = sender()
+  pause()
+  values.close()
+  s.join()
+}
+`)
+
+	if err.Reason != "cannot send to a closed channel" || err.Location.Start.Line != 6 {
+		t.Errorf("unexpected error for a send on a closed channel:\n%s", err)
+	}
+}
+
+func TestForOfLoops(t *testing.T) {
+	// the keys of lists and strings are indices and the keys of maps are their keys,
+	// instances of types that implement Iterable are iterated with their next method
+	countdown := `type Countdown implements [Iterable<Int>] {
+  step fun() Int;
+}
+
+fun for Countdown next() IteratorResult<Int> {
+  var value = this.step()
+  return IteratorResult{value: value, is_done: value < 0}
+}
+
+fun countdown(from Int) Countdown {
+  var current = from + 1
+  return Countdown{step: fun() Int {
+    current--
+    return current
+  }}
+}
+
+fun sum(values Iterable<Int>) Int {
+  var total = 0
+  for (, value of values) {
+    total += value
+  }
+  return total
+}`
+
+	run_programs(t, []program_test{
+		{"type Counter {\n  count Int;\n}\n\nfun for Counter plus(amount Int) Int {\n  return this.count + amount\n}", `
+  var c = Counter{count: 4}
+  io.println(c.plus(3))`, "7"},
+		{"", `
+  for (i, value of [5, 6, 7]) {
+    io.println(i, value)
+  }`, "0 5\n1 6\n2 7"},
+		{"", `
+  for (i, letter of "abc") {
+    io.println(i, letter - 'a')
+  }`, "0 0\n1 1\n2 2"},
+		{"", `
+  var scores = {one: 1, two: 2}
+  for (key, score of scores) {
+    io.println(key, score)
+  }`, "one 1\ntwo 2"},
+		{countdown, `
+  for (i, value of countdown(2)) {
+    io.println(i, value)
+  }`, "0 2\n1 1\n2 0"},
+		{countdown, "\n  io.println(sum(countdown(4)))", "10"},
+	})
+}
+
+func TestForOfClosures(t *testing.T) {
+	// the key and the value are declared in every iteration, so closures made in the loop
+	// keep the ones of their own iteration
+	run_programs(t, []program_test{
+		{"", `
+  var fs = []
+  for (i, v of [1, 2, 3]) {
+    fs = fs + [fun() Int {
+      return v * 10 + i
+    }]
+  }
+  io.println(fs[0](), fs[1](), fs[2]())`, "10 21 32"},
+	})
+}
+
+func TestLoopClosures(t *testing.T) {
+	// the counter of a loop is copied for every iteration before it is incremented, so
+	// closures keep the value of their own iteration along with the changes it makes
+	run_programs(t, []program_test{
+		{"", `
+  var fs = []
+  for (var i = 0; i < 3; i++) {
+    fs = fs + [fun() Int {
+      return i
+    }]
+  }
+  io.println(fs[0](), fs[1](), fs[2]())`, "0 1 2"},
+		{"", `
+  var gs = []
+  for (var j = 0; j < 4; j++) {
+    gs = gs + [fun() Int {
+      return j
+    }]
+    j++
+  }
+  io.println(gs[0](), gs[1]())`, "1 3"},
+	})
+}
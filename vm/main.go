@@ -1,21 +1,88 @@
 package main
 
 import (
-	"fmt"
+	"os"
+	"path"
 
 	"github.com/moonbite-org/moonbite/abi"
+	"github.com/moonbite-org/moonbite/common"
 	compiler "github.com/moonbite-org/moonbite/compiler/cmd"
+	vm "github.com/moonbite-org/moonbite/vm/cmd"
 )
 
-func main() {
-	c := compiler.New("/Users/muhammedalican/Documents/projects/a-star", abi.NativeABI)
+func load(input string) (common.Module, string) {
+	if path.Ext(input) == common.ModuleExtension {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			return common.Module{}, err.Error()
+		}
+
+		module, err := common.Deserialize(data)
+		if err != nil {
+			return common.Module{}, err.Error()
+		}
+
+		return module, ""
+	}
+
+	c := compiler.New(input, abi.NativeABI)
 	if err := c.Compile(); err.Exists {
-		fmt.Println(err)
+		return common.Module{}, err.String()
+	}
+
+	return c.Modules["root"].Compiler.GetModule(), ""
+}
+
+func main() {
+	args := os.Args[1:]
+
+	// debug runs the program under a debugger, the commands are read from the terminal
+	// or from the file given with --commands so that the program keeps stdin to itself
+	debug := len(args) > 0 && args[0] == "debug"
+	commands := "/dev/tty"
+	if debug {
+		args = args[1:]
+
+		if len(args) > 1 && args[0] == "--commands" {
+			commands = args[1]
+			args = args[2:]
+		}
+	}
+
+	if len(args) < 1 {
+		os.Stderr.WriteString("no input provided\n")
+		os.Exit(1)
+	}
+
+	module, err := load(args[0])
+	if len(err) != 0 {
+		os.Stderr.WriteString(err + "\n")
+		os.Exit(1)
+	}
+
+	// the arguments after the program are passed to it
+	native := abi.CreateNativeABI(abi.System{
+		Args:   args[1:],
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	machine := vm.New(module.Instructions, module.ConstantPool, native)
+
+	if debug {
+		input, err := os.Open(commands)
+		if err != nil {
+			os.Stderr.WriteString("cannot read debugger commands: " + err.Error() + ", give a file with --commands\n")
+			os.Exit(1)
+		}
+
+		vm.NewDebugger(machine, module.Symbols, vm.REPL(input, os.Stderr))
+	}
+
+	if err := machine.Run(); err.Exists {
+		os.Stderr.WriteString(err.String() + "\n")
+		os.Exit(1)
 	}
 
-	root := c.Modules["root"].Compiler
-	fmt.Println(root.Instructions)
-	fmt.Println(root.ConstantPool)
-	fmt.Println(root.SymbolTable)
-	fmt.Println(root.GetBytes())
+	os.Exit(machine.ExitCode())
 }